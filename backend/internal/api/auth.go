@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"atlas/internal/auth"
+	"atlas/internal/events"
 	"atlas/internal/random"
 
 	"github.com/go-chi/chi/v5"
@@ -52,6 +53,7 @@ func registerAuthRoutes(r chi.Router, db *sql.DB) {
 			httpErr(w, http.StatusInternalServerError, "create user failed")
 			return
 		}
+		events.Publish(events.UserCreated, "", req.Username, map[string]string{"username": req.Username, "role": "User"})
 		w.WriteHeader(http.StatusCreated)
 	})
 
@@ -79,6 +81,7 @@ func registerAuthRoutes(r chi.Router, db *sql.DB) {
 			httpErr(w, http.StatusInternalServerError, "create user failed")
 			return
 		}
+		events.Publish(events.UserCreated, "", auth.UserFromContext(r).Username, map[string]string{"username": req.Username, "role": role})
 		w.WriteHeader(http.StatusCreated)
 	})
 
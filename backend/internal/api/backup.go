@@ -11,6 +11,7 @@ import (
 	"atlas/internal/auth"
 	"atlas/internal/backup"
 	"atlas/internal/contentpath"
+	"atlas/internal/events"
 	"atlas/internal/httpx"
 	"atlas/internal/storage"
 
@@ -25,6 +26,11 @@ func registerBackupRoutes(r chi.Router, db *sql.DB, restoreCh chan<- string) {
 			httpx.WriteError(w, http.StatusInternalServerError, "BACKUP_CREATE_FAILED", err.Error())
 			return
 		}
+		name := filepath.Base(path)
+		events.Publish(events.BackupFinished, "", auth.UserFromContext(r).Username, events.BackupFinishedData{
+			ID:   strings.TrimSuffix(name, filepath.Ext(name)),
+			File: name,
+		})
 		json.NewEncoder(w).Encode(map[string]any{"path": path, "sig": sig})
 	})
 
@@ -42,6 +48,24 @@ func registerBackupRoutes(r chi.Router, db *sql.DB, restoreCh chan<- string) {
         DROP TABLE IF EXISTS meta;
         DROP TABLE IF EXISTS user_preferences;
         DROP TABLE IF EXISTS user_drafts;
+        DROP TABLE IF EXISTS draft_shares;
+        DROP TABLE IF EXISTS draft_bases;
+        DROP TABLE IF EXISTS document_aliases;
+        DROP TABLE IF EXISTS document_links;
+        DROP TABLE IF EXISTS document_headings;
+        DROP TABLE IF EXISTS document_tags;
+        DROP TABLE IF EXISTS review_policies;
+        DROP TABLE IF EXISTS document_revisions;
+        DROP TABLE IF EXISTS revision_events;
+        DROP TABLE IF EXISTS document_locks;
+        DROP TABLE IF EXISTS comment_threads;
+        DROP TABLE IF EXISTS comments;
+        DROP TABLE IF EXISTS document_suggestions;
+        DROP TABLE IF EXISTS document_watches;
+        DROP TABLE IF EXISTS notifications;
+        DROP TABLE IF EXISTS mail_queue;
+        DROP TABLE IF EXISTS webhooks;
+        DROP TABLE IF EXISTS webhook_deliveries;
         DROP TABLE IF EXISTS documents_fts;
         `
 		if _, err := db.Exec(drop); err != nil {
@@ -18,7 +18,10 @@ import (
 
 	"atlas/internal/documents"
 	"atlas/internal/httpx"
+	"atlas/internal/mail"
+	"atlas/internal/notifications"
 	"atlas/internal/random"
+	"atlas/internal/webhooks"
 
 	"github.com/go-chi/chi/v5"
 	_ "golang.org/x/image/bmp"
@@ -36,6 +39,9 @@ func RegisterRoutes(r chi.Router, db *sql.DB, restoreCh chan<- string) {
 	registerPreferenceRoutes(r, db)
 	registerBackupRoutes(r, db, restoreCh)
 	documents.RegisterRoutes(r, db)
+	notifications.RegisterRoutes(r, db)
+	mail.RegisterRoutes(r, db)
+	webhooks.RegisterRoutes(r, db)
 }
 
 func detectImageType(header []byte) (ext string, mime string, ok bool) {
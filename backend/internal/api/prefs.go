@@ -8,6 +8,7 @@ import (
 
 	"atlas/internal/auth"
 	"atlas/internal/documents"
+	"atlas/internal/events"
 	"atlas/internal/prefs"
 
 	"github.com/go-chi/chi/v5"
@@ -34,6 +35,7 @@ func registerPreferenceRoutes(r chi.Router, db *sql.DB) {
 			httpErr(w, http.StatusInternalServerError, "failed to set start page")
 			return
 		}
+		events.Publish(events.TreeChanged, slug, auth.UserFromContext(r).Username, nil)
 		w.WriteHeader(http.StatusNoContent)
 	})
 
@@ -42,6 +44,7 @@ func registerPreferenceRoutes(r chi.Router, db *sql.DB) {
 			httpErr(w, http.StatusInternalServerError, "failed to remove start page")
 			return
 		}
+		events.Publish(events.TreeChanged, "", auth.UserFromContext(r).Username, nil)
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
@@ -17,9 +17,13 @@ import (
 	"atlas/internal/api"
 	"atlas/internal/contentpath"
 	"atlas/internal/documents"
+	"atlas/internal/events"
 	"atlas/internal/httpx"
+	"atlas/internal/mail"
+	"atlas/internal/notifications"
 	"atlas/internal/restore"
 	"atlas/internal/storage"
+	"atlas/internal/webhooks"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -89,6 +93,12 @@ func Run() {
 		}
 	}
 
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	documents.StartScheduler(schedulerCtx, db)
+	mail.Start(schedulerCtx, db)
+	notifications.Start(db)
+	webhooks.Start(db)
+
 	r := chi.NewRouter()
 
 	restoreCh := make(chan string, 1)
@@ -105,6 +115,8 @@ func Run() {
 	})
 	api.RegisterRoutes(apiRouter, db, restoreCh)
 	r.Mount("/api", apiRouter)
+	documents.RegisterRealtimeRoutes(r, db)
+	events.RegisterRoutes(r, db)
 
 	uploadsDir := filepath.Clean("./data/uploads")
 	os.MkdirAll(uploadsDir, 0o755)
@@ -121,6 +133,14 @@ func Run() {
 	staticFS := http.FileServer(http.Dir(dist))
 	r.Handle("/assets/*", staticFS)
 
+	r.Get("/d/{docID}", func(w http.ResponseWriter, req *http.Request) {
+		if slug, ok := documents.SlugForDocID(db, chi.URLParam(req, "docID")); ok {
+			http.Redirect(w, req, docURL(slug), http.StatusFound)
+			return
+		}
+		http.NotFound(w, req)
+	})
+
 	r.HandleFunc("/*", func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != http.MethodGet && req.Method != http.MethodHead {
 			http.NotFound(w, req)
@@ -146,15 +166,20 @@ func Run() {
 		if slugCandidate != "" && !strings.HasPrefix(p, "/doc/") {
 			if docPath, err := documents.DocPathFromSlug(slugCandidate); err == nil {
 				if _, statErr := os.Stat(docPath); statErr == nil {
-					parts := strings.Split(slugCandidate, "/")
-					for i, part := range parts {
-						parts[i] = url.PathEscape(part)
-					}
-					redirectURL := "/doc/" + strings.Join(parts, "/")
-					http.Redirect(w, req, redirectURL, http.StatusMovedPermanently)
+					http.Redirect(w, req, docURL(slugCandidate), http.StatusMovedPermanently)
 					return
 				}
 			}
+			if target, ok := documents.ResolveSlugAlias(db, slugCandidate); ok {
+				http.Redirect(w, req, docURL(target), http.StatusMovedPermanently)
+				return
+			}
+		}
+		if strings.HasPrefix(slugCandidate, "doc/") {
+			if target, ok := documents.ResolveSlugAlias(db, strings.TrimPrefix(slugCandidate, "doc/")); ok {
+				http.Redirect(w, req, docURL(target), http.StatusMovedPermanently)
+				return
+			}
 		}
 
 		index := filepath.Join(dist, "index.html")
@@ -167,6 +192,7 @@ func Run() {
 
 	addr := ":8080"
 	srv := &http.Server{Addr: addr, Handler: r, ReadTimeout: 15 * time.Second, WriteTimeout: 15 * time.Second}
+	srv.RegisterOnShutdown(events.Shutdown)
 	log.Printf("listening on %s", addr)
 
 	go func() {
@@ -191,6 +217,10 @@ func Run() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown: %v", err)
 	}
+	stopScheduler()
+	documents.FlushCollaboration()
+	notifications.Stop()
+	webhooks.Stop()
 
 	if err := db.Close(); err != nil {
 		log.Printf("db close: %v", err)
@@ -204,6 +234,14 @@ func Run() {
 	}
 }
 
+func docURL(slug string) string {
+	parts := strings.Split(slug, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/doc/" + strings.Join(parts, "/")
+}
+
 func resolveDocsRoot() string {
 	candidates := []string{
 		filepath.Clean(filepath.Join("..", "docs")),
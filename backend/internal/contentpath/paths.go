@@ -7,6 +7,7 @@ var (
 	PublishedRoot string
 	UnlistedRoot  string
 	DraftsRoot    string
+	TemplatesRoot string
 )
 
 func SetRoots(docsPath string) {
@@ -14,6 +15,7 @@ func SetRoots(docsPath string) {
 	PublishedRoot = filepath.Join(DocsRoot, "published")
 	UnlistedRoot = filepath.Join(DocsRoot, "unlisted")
 	DraftsRoot = filepath.Join(DocsRoot, "drafts")
+	TemplatesRoot = filepath.Join(DocsRoot, "templates")
 }
 
 
@@ -0,0 +1,138 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+)
+
+func withFrontMatterAlias(content, alias, current string) (string, bool) {
+	alias = cleanSlugParam(alias)
+	current = cleanSlugParam(current)
+	meta, _ := parseDocumentMetadata(content)
+	next := make([]string, 0, len(meta.Aliases)+1)
+	for _, existing := range meta.Aliases {
+		if existing != current && existing != alias {
+			next = append(next, existing)
+		}
+	}
+	if alias != "" && alias != current {
+		next = append(next, alias)
+	}
+	if len(next) == len(meta.Aliases) && (alias == "" || containsString(meta.Aliases, alias)) {
+		return content, false
+	}
+	if len(next) == 0 {
+		return removeFrontMatterField(content, "aliases")
+	}
+	return setFrontMatterValue(content, "aliases", next)
+}
+
+// recordDocumentAlias adds alias to the front matter of the document at
+// path, keeping the previous text in history like other rewrites.
+func recordDocumentAlias(db *sql.DB, user *auth.User, path, slug, alias string) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	updated, changed := withFrontMatterAlias(string(raw), alias, slug)
+	if !changed {
+		return
+	}
+	actor := "system"
+	if user != nil && strings.TrimSpace(user.Username) != "" {
+		actor = user.Username
+	}
+	recordHistory(db, slug, fmt.Sprintf("%s moved %s → %s", actor, alias, slug), raw)
+	if err := os.WriteFile(path, []byte(updated), 0o644); err != nil {
+		log.Printf("alias write %s: %v", slug, err)
+		return
+	}
+	meta, _ := parseDocumentMetadata(updated)
+	storeDocumentMetadata(db, meta.ID, meta)
+	linkHealth.update(path, meta.ID, slug, updated)
+	db.Exec(`UPDATE documents SET updated_at = ? WHERE doc_id = ?`, time.Now().UTC().Format(time.RFC3339), meta.ID)
+	db.Exec(`UPDATE documents_fts SET body = ? WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, expandEmbeds(db, meta.ID, updated), meta.ID)
+	syncDocumentAliases(db, meta.ID, slug, meta.Aliases)
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+func syncDocumentAliases(db *sql.DB, docID, slug string, aliases []string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	db.Exec(`DELETE FROM document_aliases WHERE doc_id = ?`, docID)
+	for _, alias := range aliases {
+		if alias == "" || alias == slug {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO document_aliases(alias,doc_id) VALUES(?,?)
+			ON CONFLICT(alias) DO UPDATE SET doc_id=excluded.doc_id`, alias, docID); err != nil {
+			log.Printf("alias insert %s: %v", alias, err)
+		}
+	}
+}
+
+func resolveSlugAlias(db *sql.DB, alias string) (string, string, bool) {
+	var slug, docID string
+	err := db.QueryRow(`SELECT d.slug,d.doc_id FROM document_aliases a JOIN documents d ON d.doc_id = a.doc_id WHERE a.alias = ?`, alias).Scan(&slug, &docID)
+	if err != nil || slug == "" || slug == alias {
+		return "", "", false
+	}
+	return slug, docID, true
+}
+
+func loadAliasTargets(db *sql.DB, aliases []string) map[string]string {
+	out := make(map[string]string)
+	if len(aliases) == 0 {
+		return out
+	}
+	args := make([]any, len(aliases))
+	for i, alias := range aliases {
+		args[i] = alias
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT alias,doc_id FROM document_aliases WHERE alias IN (%s)`, placeholders(len(aliases))), args...)
+	if err != nil {
+		log.Printf("load alias map: %v", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var alias, docID string
+		if err := rows.Scan(&alias, &docID); err == nil {
+			out[alias] = docID
+		}
+	}
+	return out
+}
+
+func ResolveSlugAlias(db *sql.DB, alias string) (string, bool) {
+	alias = cleanSlugParam(alias)
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM documents WHERE slug = ?`, alias).Scan(&count); err != nil || count > 0 {
+		return "", false
+	}
+	slug, _, ok := resolveSlugAlias(db, alias)
+	return slug, ok
+}
+
+func SlugForDocID(db *sql.DB, docID string) (string, bool) {
+	var slug string
+	if err := db.QueryRow(`SELECT slug FROM documents WHERE doc_id = ?`, strings.TrimSpace(docID)).Scan(&slug); err != nil || slug == "" {
+		return "", false
+	}
+	return slug, true
+}
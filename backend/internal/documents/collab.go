@@ -0,0 +1,531 @@
+package documents
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"atlas/internal/auth"
+	"atlas/internal/random"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	collabPersistInterval = 15 * time.Second
+	collabHistoryLimit    = 500
+	collabSendBuffer      = 256
+	collabReadLimit       = 4 << 20
+	collabWriteTimeout    = 10 * time.Second
+)
+
+type collabSelection struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+type collabPeer struct {
+	ClientID  string           `json:"client_id"`
+	User      string           `json:"user"`
+	Selection *collabSelection `json:"selection,omitempty"`
+}
+
+// collabMessage is the envelope for every message on a collaboration socket.
+// Clients send "op", "selection" and "resolve"; the server also sends "init",
+// "ack", "join", "leave", "saved", "conflict" and "error".
+type collabMessage struct {
+	Type      string           `json:"type"`
+	ClientID  string           `json:"client_id,omitempty"`
+	User      string           `json:"user,omitempty"`
+	Rev       int              `json:"rev"`
+	Op        textOp           `json:"op,omitempty"`
+	Selection *collabSelection `json:"selection,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	Clients   []collabPeer     `json:"clients,omitempty"`
+	Revision  string           `json:"revision,omitempty"`
+	Message   string           `json:"message,omitempty"`
+}
+
+type collabClient struct {
+	id        string
+	user      *auth.User
+	send      chan collabMessage
+	selection *collabSelection
+	close     context.CancelFunc
+}
+
+// collabSession holds the live text of one document. Operations are
+// transformed against the history the client has not seen, applied, and
+// broadcast; the text is written back through saveDocument. contributors
+// lists who edited since the last save. conflict holds an outside save that
+// could not be merged; nothing is saved until a client resolves it. gone is
+// set once the document has been moved or deleted under the session.
+type collabSession struct {
+	db           *sql.DB
+	slug         string
+	hub          bool
+	mu           sync.Mutex
+	text         []uint16
+	rev          int
+	history      []textOp
+	clients      map[*collabClient]struct{}
+	dirty        bool
+	savedFront   string
+	savedBody    string
+	contributors []*auth.User
+	conflict     *string
+	gone         bool
+	persistMu    sync.Mutex
+	stop         chan struct{}
+}
+
+type collabHub struct {
+	mu       sync.Mutex
+	sessions map[string]*collabSession
+}
+
+var collab = &collabHub{sessions: make(map[string]*collabSession)}
+
+func documentBody(content []byte) (front, body string) {
+	body = stripFrontMatter(string(content))
+	return string(content[:len(content)-len(body)]), body
+}
+
+func (h *collabHub) join(db *sql.DB, slug string, client *collabClient) (*collabSession, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session := h.sessions[slug]
+	if session == nil {
+		current, ok := currentDocumentContent(db, slug)
+		if !ok {
+			return nil, false
+		}
+		var path string
+		db.QueryRow(`SELECT path FROM documents WHERE slug = ?`, slug).Scan(&path)
+		front, body := documentBody(current)
+		session = &collabSession{
+			db:         db,
+			slug:       slug,
+			hub:        filepath.Base(path) == "_index.md",
+			text:       utf16.Encode([]rune(body)),
+			clients:    make(map[*collabClient]struct{}),
+			savedFront: front,
+			savedBody:  body,
+			stop:       make(chan struct{}),
+		}
+		h.sessions[slug] = session
+		go session.persistLoop()
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	peers := make([]collabPeer, 0, len(session.clients))
+	for other := range session.clients {
+		peers = append(peers, collabPeer{ClientID: other.id, User: other.user.Username, Selection: other.selection})
+		other.deliver(collabMessage{Type: "join", ClientID: client.id, User: client.user.Username, Rev: session.rev})
+	}
+	session.clients[client] = struct{}{}
+	client.deliver(collabMessage{
+		Type:     "init",
+		ClientID: client.id,
+		User:     client.user.Username,
+		Rev:      session.rev,
+		Content:  string(utf16.Decode(session.text)),
+		Clients:  peers,
+	})
+	return session, true
+}
+
+// leave removes client and, when it was the last one, saves pending text and
+// closes the session unless someone joined meanwhile. Text that cannot be
+// saved goes to the contributors' drafts.
+func (h *collabHub) leave(session *collabSession, client *collabClient) {
+	session.mu.Lock()
+	delete(session.clients, client)
+	close(client.send)
+	session.broadcast(collabMessage{Type: "leave", ClientID: client.id, User: client.user.Username, Rev: session.rev}, nil)
+	empty := len(session.clients) == 0
+	session.mu.Unlock()
+	if !empty {
+		return
+	}
+	session.persist()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if len(session.clients) == 0 && h.sessions[session.slug] == session {
+		delete(h.sessions, session.slug)
+		close(session.stop)
+		session.saveDraftsLocked()
+	}
+}
+
+// flush saves every session with unsaved changes, and writes text that
+// cannot be saved to the contributors' drafts.
+func (h *collabHub) flush() {
+	h.mu.Lock()
+	sessions := make([]*collabSession, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	h.mu.Unlock()
+	for _, session := range sessions {
+		session.persist()
+		session.mu.Lock()
+		session.saveDraftsLocked()
+		session.mu.Unlock()
+	}
+}
+
+// FlushCollaboration saves the text of open collaboration sessions, for use
+// during shutdown.
+func FlushCollaboration() {
+	collab.flush()
+}
+
+func (c *collabClient) deliver(msg collabMessage) {
+	select {
+	case c.send <- msg:
+	default:
+		log.Printf("collab: dropping slow client %s", c.id)
+		c.close()
+	}
+}
+
+func (s *collabSession) broadcast(msg collabMessage, except *collabClient) {
+	for client := range s.clients {
+		if client != except {
+			client.deliver(msg)
+		}
+	}
+}
+
+// concurrent returns the operations applied after rev, or false when rev is
+// no longer covered by the kept history.
+func (s *collabSession) concurrent(rev int) ([]textOp, bool) {
+	if rev > s.rev || s.rev-rev > len(s.history) {
+		return nil, false
+	}
+	return s.history[len(s.history)-(s.rev-rev):], true
+}
+
+func (s *collabSession) transformSelection(sel *collabSelection, ops []textOp) *collabSelection {
+	if sel == nil {
+		return nil
+	}
+	out := *sel
+	for _, op := range ops {
+		out.Anchor = transformIndex(out.Anchor, op)
+		out.Head = transformIndex(out.Head, op)
+	}
+	return &out
+}
+
+// applyLocked applies op as the next revision and moves every stored
+// selection across it.
+func (s *collabSession) applyLocked(op textOp) error {
+	text, err := op.apply(s.text)
+	if err != nil {
+		return err
+	}
+	s.text = text
+	s.rev++
+	s.history = append(s.history, op)
+	if len(s.history) > collabHistoryLimit {
+		s.history = append([]textOp(nil), s.history[len(s.history)-collabHistoryLimit:]...)
+	}
+	s.dirty = true
+	for client := range s.clients {
+		client.selection = s.transformSelection(client.selection, []textOp{op})
+	}
+	return nil
+}
+
+func (s *collabSession) receive(client *collabClient, msg collabMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ops, ok := s.concurrent(msg.Rev)
+	if !ok {
+		client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: "unknown revision, reconnect to resync"})
+		return
+	}
+	switch msg.Type {
+	case "op":
+		op := msg.Op
+		for _, other := range ops {
+			transformed, _, err := transformOps(op, other)
+			if err != nil {
+				client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: err.Error()})
+				return
+			}
+			op = transformed
+		}
+		if err := s.applyLocked(op); err != nil {
+			client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: err.Error()})
+			return
+		}
+		s.addContributor(client.user)
+		if msg.Selection != nil {
+			client.selection = s.transformSelection(msg.Selection, ops)
+		}
+		client.deliver(collabMessage{Type: "ack", Rev: s.rev})
+		s.broadcast(collabMessage{
+			Type:      "op",
+			ClientID:  client.id,
+			User:      client.user.Username,
+			Rev:       s.rev,
+			Op:        op,
+			Selection: client.selection,
+		}, client)
+	case "resolve":
+		s.resolve(client, msg)
+	case "selection":
+		client.selection = s.transformSelection(msg.Selection, ops)
+		s.broadcast(collabMessage{
+			Type:      "selection",
+			ClientID:  client.id,
+			User:      client.user.Username,
+			Rev:       s.rev,
+			Selection: client.selection,
+		}, client)
+	default:
+		client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: "unknown message type"})
+	}
+}
+
+func (s *collabSession) persistLoop() {
+	ticker := time.NewTicker(collabPersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.persist()
+		}
+	}
+}
+
+func (s *collabSession) addContributor(u *auth.User) {
+	for _, known := range s.contributors {
+		if known.ID == u.ID {
+			return
+		}
+	}
+	s.contributors = append(s.contributors, u)
+}
+
+// resolve replaces the session text with the content a client settled on
+// after a conflict. The outside save it was resolved against becomes the
+// base of the next save.
+func (s *collabSession) resolve(client *collabClient, msg collabMessage) {
+	if s.conflict == nil {
+		client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: "nothing to resolve"})
+		return
+	}
+	if msg.Rev != s.rev {
+		client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: "the text changed, resolve against the latest revision"})
+		return
+	}
+	op := diffOp(string(utf16.Decode(s.text)), msg.Content)
+	if err := s.applyLocked(op); err != nil {
+		client.deliver(collabMessage{Type: "error", Rev: s.rev, Message: err.Error()})
+		return
+	}
+	s.savedBody = *s.conflict
+	s.conflict = nil
+	s.addContributor(client.user)
+	client.deliver(collabMessage{Type: "ack", Rev: s.rev})
+	s.broadcast(collabMessage{Type: "op", ClientID: client.id, User: client.user.Username, Rev: s.rev, Op: op}, client)
+}
+
+// collabNote is the history note for a save of edits by users.
+func collabNote(users []*auth.User) string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Username
+	}
+	return strings.Join(names, ", ") + " edited live"
+}
+
+// persist saves the session text through saveDocument. Changes saved outside
+// the session since the last persist are merged in first and sent to the
+// clients as a server operation. When they conflict nothing is saved: the
+// clients get the outside version in a "conflict" message and one of them has
+// to send the resolved text.
+func (s *collabSession) persist() {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty || s.conflict != nil || s.gone {
+		s.mu.Unlock()
+		return
+	}
+	current, ok := currentDocumentContent(s.db, s.slug)
+	if !ok {
+		s.gone = true
+		s.broadcast(collabMessage{Type: "error", Rev: s.rev, Message: "the document no longer exists"}, nil)
+		s.mu.Unlock()
+		return
+	}
+	front, currentBody := documentBody(current)
+	text := string(utf16.Decode(s.text))
+	if currentBody != s.savedBody {
+		merged := mergeThreeWay(s.savedBody, text, currentBody)
+		if len(merged.Conflicts) > 0 {
+			s.conflict = &currentBody
+			s.broadcast(collabMessage{
+				Type:     "conflict",
+				Rev:      s.rev,
+				Content:  currentBody,
+				Revision: documentETag(current),
+				Message:  "the document was changed outside this session",
+			}, nil)
+			s.mu.Unlock()
+			return
+		}
+		if merged.Merged != text {
+			op := diffOp(text, merged.Merged)
+			if err := s.applyLocked(op); err == nil {
+				text = merged.Merged
+				s.broadcast(collabMessage{Type: "op", Rev: s.rev, Op: op}, nil)
+			}
+		}
+	}
+	contributors := s.contributors
+	s.contributors = nil
+	s.dirty = false
+	rev := s.rev
+	s.mu.Unlock()
+
+	if len(contributors) == 0 {
+		return
+	}
+	user := contributors[len(contributors)-1]
+	res, err := saveDocument(context.Background(), s.db, user, s.slug, []byte(front+text), saveOptions{Note: collabNote(contributors)})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		for _, u := range contributors {
+			s.addContributor(u)
+		}
+		s.dirty = true
+	}
+	var se *saveError
+	switch {
+	case err == nil && res.Proposal != nil:
+		s.broadcast(collabMessage{Type: "saved", Rev: rev, Message: "changes submitted for review"}, nil)
+	case err == nil:
+		s.savedFront = front
+		s.savedBody = text
+		s.broadcast(collabMessage{Type: "saved", Rev: rev, Revision: res.Revision}, nil)
+	case errors.As(err, &se) && se.status == http.StatusLocked:
+		s.broadcast(collabMessage{Type: "error", Rev: s.rev, Message: "document is locked by another user"}, nil)
+	default:
+		log.Printf("collab: save %s: %v", s.slug, err)
+		s.broadcast(collabMessage{Type: "error", Rev: s.rev, Message: "save failed"}, nil)
+	}
+}
+
+// saveDraftsLocked writes the session text to each contributor's draft when
+// it could not be saved to the document, because an outside save conflicts
+// with it or the document is gone. The last saved version becomes the
+// draft's base, so publishing the draft merges the outside changes.
+func (s *collabSession) saveDraftsLocked() {
+	if !s.dirty || s.conflict == nil && !s.gone {
+		return
+	}
+	base := s.savedFront + s.savedBody
+	meta, _ := parseDocumentMetadata(base)
+	content := []byte(s.savedFront + string(utf16.Decode(s.text)))
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, u := range s.contributors {
+		path, isFolder, err := draftPathFromSlug(u.Username, s.slug, s.hub)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(path, content, 0o644)
+		}
+		if err == nil {
+			s.db.Exec(`INSERT OR IGNORE INTO draft_bases(user_id,slug,doc_id,base_hash,content,created_at) VALUES(?,?,?,?,?,?)`,
+				u.ID, s.slug, meta.ID, contentHash([]byte(base)), base, now)
+			err = indexDraft(s.db, u, s.slug, path, isFolder, content)
+		}
+		if err != nil {
+			log.Printf("collab: draft %s for %s: %v", s.slug, u.Username, err)
+		}
+	}
+	s.contributors = nil
+	s.dirty = false
+}
+
+func documentCollabHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		u := auth.UserFromContext(r)
+		if _, ok := currentDocumentContent(db, slug); !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !checkDocumentLock(w, r, db, slug, false) {
+			return
+		}
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(collabReadLimit)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		client := &collabClient{
+			id:    random.GenerateToken(8),
+			user:  u,
+			send:  make(chan collabMessage, collabSendBuffer),
+			close: cancel,
+		}
+		session, ok := collab.join(db, slug, client)
+		if !ok {
+			conn.Close(websocket.StatusPolicyViolation, "not found")
+			return
+		}
+		go func() {
+			defer cancel()
+			for msg := range client.send {
+				writeCtx, done := context.WithTimeout(ctx, collabWriteTimeout)
+				err := wsjson.Write(writeCtx, conn, msg)
+				done()
+				if err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			var msg collabMessage
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				break
+			}
+			session.receive(client, msg)
+		}
+		collab.leave(session, client)
+		conn.Close(websocket.StatusNormalClosure, "")
+	}
+}
@@ -0,0 +1,673 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"atlas/internal/auth"
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	commentContextUnits = 32
+	maxCommentLength    = 10000
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9][A-Za-z0-9_.-]*)`)
+
+// commentAnchor ties a thread to a heading or to a quoted range of the
+// document body. Start and End are UTF-16 offsets, as used by browsers.
+type commentAnchor struct {
+	Heading  string `json:"heading,omitempty"`
+	Quote    string `json:"quote,omitempty"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Orphaned bool   `json:"orphaned,omitempty"`
+	prefix   string
+	suffix   string
+}
+
+type comment struct {
+	ID        int64    `json:"id"`
+	ThreadID  int64    `json:"thread_id"`
+	Author    string   `json:"author"`
+	Body      string   `json:"body"`
+	Mentions  []string `json:"mentions,omitempty"`
+	CreatedAt string   `json:"created_at"`
+	EditedAt  string   `json:"edited_at,omitempty"`
+	authorID  int
+}
+
+type commentThread struct {
+	ID         int64          `json:"id"`
+	DocID      string         `json:"doc_id"`
+	Slug       string         `json:"slug"`
+	Anchor     *commentAnchor `json:"anchor,omitempty"`
+	Status     string         `json:"status"`
+	Author     string         `json:"author"`
+	ResolvedBy string         `json:"resolved_by,omitempty"`
+	ResolvedAt string         `json:"resolved_at,omitempty"`
+	CreatedAt  string         `json:"created_at"`
+	UpdatedAt  string         `json:"updated_at"`
+	Comments   []comment      `json:"comments"`
+}
+
+type commentRequest struct {
+	Body   string         `json:"body"`
+	Anchor *commentAnchor `json:"anchor"`
+}
+
+const commentThreadColumns = `t.id,t.doc_id,COALESCE(d.slug,''),COALESCE(t.heading,''),COALESCE(t.quote,''),COALESCE(t.prefix,''),COALESCE(t.suffix,''),
+	COALESCE(t.anchor_start,0),COALESCE(t.anchor_end,0),t.orphaned,t.status,COALESCE(t.author,''),COALESCE(t.resolved_by,''),COALESCE(t.resolved_at,''),
+	COALESCE(t.created_at,''),COALESCE(t.updated_at,'')`
+
+func scanCommentThread(scan func(...any) error) (commentThread, error) {
+	var thread commentThread
+	var anchor commentAnchor
+	var orphaned int
+	err := scan(&thread.ID, &thread.DocID, &thread.Slug, &anchor.Heading, &anchor.Quote, &anchor.prefix, &anchor.suffix,
+		&anchor.Start, &anchor.End, &orphaned, &thread.Status, &thread.Author, &thread.ResolvedBy, &thread.ResolvedAt,
+		&thread.CreatedAt, &thread.UpdatedAt)
+	if err != nil {
+		return thread, err
+	}
+	anchor.Orphaned = orphaned != 0
+	if anchor.Heading != "" || anchor.Quote != "" {
+		thread.Anchor = &anchor
+	}
+	thread.Comments = []comment{}
+	return thread, nil
+}
+
+// queryCommentThreads loads the threads matching where, then their comments.
+func queryCommentThreads(db *sql.DB, where string, args ...any) ([]commentThread, error) {
+	rows, err := db.Query(`SELECT `+commentThreadColumns+` FROM comment_threads t LEFT JOIN documents d ON d.doc_id = t.doc_id WHERE `+where+` ORDER BY t.created_at, t.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	threads := []commentThread{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		thread, err := scanCommentThread(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[thread.ID] = len(threads)
+		threads = append(threads, thread)
+	}
+	rows.Close()
+	if len(threads) == 0 {
+		return threads, nil
+	}
+	ids := make([]any, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.ID)
+	}
+	rows, err = db.Query(`SELECT id,thread_id,COALESCE(author_id,0),COALESCE(author,''),body,COALESCE(mentions,''),COALESCE(created_at,''),COALESCE(edited_at,'')
+		FROM comments WHERE thread_id IN (`+placeholders(len(ids))+`) ORDER BY created_at, id`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c comment
+		var mentions string
+		if err := rows.Scan(&c.ID, &c.ThreadID, &c.authorID, &c.Author, &c.Body, &mentions, &c.CreatedAt, &c.EditedAt); err != nil {
+			return nil, err
+		}
+		c.Mentions = stringListFromJSON(mentions)
+		if i, ok := index[c.ThreadID]; ok {
+			threads[i].Comments = append(threads[i].Comments, c)
+		}
+	}
+	return threads, rows.Err()
+}
+
+func loadCommentThread(db *sql.DB, id int64) (commentThread, error) {
+	threads, err := queryCommentThreads(db, `t.id = ?`, id)
+	if err != nil {
+		return commentThread{}, err
+	}
+	if len(threads) == 0 {
+		return commentThread{}, sql.ErrNoRows
+	}
+	return threads[0], nil
+}
+
+func commentStatusFilter(r *http.Request) (string, bool) {
+	switch status := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("status"))); status {
+	case "", "all":
+		return "", true
+	case "open", "resolved":
+		return status, true
+	default:
+		return "", false
+	}
+}
+
+// extractMentions returns the known users mentioned in body, in the order
+// they first appear.
+func extractMentions(db *sql.DB, body string) []string {
+	var out []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		candidate := strings.TrimRight(m[1], ".-")
+		var username string
+		if db.QueryRow(`SELECT username FROM users WHERE lower(username) = lower(?)`, candidate).Scan(&username) != nil {
+			continue
+		}
+		if !containsString(out, username) {
+			out = append(out, username)
+		}
+	}
+	return out
+}
+
+func insertComment(db *sql.DB, threadID int64, u *auth.User, body string, now string) (comment, error) {
+	c := comment{ThreadID: threadID, Author: u.Username, Body: body, Mentions: extractMentions(db, body), CreatedAt: now, authorID: u.ID}
+	mentions, _ := json.Marshal(c.Mentions)
+	res, err := db.Exec(`INSERT INTO comments(thread_id,author_id,author,body,mentions,created_at) VALUES(?,?,?,?,?,?)`,
+		threadID, u.ID, u.Username, body, string(mentions), now)
+	if err != nil {
+		return c, err
+	}
+	c.ID, _ = res.LastInsertId()
+	return c, nil
+}
+
+func decodeCommentRequest(w http.ResponseWriter, r *http.Request) (commentRequest, bool) {
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		docErr(w, http.StatusBadRequest, "invalid request")
+		return req, false
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		docErr(w, http.StatusBadRequest, "comment body required")
+		return req, false
+	}
+	if len(req.Body) > maxCommentLength {
+		docErr(w, http.StatusBadRequest, "comment too long")
+		return req, false
+	}
+	return req, true
+}
+
+func publishCommentEvent(r *http.Request, thread commentThread, action string, c *comment) {
+	data := map[string]any{"thread_id": thread.ID, "doc_id": thread.DocID, "action": action}
+	if c != nil {
+		data["comment_id"] = c.ID
+		if len(c.Mentions) > 0 {
+			data["mentions"] = c.Mentions
+		}
+	}
+	events.Publish(events.DocumentComment, thread.Slug, actorName(r), data)
+}
+
+func canEditComment(u *auth.User, authorID int) bool {
+	return u != nil && (u.ID == authorID || u.Role == "Admin" || u.Role == "Owner")
+}
+
+func commentIDParam(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+func listDocumentCommentsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		status, ok := commentStatusFilter(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		where, args := `t.doc_id = ?`, []any{docID}
+		if status != "" {
+			where, args = where+` AND t.status = ?`, append(args, status)
+		}
+		threads, err := queryCommentThreads(db, where, args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, threads)
+	}
+}
+
+// listCommentsHandler lists threads across documents. With ?mentioned=1 it
+// only returns threads that mention the caller.
+func listCommentsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, ok := commentStatusFilter(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		where, args := `d.doc_id IS NOT NULL`, []any{}
+		if status != "" {
+			where, args = where+` AND t.status = ?`, append(args, status)
+		}
+		if mentioned := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("mentioned"))); mentioned == "1" || mentioned == "true" {
+			u := auth.UserFromContext(r)
+			mention, _ := json.Marshal(u.Username)
+			where += ` AND EXISTS (SELECT 1 FROM comments c WHERE c.thread_id = t.id AND c.mentions LIKE ?)`
+			args = append(args, "%"+string(mention)+"%")
+		}
+		threads, err := queryCommentThreads(db, where, args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, threads)
+	}
+}
+
+func createCommentThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		req, ok := decodeCommentRequest(w, r)
+		if !ok {
+			return
+		}
+		var anchor commentAnchor
+		if req.Anchor != nil {
+			content, _ := currentDocumentContent(db, slug)
+			located, ok := placeAnchor(*req.Anchor, stripFrontMatter(string(content)))
+			if !ok {
+				docErr(w, http.StatusBadRequest, "anchor not found in document")
+				return
+			}
+			anchor = located
+		}
+		u := auth.UserFromContext(r)
+		now := time.Now().UTC().Format(time.RFC3339)
+		res, err := db.Exec(`INSERT INTO comment_threads(doc_id,heading,quote,prefix,suffix,anchor_start,anchor_end,status,author_id,author,created_at,updated_at)
+			VALUES(?,?,?,?,?,?,?,'open',?,?,?,?)`,
+			docID, anchor.Heading, anchor.Quote, anchor.prefix, anchor.suffix, anchor.Start, anchor.End, u.ID, u.Username, now, now)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		threadID, _ := res.LastInsertId()
+		c, err := insertComment(db, threadID, u, req.Body, now)
+		if err != nil {
+			db.Exec(`DELETE FROM comment_threads WHERE id = ?`, threadID)
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		thread, err := loadCommentThread(db, threadID)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		publishCommentEvent(r, thread, "created", &c)
+		httpx.WriteJSON(w, http.StatusCreated, thread)
+	}
+}
+
+func replyCommentThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := commentIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		thread, err := loadCommentThread(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		req, ok := decodeCommentRequest(w, r)
+		if !ok {
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		c, err := insertComment(db, thread.ID, auth.UserFromContext(r), req.Body, now)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		db.Exec(`UPDATE comment_threads SET updated_at = ? WHERE id = ?`, now, thread.ID)
+		publishCommentEvent(r, thread, "replied", &c)
+		httpx.WriteJSON(w, http.StatusCreated, c)
+	}
+}
+
+func resolveCommentThreadHandler(db *sql.DB, resolved bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := commentIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		thread, err := loadCommentThread(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		action := "reopened"
+		if resolved {
+			action = "resolved"
+			_, err = db.Exec(`UPDATE comment_threads SET status = 'resolved', resolved_by = ?, resolved_at = ?, updated_at = ? WHERE id = ?`, actorName(r), now, now, id)
+		} else {
+			_, err = db.Exec(`UPDATE comment_threads SET status = 'open', resolved_by = NULL, resolved_at = NULL, updated_at = ? WHERE id = ?`, now, id)
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		if thread, err = loadCommentThread(db, id); err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		publishCommentEvent(r, thread, action, nil)
+		httpx.WriteJSON(w, http.StatusOK, thread)
+	}
+}
+
+func deleteCommentThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := commentIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		thread, err := loadCommentThread(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		u := auth.UserFromContext(r)
+		for _, c := range thread.Comments {
+			if !canEditComment(u, c.authorID) {
+				docErr(w, http.StatusForbidden, "thread has replies from other users")
+				return
+			}
+		}
+		db.Exec(`DELETE FROM comments WHERE thread_id = ?`, id)
+		db.Exec(`DELETE FROM comment_threads WHERE id = ?`, id)
+		publishCommentEvent(r, thread, "deleted", nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func loadComment(db *sql.DB, id int64) (comment, error) {
+	var c comment
+	var mentions string
+	err := db.QueryRow(`SELECT id,thread_id,COALESCE(author_id,0),COALESCE(author,''),body,COALESCE(mentions,''),COALESCE(created_at,''),COALESCE(edited_at,'') FROM comments WHERE id = ?`, id).
+		Scan(&c.ID, &c.ThreadID, &c.authorID, &c.Author, &c.Body, &mentions, &c.CreatedAt, &c.EditedAt)
+	c.Mentions = stringListFromJSON(mentions)
+	return c, err
+}
+
+func editCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := commentIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		c, err := loadComment(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !canEditComment(auth.UserFromContext(r), c.authorID) {
+			docErr(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		req, ok := decodeCommentRequest(w, r)
+		if !ok {
+			return
+		}
+		previous := c.Mentions
+		c.Body = req.Body
+		c.Mentions = extractMentions(db, req.Body)
+		c.EditedAt = time.Now().UTC().Format(time.RFC3339)
+		mentions, _ := json.Marshal(c.Mentions)
+		if _, err := db.Exec(`UPDATE comments SET body = ?, mentions = ?, edited_at = ? WHERE id = ?`, c.Body, string(mentions), c.EditedAt, id); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		if thread, err := loadCommentThread(db, c.ThreadID); err == nil {
+			added := c
+			added.Mentions = nil
+			for _, name := range c.Mentions {
+				if !containsString(previous, name) {
+					added.Mentions = append(added.Mentions, name)
+				}
+			}
+			publishCommentEvent(r, thread, "edited", &added)
+		}
+		httpx.WriteJSON(w, http.StatusOK, c)
+	}
+}
+
+// deleteCommentHandler removes one comment. Removing the last comment of a
+// thread removes the thread.
+func deleteCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := commentIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		c, err := loadComment(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !canEditComment(auth.UserFromContext(r), c.authorID) {
+			docErr(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		thread, err := loadCommentThread(db, c.ThreadID)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		db.Exec(`DELETE FROM comments WHERE id = ?`, id)
+		action := "comment_deleted"
+		if len(thread.Comments) <= 1 {
+			db.Exec(`DELETE FROM comment_threads WHERE id = ?`, thread.ID)
+			action = "deleted"
+		}
+		publishCommentEvent(r, thread, action, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func deleteDocumentComments(db *sql.DB, docID string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	db.Exec(`DELETE FROM comments WHERE thread_id IN (SELECT id FROM comment_threads WHERE doc_id = ?)`, docID)
+	db.Exec(`DELETE FROM comment_threads WHERE doc_id = ?`, docID)
+}
+
+func indexUnits(text, pattern []uint16, from int) int {
+	for i := from; i+len(pattern) <= len(text); i++ {
+		match := true
+		for j := range pattern {
+			if text[i+j] != pattern[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// nearestUnits finds the occurrence of pattern closest to near.
+func nearestUnits(text, pattern []uint16, near int) int {
+	best := -1
+	for i := indexUnits(text, pattern, 0); i >= 0; i = indexUnits(text, pattern, i+1) {
+		if best < 0 || abs(i-near) < abs(best-near) {
+			best = i
+		}
+		if i > near {
+			break
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func headingForAnchor(headings []docHeading, heading string) (docHeading, bool) {
+	for _, h := range headings {
+		if h.Anchor == heading {
+			return h, true
+		}
+	}
+	for _, h := range headings {
+		if strings.EqualFold(h.Text, heading) {
+			return h, true
+		}
+	}
+	return docHeading{}, false
+}
+
+// headingAt returns the anchor of the last heading at or above offset.
+func headingAt(headings []docHeading, text []uint16, offset int) string {
+	line := 1
+	for _, u := range text[:offset] {
+		if u == '\n' {
+			line++
+		}
+	}
+	anchor := ""
+	for _, h := range headings {
+		if h.Line > line {
+			break
+		}
+		anchor = h.Anchor
+	}
+	return anchor
+}
+
+// placeAnchor resolves a requested anchor against body. A quote is looked up
+// near the requested start, and its surrounding text is kept so the range
+// can be found again after edits.
+func placeAnchor(req commentAnchor, body string) (commentAnchor, bool) {
+	text := utf16.Encode([]rune(body))
+	headings := documentHeadings(body)
+	quote := utf16.Encode([]rune(req.Quote))
+	if len(quote) == 0 {
+		if req.Heading == "" {
+			return commentAnchor{}, false
+		}
+		h, ok := headingForAnchor(headings, req.Heading)
+		return commentAnchor{Heading: h.Anchor}, ok
+	}
+	start := nearestUnits(text, quote, req.Start)
+	if start < 0 {
+		return commentAnchor{}, false
+	}
+	return anchorAt(text, headings, start, start+len(quote)), true
+}
+
+func anchorAt(text []uint16, headings []docHeading, start, end int) commentAnchor {
+	before := max(0, start-commentContextUnits)
+	after := min(len(text), end+commentContextUnits)
+	return commentAnchor{
+		Heading: headingAt(headings, text, start),
+		Quote:   string(utf16.Decode(text[start:end])),
+		Start:   start,
+		End:     end,
+		prefix:  string(utf16.Decode(text[before:start])),
+		suffix:  string(utf16.Decode(text[end:after])),
+	}
+}
+
+// relocateAnchor finds a stored anchor in the edited body. The quote is
+// searched near its old position; when it was itself edited, the text that
+// surrounded it brackets the new range.
+func relocateAnchor(old commentAnchor, text []uint16, headings []docHeading) commentAnchor {
+	quote := utf16.Encode([]rune(old.Quote))
+	if len(quote) == 0 {
+		h, ok := headingForAnchor(headings, old.Heading)
+		if !ok {
+			old.Orphaned = true
+			return old
+		}
+		return commentAnchor{Heading: h.Anchor}
+	}
+	if start := nearestUnits(text, quote, old.Start); start >= 0 {
+		return anchorAt(text, headings, start, start+len(quote))
+	}
+	prefix := utf16.Encode([]rune(old.prefix))
+	suffix := utf16.Encode([]rune(old.suffix))
+	for size := commentContextUnits; size >= commentContextUnits/4; size /= 2 {
+		p := prefix[max(0, len(prefix)-size):]
+		s := suffix[:min(len(suffix), size)]
+		if len(p) == 0 || len(s) == 0 {
+			break
+		}
+		at := nearestUnits(text, p, old.Start-len(p))
+		if at < 0 {
+			continue
+		}
+		start := at + len(p)
+		if end := indexUnits(text, s, start); end > start && end-start <= 2*len(quote)+commentContextUnits {
+			return anchorAt(text, headings, start, end)
+		}
+	}
+	old.Orphaned = true
+	return old
+}
+
+// reanchorComments moves the anchors of docID's threads onto body after an
+// edit, flagging the ones that can no longer be found.
+func reanchorComments(db *sql.DB, docID, body string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	threads, err := queryCommentThreads(db, `t.doc_id = ? AND (COALESCE(t.quote,'') != '' OR COALESCE(t.heading,'') != '')`, docID)
+	if err != nil || len(threads) == 0 {
+		return
+	}
+	text := utf16.Encode([]rune(body))
+	headings := documentHeadings(body)
+	for _, thread := range threads {
+		old := *thread.Anchor
+		next := relocateAnchor(old, text, headings)
+		if next == old {
+			continue
+		}
+		orphaned := 0
+		if next.Orphaned {
+			orphaned = 1
+		}
+		db.Exec(`UPDATE comment_threads SET heading = ?, quote = ?, prefix = ?, suffix = ?, anchor_start = ?, anchor_end = ?, orphaned = ? WHERE id = ?`,
+			next.Heading, next.Quote, next.prefix, next.suffix, next.Start, next.End, orphaned, thread.ID)
+	}
+}
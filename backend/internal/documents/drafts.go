@@ -25,6 +25,8 @@ type draftNode struct {
 	ParentSlug string `json:"parent_slug"`
 	UpdatedAt  string `json:"updated_at"`
 	IsFolder   bool   `json:"is_folder"`
+	Owner      string `json:"owner,omitempty"`
+	Access     string `json:"access,omitempty"`
 }
 
 func draftsTreeHandler(db *sql.DB) http.HandlerFunc {
@@ -65,11 +67,84 @@ func draftsTreeHandler(db *sql.DB) http.HandlerFunc {
 			}
 			out = append(out, row)
 		}
+		rows.Close()
+
+		shared, err := sharedDraftNodes(db, u.ID)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		out = append(out, shared...)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(out)
 	}
 }
 
+func sharedDraftNodes(db *sql.DB, userID int) ([]draftNode, error) {
+	rows, err := db.Query(
+		`SELECT d.slug,d.title,d.parent_slug,d.updated_at,d.is_folder,u.username,s.mode
+		 FROM draft_shares s
+		 JOIN user_drafts d ON d.user_id = s.owner_id AND d.slug = s.slug
+		 JOIN users u ON u.id = s.owner_id
+		 WHERE s.user_id = ? ORDER BY u.username, d.slug`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []draftNode
+	for rows.Next() {
+		var row draftNode
+		var title, parent, updated sql.NullString
+		var isFolder int
+		if err := rows.Scan(&row.Slug, &title, &parent, &updated, &isFolder, &row.Owner, &row.Access); err != nil {
+			return nil, err
+		}
+		row.Title = title.String
+		row.ParentSlug = parent.String
+		row.UpdatedAt = updated.String
+		row.IsFolder = isFolder != 0
+		row.Status = "draft"
+		if row.Title == "" {
+			row.Title = humanizeSlug(row.Slug)
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// draftOwner resolves whose draft a request addresses. Without an owner query
+// parameter it is the caller's own draft; otherwise the owner must have shared
+// the draft with the caller, for co-editing when edit is set.
+func draftOwner(db *sql.DB, w http.ResponseWriter, r *http.Request, u *auth.User, slug string, edit bool) (*auth.User, bool) {
+	name := strings.TrimSpace(r.URL.Query().Get("owner"))
+	if name == "" || name == u.Username {
+		return u, true
+	}
+	owner := &auth.User{Username: name}
+	var mode string
+	err := db.QueryRow(
+		`SELECT u.id,u.role,s.mode FROM draft_shares s JOIN users u ON u.id = s.owner_id WHERE u.username = ? AND s.slug = ? AND s.user_id = ?`,
+		name,
+		slug,
+		u.ID,
+	).Scan(&owner.ID, &owner.Role, &mode)
+	if err == sql.ErrNoRows {
+		docErr(w, http.StatusNotFound, "not found")
+		return nil, false
+	}
+	if err != nil {
+		docErr(w, http.StatusInternalServerError, "query error")
+		return nil, false
+	}
+	if edit && mode != "edit" {
+		httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "draft is shared read-only")
+		return nil, false
+	}
+	return owner, true
+}
+
 func draftDetailHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		u := auth.UserFromContext(r)
@@ -82,6 +157,10 @@ func draftDetailHandler(db *sql.DB) http.HandlerFunc {
 			docErr(w, http.StatusBadRequest, "missing slug")
 			return
 		}
+		owner, ok := draftOwner(db, w, r, u, slug, false)
+		if !ok {
+			return
+		}
 
 		var title sql.NullString
 		var path string
@@ -90,7 +169,7 @@ func draftDetailHandler(db *sql.DB) http.HandlerFunc {
 		var isFolder int
 		err := db.QueryRow(
 			`SELECT title,path,parent_slug,updated_at,is_folder FROM user_drafts WHERE user_id = ? AND slug = ?`,
-			u.ID,
+			owner.ID,
 			slug,
 		).Scan(&title, &path, &parent, &updated, &isFolder)
 		if err != nil {
@@ -112,7 +191,7 @@ func draftDetailHandler(db *sql.DB) http.HandlerFunc {
 			Slug:       slug,
 			Title:      strings.TrimSpace(title.String),
 			Status:     "draft",
-			Owner:      u.Username,
+			Owner:      owner.Username,
 			UpdatedAt:  updated.String,
 			ParentSlug: parent.String,
 			Content:    body,
@@ -132,6 +211,12 @@ func draftDetailHandler(db *sql.DB) http.HandlerFunc {
 		if resp.DocID == "" {
 			resp.DocID = meta.ID
 		}
+		if base, ok := loadDraftBase(db, owner.ID, slug); ok {
+			resp.BaseHash = base.hash
+			if current, exists := currentDocumentContent(db, slug); exists {
+				resp.Stale = contentHash(current) != base.hash
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
@@ -150,9 +235,17 @@ func draftSaveHandler(db *sql.DB) http.HandlerFunc {
 			docErr(w, http.StatusBadRequest, "missing slug")
 			return
 		}
+		owner, ok := draftOwner(db, w, r, u, slug, true)
+		if !ok {
+			return
+		}
 		renameRaw := strings.TrimSpace(r.URL.Query().Get("rename_to"))
 		renameTo := ""
 		renameIndex := false
+		if renameRaw != "" && owner != u {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "only the owner can rename a draft")
+			return
+		}
 		if renameRaw != "" {
 			renameTo, renameIndex = slugParamInfo(renameRaw)
 			if renameTo == "" {
@@ -177,7 +270,7 @@ func draftSaveHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		path, isFolder, err := draftPathFromSlug(u.Username, targetSlug, targetIndex)
+		path, isFolder, err := draftPathFromSlug(owner.Username, targetSlug, targetIndex)
 		if err != nil {
 			docErr(w, http.StatusBadRequest, "invalid slug")
 			return
@@ -187,7 +280,7 @@ func draftSaveHandler(db *sql.DB) http.HandlerFunc {
 			var exists int
 			if err := db.QueryRow(
 				`SELECT COUNT(1) FROM user_drafts WHERE user_id = ? AND slug = ?`,
-				u.ID,
+				owner.ID,
 				renameTo,
 			).Scan(&exists); err != nil {
 				docErr(w, http.StatusInternalServerError, "query error")
@@ -209,32 +302,16 @@ func draftSaveHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		if renameTo != "" && renameTo != slug {
-			if oldPath, _, err := draftPathFromSlug(u.Username, slug, explicitIndex); err == nil && oldPath != path {
+			if oldPath, _, err := draftPathFromSlug(owner.Username, slug, explicitIndex); err == nil && oldPath != path {
 				_ = os.Remove(oldPath)
-				cleanupDraftDirs(oldPath, u.Username)
+				cleanupDraftDirs(oldPath, owner.Username)
 			}
-			db.Exec(`DELETE FROM user_drafts WHERE user_id = ? AND slug = ?`, u.ID, slug)
+			db.Exec(`DELETE FROM user_drafts WHERE user_id = ? AND slug = ?`, owner.ID, slug)
+			db.Exec(`UPDATE draft_shares SET slug = ? WHERE owner_id = ? AND slug = ?`, renameTo, owner.ID, slug)
+			db.Exec(`UPDATE draft_bases SET slug = ? WHERE user_id = ? AND slug = ?`, renameTo, owner.ID, slug)
 		}
 
-		now := time.Now().UTC().Format(time.RFC3339)
-		title := extractTitle(string(body))
-		parent := parentSlug(targetSlug)
-		var parentVal sql.NullString
-		if parent != "" {
-			parentVal = sql.NullString{String: parent, Valid: true}
-		}
-		if _, err := db.Exec(
-			`INSERT INTO user_drafts(user_id,slug,title,path,parent_slug,updated_at,is_folder)
-			 VALUES(?,?,?,?,?,?,?)
-			 ON CONFLICT(user_id, slug) DO UPDATE SET title=excluded.title, path=excluded.path, parent_slug=excluded.parent_slug, updated_at=excluded.updated_at, is_folder=excluded.is_folder`,
-			u.ID,
-			targetSlug,
-			title,
-			path,
-			parentVal,
-			now,
-			boolToInt(isFolder),
-		); err != nil {
+		if err := indexDraft(db, owner, targetSlug, path, isFolder, body); err != nil {
 			docErr(w, http.StatusInternalServerError, "db update failed")
 			return
 		}
@@ -244,6 +321,34 @@ func draftSaveHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// indexDraft records the draft file written at path in user_drafts and
+// remembers the document revision it started from.
+func indexDraft(db *sql.DB, owner *auth.User, slug, path string, isFolder bool, body []byte) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	title := extractTitle(string(body))
+	parent := parentSlug(slug)
+	var parentVal sql.NullString
+	if parent != "" {
+		parentVal = sql.NullString{String: parent, Valid: true}
+	}
+	if _, err := db.Exec(
+		`INSERT INTO user_drafts(user_id,slug,title,path,parent_slug,updated_at,is_folder)
+		 VALUES(?,?,?,?,?,?,?)
+		 ON CONFLICT(user_id, slug) DO UPDATE SET title=excluded.title, path=excluded.path, parent_slug=excluded.parent_slug, updated_at=excluded.updated_at, is_folder=excluded.is_folder`,
+		owner.ID,
+		slug,
+		title,
+		path,
+		parentVal,
+		now,
+		boolToInt(isFolder),
+	); err != nil {
+		return err
+	}
+	recordDraftBase(db, owner.ID, slug, string(body))
+	return nil
+}
+
 func draftDeleteHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		u := auth.UserFromContext(r)
@@ -272,6 +377,8 @@ func draftDeleteHandler(db *sql.DB) http.HandlerFunc {
 		_ = os.Remove(path)
 		cleanupDraftDirs(path, u.Username)
 		db.Exec(`DELETE FROM user_drafts WHERE user_id = ? AND slug = ?`, u.ID, slug)
+		db.Exec(`DELETE FROM draft_shares WHERE owner_id = ? AND slug = ?`, u.ID, slug)
+		db.Exec(`DELETE FROM draft_bases WHERE user_id = ? AND slug = ?`, u.ID, slug)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -291,6 +398,8 @@ func clearUserDraftBySlug(db *sql.DB, user *auth.User, slug string) {
 	_ = os.Remove(path)
 	cleanupDraftDirs(path, user.Username)
 	db.Exec(`DELETE FROM user_drafts WHERE user_id = ? AND slug = ?`, user.ID, slug)
+	db.Exec(`DELETE FROM draft_shares WHERE owner_id = ? AND slug = ?`, user.ID, slug)
+	db.Exec(`DELETE FROM draft_bases WHERE user_id = ? AND slug = ?`, user.ID, slug)
 }
 
 func draftPathFromSlug(username, slug string, preferIndex bool) (string, bool, error) {
@@ -402,3 +511,239 @@ func boolToInt(v bool) int {
 	}
 	return 0
 }
+
+type draftShareRow struct {
+	Username  string `json:"username"`
+	Mode      string `json:"mode"`
+	CreatedAt string `json:"created_at"`
+}
+
+func draftExists(db *sql.DB, userID int, slug string) (bool, error) {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(1) FROM user_drafts WHERE user_id = ? AND slug = ?`, userID, slug).Scan(&exists)
+	return exists > 0, err
+}
+
+func draftSharesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		rows, err := db.Query(
+			`SELECT u.username,s.mode,COALESCE(s.created_at,'') FROM draft_shares s JOIN users u ON u.id = s.user_id WHERE s.owner_id = ? AND s.slug = ? ORDER BY u.username`,
+			u.ID,
+			slug,
+		)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []draftShareRow{}
+		for rows.Next() {
+			var row draftShareRow
+			if err := rows.Scan(&row.Username, &row.Mode, &row.CreatedAt); err != nil {
+				docErr(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			out = append(out, row)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func draftShareHandler(db *sql.DB) http.HandlerFunc {
+	type shareRequest struct {
+		Username string `json:"username"`
+		Mode     string `json:"mode"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		var req shareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		mode := strings.ToLower(strings.TrimSpace(req.Mode))
+		if mode == "" {
+			mode = "read"
+		}
+		if mode != "read" && mode != "edit" {
+			docErr(w, http.StatusBadRequest, "mode must be read or edit")
+			return
+		}
+		if exists, err := draftExists(db, u.ID, slug); err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		} else if !exists {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		var targetID int
+		if err := db.QueryRow(`SELECT id FROM users WHERE username = ?`, strings.TrimSpace(req.Username)).Scan(&targetID); err != nil {
+			if err == sql.ErrNoRows {
+				docErr(w, http.StatusNotFound, "user not found")
+				return
+			}
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if targetID == u.ID {
+			docErr(w, http.StatusBadRequest, "cannot share a draft with yourself")
+			return
+		}
+		if _, err := db.Exec(
+			`INSERT INTO draft_shares(owner_id,slug,user_id,mode,created_at) VALUES(?,?,?,?,?)
+			 ON CONFLICT(owner_id, slug, user_id) DO UPDATE SET mode=excluded.mode`,
+			u.ID,
+			slug,
+			targetID,
+			mode,
+			time.Now().UTC().Format(time.RFC3339),
+		); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "share_draft", slug, strings.TrimSpace(req.Username)+":"+mode)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func draftUnshareHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		username := strings.TrimSpace(r.URL.Query().Get("username"))
+		if slug == "" || username == "" {
+			docErr(w, http.StatusBadRequest, "missing slug or username")
+			return
+		}
+		res, err := db.Exec(
+			`DELETE FROM draft_shares WHERE owner_id = ? AND slug = ? AND user_id = (SELECT id FROM users WHERE username = ?)`,
+			u.ID,
+			slug,
+			username,
+		)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "unshare_draft", slug, username)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// draftPublishHandler promotes one of the caller's drafts to a document
+// through the regular save pipeline and removes the draft once it is saved.
+func draftPublishHandler(db *sql.DB) http.HandlerFunc {
+	type publishRequest struct {
+		Status    string `json:"status"`
+		Slug      string `json:"slug"`
+		Overwrite bool   `json:"overwrite"`
+		// Base is the current hash from a MERGE_CONFLICT response, sent
+		// back once the draft has been resolved against it.
+		Base string `json:"base"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		var req publishRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		var path string
+		var isFolder int
+		if err := db.QueryRow(`SELECT path,is_folder FROM user_drafts WHERE user_id = ? AND slug = ?`, u.ID, slug).Scan(&path, &isFolder); err != nil {
+			if err == sql.ErrNoRows {
+				docErr(w, http.StatusNotFound, "not found")
+				return
+			}
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		content := string(raw)
+		meta, _ := parseDocumentMetadata(content)
+
+		target := slug
+		if req.Slug != "" {
+			target = slugify(req.Slug)
+		}
+		if isReservedSlug(target) {
+			docErr(w, http.StatusBadRequest, "reserved slug")
+			return
+		}
+		status := normalizeStatus(req.Status)
+		if status == "" {
+			status = meta.Status
+		}
+		if status == "" {
+			status = "published"
+		}
+		if updated, changed := setFrontMatterField(content, "status", status); changed {
+			content = updated
+		}
+
+		var existingID sql.NullString
+		err = db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, target).Scan(&existingID)
+		if err != nil && err != sql.ErrNoRows {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if err == nil && (meta.ID == "" || existingID.String != meta.ID) {
+			if !req.Overwrite {
+				docErr(w, http.StatusConflict, "slug exists")
+				return
+			}
+			if existingID.String != "" {
+				content, _ = setFrontMatterField(content, "id", existingID.String)
+			}
+		} else if meta.ID != "" {
+			var currentSlug string
+			if err := db.QueryRow(`SELECT slug FROM documents WHERE doc_id = ?`, meta.ID).Scan(&currentSlug); err == nil && currentSlug != target {
+				httpx.WriteError(w, http.StatusConflict, "DOCUMENT_MOVED", fmt.Sprintf("document %s now lives at %s", meta.ID, currentSlug))
+				return
+			}
+		}
+
+		// The base is recorded under the draft's slug, which differs from
+		// target when publishing elsewhere, and only applies to the document
+		// the draft was started from.
+		opts := saveOptions{Hub: isFolder != 0, Base: strings.TrimSpace(req.Base)}
+		if base, ok := loadDraftBase(db, u.ID, slug); ok && (base.docID == "" || base.docID == existingID.String) {
+			opts.Draft = &base
+		}
+		res, err := saveDocument(r.Context(), db, u, target, []byte(content), opts)
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		if res.Proposal == nil {
+			clearUserDraftBySlug(db, u, slug)
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "publish_draft", target, slug)
+		}
+		writeSaveResult(w, res)
+	}
+}
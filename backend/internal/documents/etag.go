@@ -0,0 +1,112 @@
+package documents
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strings"
+
+	"atlas/internal/httpx"
+)
+
+const historyRevisionScanLimit = 100
+
+type preconditionFailedResponse struct {
+	Error    map[string]string    `json:"error"`
+	Revision string               `json:"revision"`
+	Content  string               `json:"content"`
+	Diff     []historyDiffSegment `json:"diff"`
+}
+
+func documentETag(content []byte) string {
+	return `"` + contentHash(content) + `"`
+}
+
+// ifMatchSatisfied reports whether the If-Match header lists etag or "*".
+func ifMatchSatisfied(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// historyRevisionContent finds the content of slug that had the given etag
+// among its recent history entries.
+func historyRevisionContent(db *sql.DB, slug, header string) (string, bool) {
+	rows, err := db.Query(`SELECT file_path FROM history WHERE page_slug = ? ORDER BY id DESC LIMIT ?`, slug, historyRevisionScanLimit)
+	if err != nil {
+		return "", false
+	}
+	var paths []string
+	for rows.Next() {
+		var p sql.NullString
+		if rows.Scan(&p) == nil && p.Valid {
+			paths = append(paths, p.String)
+		}
+	}
+	rows.Close()
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		if ifMatchSatisfied(header, documentETag(data)) {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// replacesDocument reports whether a save to slug creates a new document in
+// place of the one there rather than editing it: the content carries another
+// document id, or the caller confirmed the overwrite. The save answers those
+// with 409 or replaces the document, so they need no If-Match.
+func replacesDocument(db *sql.DB, slug string, body []byte, overwrite bool) bool {
+	if overwrite {
+		return true
+	}
+	var docID sql.NullString
+	if err := db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&docID); err != nil {
+		return false
+	}
+	meta, _ := parseDocumentMetadata(string(body))
+	return meta.ID != docID.String
+}
+
+// checkIfMatch enforces optimistic concurrency for writes to an existing
+// document. It writes 428 when If-Match is missing and 412, with the current
+// revision and the changes made since the client's revision, when it is
+// stale.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, db *sql.DB, slug string) bool {
+	current, exists := currentDocumentContent(db, slug)
+	if !exists {
+		return true
+	}
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		httpx.WriteError(w, http.StatusPreconditionRequired, "PRECONDITION_REQUIRED", "If-Match header required")
+		return false
+	}
+	etag := documentETag(current)
+	if ifMatchSatisfied(header, etag) {
+		return true
+	}
+	diff := []historyDiffSegment{}
+	if base, ok := historyRevisionContent(db, slug, header); ok {
+		diff = diffSegments(base, string(current))
+	}
+	w.Header().Set("ETag", etag)
+	httpx.WriteJSON(w, http.StatusPreconditionFailed, preconditionFailedResponse{
+		Error: map[string]string{
+			"code":    "PRECONDITION_FAILED",
+			"message": "the document changed since it was loaded",
+		},
+		Revision: etag,
+		Content:  string(current),
+		Diff:     diff,
+	})
+	return false
+}
@@ -0,0 +1,55 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+const metadataColumns = "description,tags,front_matter"
+
+func storeDocumentMetadata(db sqlExecer, docID string, meta DocumentMetadata) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	var description, tags, fields, publishAt, expireAt sql.NullString
+	if meta.Description != "" {
+		description = sql.NullString{String: meta.Description, Valid: true}
+	}
+	if encoded := stringListToJSON(meta.Tags); encoded != "" {
+		tags = sql.NullString{String: encoded, Valid: true}
+	}
+	if meta.PublishAt != "" {
+		publishAt = sql.NullString{String: meta.PublishAt, Valid: true}
+	}
+	if meta.ExpireAt != "" {
+		expireAt = sql.NullString{String: meta.ExpireAt, Valid: true}
+	}
+	if len(meta.Fields) > 0 {
+		if b, err := json.Marshal(meta.Fields); err == nil {
+			fields = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+	if _, err := db.Exec(`UPDATE documents SET description = ?, tags = ?, front_matter = ?, publish_at = ?, expire_at = ? WHERE doc_id = ?`, description, tags, fields, publishAt, expireAt, docID); err != nil {
+		log.Printf("store metadata %s: %v", docID, err)
+	}
+	storeDocumentTags(db, docID, meta.Tags)
+}
+
+func fieldsFromJSON(raw string) map[string]any {
+	if raw == "" {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func (row *documentListRow) applyMetadata(description, tags, fields sql.NullString) {
+	row.Description = description.String
+	row.Tags = stringListFromJSON(tags.String)
+	row.Fields = fieldsFromJSON(fields.String)
+}
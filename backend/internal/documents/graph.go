@@ -0,0 +1,217 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"atlas/internal/httpx"
+)
+
+const maxGraphDepth = 5
+
+type graphNode struct {
+	ID       string `json:"id"`
+	DocID    string `json:"doc_id,omitempty"`
+	Slug     string `json:"slug"`
+	Title    string `json:"title"`
+	Status   string `json:"status,omitempty"`
+	IsFolder bool   `json:"is_folder"`
+	Ghost    bool   `json:"ghost"`
+	Depth    int    `json:"depth"`
+}
+
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+	Anchor string `json:"anchor,omitempty"`
+}
+
+type graphResponse struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func documentGraphHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		query := r.URL.Query()
+		statuses := parseStatusParam(query.Get("status"))
+		if len(statuses) == 0 {
+			statuses = []string{"published"}
+		}
+		depth := 1
+		if raw := strings.TrimSpace(query.Get("depth")); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 0 {
+				docErr(w, http.StatusBadRequest, "invalid depth")
+				return
+			}
+			depth = parsed
+		}
+		if depth > maxGraphDepth {
+			depth = maxGraphDepth
+		}
+
+		graph, err := loadDocumentGraph(db, statuses)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "graph query failed")
+			return
+		}
+
+		if rootSlug := cleanSlugParam(query.Get("slug")); rootSlug != "" {
+			rootID := ""
+			for _, node := range graph.Nodes {
+				if !node.Ghost && node.Slug == rootSlug {
+					rootID = node.ID
+					break
+				}
+			}
+			if rootID == "" {
+				if _, aliasID, ok := resolveSlugAlias(db, rootSlug); ok {
+					rootID = aliasID
+				}
+			}
+			if rootID == "" {
+				docErr(w, http.StatusNotFound, "not found")
+				return
+			}
+			graph = graphNeighbourhood(graph, rootID, depth)
+		}
+		httpx.WriteJSON(w, http.StatusOK, graph)
+	}
+}
+
+func loadDocumentGraph(db *sql.DB, statuses []string) (graphResponse, error) {
+	out := graphResponse{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT doc_id,slug,title,status,path FROM documents WHERE doc_id IS NOT NULL AND status IN (%s) ORDER BY slug`, placeholders(len(statuses))), args...)
+	if err != nil {
+		return out, err
+	}
+	nodes := make(map[string]int)
+	for rows.Next() {
+		var node graphNode
+		var title sql.NullString
+		var path string
+		if err := rows.Scan(&node.DocID, &node.Slug, &title, &node.Status, &path); err != nil {
+			rows.Close()
+			return out, err
+		}
+		node.ID = node.DocID
+		node.Title = title.String
+		if node.Title == "" {
+			node.Title = humanizeSlug(node.Slug)
+		}
+		node.IsFolder = strings.EqualFold(filepath.Base(path), "_index.md")
+		nodes[node.ID] = len(out.Nodes)
+		out.Nodes = append(out.Nodes, node)
+	}
+	rows.Close()
+
+	existing := make(map[string]struct{})
+	idRows, err := db.Query(`SELECT doc_id FROM documents WHERE doc_id IS NOT NULL`)
+	if err != nil {
+		return out, err
+	}
+	for idRows.Next() {
+		var id string
+		if idRows.Scan(&id) == nil {
+			existing[id] = struct{}{}
+		}
+	}
+	idRows.Close()
+
+	linkRows, err := db.Query(`SELECT source_id,target_id,target_slug,kind,anchor FROM document_links ORDER BY source_id`)
+	if err != nil {
+		return out, err
+	}
+	defer linkRows.Close()
+	for linkRows.Next() {
+		var source string
+		var targetID, targetSlug, kind, anchor sql.NullString
+		if err := linkRows.Scan(&source, &targetID, &targetSlug, &kind, &anchor); err != nil {
+			return out, err
+		}
+		if _, ok := nodes[source]; !ok {
+			continue
+		}
+		target := targetID.String
+		if _, ok := nodes[target]; !ok {
+			if _, exists := existing[target]; exists && target != "" {
+				continue
+			}
+			ghostLabel := targetSlug.String
+			if ghostLabel == "" {
+				ghostLabel = "doc:" + targetID.String
+			}
+			target = "ghost:" + ghostLabel
+			if _, seen := nodes[target]; !seen {
+				nodes[target] = len(out.Nodes)
+				out.Nodes = append(out.Nodes, graphNode{
+					ID:    target,
+					Slug:  targetSlug.String,
+					Title: ghostLabel,
+					Ghost: true,
+				})
+			}
+		}
+		out.Edges = append(out.Edges, graphEdge{
+			Source: source,
+			Target: target,
+			Kind:   kind.String,
+			Anchor: anchor.String,
+		})
+	}
+	return out, linkRows.Err()
+}
+
+func graphNeighbourhood(graph graphResponse, rootID string, depth int) graphResponse {
+	adjacent := make(map[string][]string)
+	for _, edge := range graph.Edges {
+		adjacent[edge.Source] = append(adjacent[edge.Source], edge.Target)
+		adjacent[edge.Target] = append(adjacent[edge.Target], edge.Source)
+	}
+	distance := map[string]int{rootID: 0}
+	frontier := []string{rootID}
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, id := range frontier {
+			for _, neighbour := range adjacent[id] {
+				if _, ok := distance[neighbour]; ok {
+					continue
+				}
+				distance[neighbour] = level
+				next = append(next, neighbour)
+			}
+		}
+		frontier = next
+	}
+
+	out := graphResponse{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	for _, node := range graph.Nodes {
+		if d, ok := distance[node.ID]; ok {
+			node.Depth = d
+			out.Nodes = append(out.Nodes, node)
+		}
+	}
+	for _, edge := range graph.Edges {
+		_, sourceOK := distance[edge.Source]
+		_, targetOK := distance[edge.Target]
+		if sourceOK && targetOK {
+			out.Edges = append(out.Edges, edge)
+		}
+	}
+	sort.SliceStable(out.Nodes, func(i, j int) bool {
+		return out.Nodes[i].Depth < out.Nodes[j].Depth
+	})
+	return out
+}
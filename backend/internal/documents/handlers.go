@@ -21,46 +21,72 @@ import (
 
 	"atlas/internal/auth"
 	"atlas/internal/contentpath"
+	"atlas/internal/events"
 	"atlas/internal/httpx"
-	"atlas/internal/random"
 
 	"github.com/go-chi/chi/v5"
 	diffmatchpatch "github.com/sergi/go-diff/diffmatchpatch"
 )
 
 type documentListRow struct {
-	DocID        string   `json:"doc_id"`
-	Slug         string   `json:"slug"`
-	Title        string   `json:"title"`
-	Status       string   `json:"status"`
-	Owner        string   `json:"owner"`
-	CreatedAt    string   `json:"created_at"`
-	UpdatedAt    string   `json:"updated_at"`
-	Snippet      string   `json:"snippet,omitempty"`
-	ParentSlug   string   `json:"parent_slug"`
-	IsStartPage  bool     `json:"is_start_page"`
-	IsPinned     bool     `json:"is_pinned"`
-	IsHome       bool     `json:"is_home"`
-	Path         string   `json:"-"`
-	IsFolder     bool     `json:"is_folder"`
-	LinkedDocIDs []string `json:"linked_doc_ids,omitempty"`
+	DocID        string         `json:"doc_id"`
+	Slug         string         `json:"slug"`
+	Title        string         `json:"title"`
+	Status       string         `json:"status"`
+	Owner        string         `json:"owner"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+	Snippet      string         `json:"snippet,omitempty"`
+	ParentSlug   string         `json:"parent_slug"`
+	IsStartPage  bool           `json:"is_start_page"`
+	IsPinned     bool           `json:"is_pinned"`
+	IsHome       bool           `json:"is_home"`
+	Path         string         `json:"-"`
+	IsFolder     bool           `json:"is_folder"`
+	LinkedDocIDs []string       `json:"linked_doc_ids,omitempty"`
+	Anchors      []string       `json:"anchors,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	Fields       map[string]any `json:"fields,omitempty"`
+	Lock         *documentLock  `json:"lock,omitempty"`
+	Revision     string         `json:"revision,omitempty"`
 }
 
 type documentDetailResponse struct {
-	DocID        string   `json:"doc_id"`
-	Slug         string   `json:"slug"`
-	Title        string   `json:"title"`
-	Status       string   `json:"status"`
-	Owner        string   `json:"owner"`
-	CreatedAt    string   `json:"created_at"`
-	UpdatedAt    string   `json:"updated_at"`
-	ParentSlug   string   `json:"parent_slug"`
-	IsStartPage  bool     `json:"is_start_page"`
-	IsPinned     bool     `json:"is_pinned"`
-	IsHome       bool     `json:"is_home"`
-	Content      string   `json:"content"`
-	IsFolder     bool     `json:"is_folder"`
-	LinkedDocIDs []string `json:"linked_doc_ids,omitempty"`
+	DocID        string         `json:"doc_id"`
+	Slug         string         `json:"slug"`
+	Title        string         `json:"title"`
+	Status       string         `json:"status"`
+	Owner        string         `json:"owner"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+	ParentSlug   string         `json:"parent_slug"`
+	IsStartPage  bool           `json:"is_start_page"`
+	IsPinned     bool           `json:"is_pinned"`
+	IsHome       bool           `json:"is_home"`
+	Content      string         `json:"content"`
+	IsFolder     bool           `json:"is_folder"`
+	LinkedDocIDs []string       `json:"linked_doc_ids,omitempty"`
+	Aliases      []string       `json:"aliases,omitempty"`
+	Redirected   string         `json:"redirected_from,omitempty"`
+	Expanded     string         `json:"expanded_content,omitempty"`
+	Outline      []docHeading   `json:"outline"`
+	Description  string         `json:"description,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	PublishAt    string         `json:"publish_at,omitempty"`
+	ExpireAt     string         `json:"expire_at,omitempty"`
+	Fields       map[string]any `json:"fields,omitempty"`
+	BaseHash     string         `json:"base_hash,omitempty"`
+	Stale        bool           `json:"stale,omitempty"`
+	Revision     string         `json:"revision,omitempty"`
+	Lock         *documentLock  `json:"lock,omitempty"`
+}
+
+func actorName(r *http.Request) string {
+	if u := auth.UserFromContext(r); u != nil {
+		return u.Username
+	}
+	return ""
 }
 
 func docErr(w http.ResponseWriter, status int, message string) {
@@ -76,7 +102,7 @@ func listDocumentsHandler(db *sql.DB) http.HandlerFunc {
 		}
 		pathPrefix := cleanPrefix(r.URL.Query().Get("pathPrefix"))
 
-		query, args := buildDocumentQuery(statuses, pathPrefix, "")
+		query, args := buildDocumentQuery(statuses, pathPrefix, "", cleanTagParam(r.URL.Query().Get("tag")))
 		rows, err := db.Query(query, args...)
 		if err != nil {
 			docErr(w, http.StatusInternalServerError, "query error")
@@ -86,25 +112,11 @@ func listDocumentsHandler(db *sql.DB) http.HandlerFunc {
 
 		var out []documentListRow
 		for rows.Next() {
-			var row documentListRow
-			var parent sql.NullString
-			var path string
-			var links sql.NullString
-			var owner sql.NullString
-			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.CreatedAt, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &row.IsHome, &path, &links, &owner); err != nil {
+			row, err := scanDocumentListRow(rows)
+			if err != nil {
 				docErr(w, http.StatusInternalServerError, "scan error")
 				return
 			}
-			if parent.Valid {
-				row.ParentSlug = parent.String
-			}
-			row.Path = path
-			row.IsFolder = strings.EqualFold(filepath.Base(path), "_index.md")
-			row.LinkedDocIDs = idsFromJSON(links.String)
-			if row.Title == "" {
-				row.Title = humanizeSlug(row.Slug)
-			}
-			row.Owner = owner.String
 			out = append(out, row)
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -120,7 +132,7 @@ func navTreeHandler(db *sql.DB) http.HandlerFunc {
 		if len(statuses) == 0 {
 			statuses = []string{"published", "unlisted"}
 		}
-		queryStr, args := buildDocumentQuery(statuses, "", "")
+		queryStr, args := buildDocumentQuery(statuses, "", "", cleanTagParam(query.Get("tag")))
 
 		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 		defer cancel()
@@ -138,25 +150,14 @@ func navTreeHandler(db *sql.DB) http.HandlerFunc {
 
 		var out []documentListRow
 		for rows.Next() {
-			var row documentListRow
-			var parent sql.NullString
-			var path string
-			var links sql.NullString
-			var owner sql.NullString
-			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.CreatedAt, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &row.IsHome, &path, &links, &owner); err != nil {
+			row, err := scanDocumentListRow(rows)
+			if err != nil {
 				docErr(w, http.StatusInternalServerError, "scan error")
 				return
 			}
-			if parent.Valid {
-				row.ParentSlug = parent.String
+			if data, err := os.ReadFile(row.Path); err == nil {
+				row.Revision = documentETag(data)
 			}
-			row.Path = path
-			row.IsFolder = strings.EqualFold(filepath.Base(path), "_index.md")
-			row.LinkedDocIDs = idsFromJSON(links.String)
-			if row.Title == "" {
-				row.Title = humanizeSlug(row.Slug)
-			}
-			row.Owner = owner.String
 			out = append(out, row)
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -187,6 +188,8 @@ func searchDocumentsHandler(db *sql.DB) http.HandlerFunc {
 			switch field {
 			case "title":
 				matchPattern = fmt.Sprintf("title:%s", queryText)
+			case "headings":
+				matchPattern = fmt.Sprintf("headings:%s", queryText)
 			default:
 
 				matchPattern = queryText
@@ -201,9 +204,13 @@ func searchDocumentsHandler(db *sql.DB) http.HandlerFunc {
 				args = append(args, status)
 			}
 		}
-		rankExpr := "bm25(documents_fts, 0.6, 0.35, 0.1)"
+		if tag := cleanTagParam(r.URL.Query().Get("tag")); tag != "" {
+			filters = append(filters, "d.doc_id IN (SELECT doc_id FROM document_tags WHERE tag = ?)")
+			args = append(args, tag)
+		}
+		rankExpr := "bm25(documents_fts, 0.6, 0.35, 0.1, 0.25)"
 		var builder strings.Builder
-		builder.WriteString(`SELECT d.doc_id,d.slug,d.title,d.status,d.updated_at,d.parent_slug,d.is_start_page,d.is_pinned,d.is_home,d.path,d.links,d.owner,snippet(documents_fts,2,'<mark>','</mark>','...',64) AS snippet`)
+		builder.WriteString(`SELECT d.doc_id,d.slug,d.title,d.status,d.updated_at,d.parent_slug,d.is_start_page,d.is_pinned,d.is_home,d.path,` + linkedDocIDsColumn("d.doc_id") + ` AS links,d.owner,snippet(documents_fts,2,'<mark>','</mark>','...',64) AS snippet,d.description,d.tags,d.front_matter`)
 		builder.WriteString(` FROM documents_fts f JOIN documents d ON d.id = f.rowid WHERE documents_fts MATCH ?`)
 		if len(filters) > 0 {
 			builder.WriteString(" AND ")
@@ -227,7 +234,8 @@ func searchDocumentsHandler(db *sql.DB) http.HandlerFunc {
 			var links sql.NullString
 			var owner sql.NullString
 			var snippet sql.NullString
-			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &row.IsHome, &path, &links, &owner, &snippet); err != nil {
+			var description, tags, fields sql.NullString
+			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &row.IsHome, &path, &links, &owner, &snippet, &description, &tags, &fields); err != nil {
 				docErr(w, http.StatusInternalServerError, "scan error")
 				return
 			}
@@ -244,6 +252,7 @@ func searchDocumentsHandler(db *sql.DB) http.HandlerFunc {
 			if snippet.Valid {
 				row.Snippet = sanitizeSnippet(snippet.String)
 			}
+			row.applyMetadata(description, tags, fields)
 			out = append(out, row)
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -260,8 +269,15 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		
+		redirectedFrom := ""
 		var dbStatus sql.NullString
-		db.QueryRow(`SELECT status FROM documents WHERE slug = ?`, slug).Scan(&dbStatus)
+		if err := db.QueryRow(`SELECT status FROM documents WHERE slug = ?`, slug).Scan(&dbStatus); err == sql.ErrNoRows {
+			if target, _, ok := resolveSlugAlias(db, slug); ok {
+				redirectedFrom = slug
+				slug = target
+				db.QueryRow(`SELECT status FROM documents WHERE slug = ?`, slug).Scan(&dbStatus)
+			}
+		}
 		docStatus := "published"
 		if dbStatus.Valid && dbStatus.String != "" {
 			docStatus = dbStatus.String
@@ -289,7 +305,7 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 		var isHome int
 		var links sql.NullString
 		var owner sql.NullString
-		err = db.QueryRow(`SELECT doc_id,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,is_home,links,owner FROM documents WHERE slug = ?`, slug).Scan(&docID, &title, &statusRow, &created, &updated, &parent, &isStart, &isPinned, &isHome, &links, &owner)
+		err = db.QueryRow(`SELECT doc_id,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,is_home,`+linkedDocIDsColumn("documents.doc_id")+`,owner FROM documents WHERE slug = ?`, slug).Scan(&docID, &title, &statusRow, &created, &updated, &parent, &isStart, &isPinned, &isHome, &links, &owner)
 		validRow := err == nil
 		if err != nil && err != sql.ErrNoRows {
 			docErr(w, http.StatusInternalServerError, "query error")
@@ -310,6 +326,15 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 			ParentSlug:  parent.String,
 			Content:     body,
 			IsFolder:    isFolder,
+			Aliases:     meta.Aliases,
+			Redirected:  redirectedFrom,
+			Outline:     documentHeadings(string(content)),
+			Description: meta.Description,
+			Tags:        meta.Tags,
+			PublishAt:   meta.PublishAt,
+			ExpireAt:    meta.ExpireAt,
+			Fields:      meta.Fields,
+			Revision:    documentETag(content),
 		}
 		if links.Valid {
 			resp.LinkedDocIDs = idsFromJSON(links.String)
@@ -317,6 +342,10 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 		if resp.DocID == "" {
 			resp.DocID = meta.ID
 		}
+		resp.Lock = loadDocumentLock(db, resp.DocID)
+		if expand := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("expand"))); expand == "1" || expand == "true" {
+			resp.Expanded = expandEmbeds(db, resp.DocID, body)
+		}
 		if !validRow {
 			resp.Status = meta.Status
 			resp.Owner = meta.Owner
@@ -339,6 +368,7 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 		if resp.CreatedAt == "" {
 			resp.CreatedAt = resp.UpdatedAt
 		}
+		w.Header().Set("ETag", resp.Revision)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
@@ -346,366 +376,39 @@ func documentDetailHandler(db *sql.DB) http.HandlerFunc {
 
 func documentSaveHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rawSlug := chi.URLParam(r, "*")
-		slug, explicitIndex := slugParamInfo(rawSlug)
+		slug, explicitIndex := slugParamInfo(chi.URLParam(r, "*"))
 		if slug == "" {
 			docErr(w, http.StatusBadRequest, "missing slug")
 			return
 		}
-
-		targetHub := explicitIndex
-		if hubParam := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("hub"))); hubParam != "" {
-			switch hubParam {
-			case "1", "true", "yes":
-				targetHub = true
-			case "0", "false", "no":
-				targetHub = false
-			}
-		}
-		overwriteParam := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("overwrite")))
-		allowOverwrite := overwriteParam == "1" || overwriteParam == "true" || overwriteParam == "yes"
-		renToRaw := strings.TrimSpace(r.URL.Query().Get("rename_to"))
-
-		
+		opts := saveOptionsFromQuery(r.URL.Query(), explicitIndex)
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			httpx.WriteError(w, http.StatusBadRequest, "READ_DOCUMENT_FAILED", err.Error())
 			return
 		}
-		content := string(body)
-		meta, _ := parseDocumentMetadata(content)
-
-		
-		var metadataErr error
-		content, metadataErr = ensureDocumentMetadata(content, &meta, auth.UserFromContext(r))
-		if metadataErr != nil {
-			httpx.WriteError(w, http.StatusBadRequest, "INVALID_METADATA", metadataErr.Error())
-			return
-		}
-
-		
-		if meta.ID == "" {
-			meta.ID = "doc-" + random.GenerateToken(12)
-			if updated, changed := ensureFrontMatterID(content, meta.ID); changed {
-				content = updated
-			}
-		}
-
-		var overwriteTargetDocID sql.NullString
-		var overwriteTargetStatus sql.NullString
-		if renToRaw != "" {
-			newSlug := slugify(renToRaw)
-			if newSlug == "" {
-				newSlug = "untitled"
-			}
-			if newSlug != slug {
-				if err := db.QueryRow(`SELECT doc_id,status FROM documents WHERE slug = ?`, newSlug).Scan(&overwriteTargetDocID, &overwriteTargetStatus); err != nil {
-					if err != sql.ErrNoRows {
-						docErr(w, http.StatusInternalServerError, "query error")
-						return
-					}
-					overwriteTargetDocID = sql.NullString{}
-					overwriteTargetStatus = sql.NullString{}
-				}
-				if overwriteTargetDocID.Valid {
-					if overwriteTargetDocID.String == "" {
-						if !allowOverwrite {
-							docErr(w, http.StatusConflict, "slug exists")
-							return
-						}
-					} else if overwriteTargetDocID.String != meta.ID {
-						if !allowOverwrite {
-							docErr(w, http.StatusConflict, "slug exists")
-							return
-						}
-						meta.ID = overwriteTargetDocID.String
-						if updated, changed := setFrontMatterField(content, "id", meta.ID); changed {
-							content = updated
-						}
-					}
-				}
-			}
-		}
-
-		if renToRaw == "" {
-			var existingDocID sql.NullString
-			var existingStatus sql.NullString
-			if err := db.QueryRow(`SELECT doc_id,status FROM documents WHERE slug = ?`, slug).Scan(&existingDocID, &existingStatus); err == nil {
-				if existingDocID.String != "" && existingDocID.String != meta.ID {
-					if !allowOverwrite {
-						docErr(w, http.StatusConflict, "slug exists")
-						return
-					}
-					meta.ID = existingDocID.String
-					if updated, changed := setFrontMatterField(content, "id", meta.ID); changed {
-						content = updated
-					}
-				}
-			} else if err != sql.ErrNoRows {
-				docErr(w, http.StatusInternalServerError, "query error")
-				return
-			}
-		}
-
-		body = []byte(content)
-
-		
-		currentPath, currentStatus, _ := findDocumentPath(slug, targetHub)
-
-		
-		isNew := false
-		if _, err := os.Stat(currentPath); os.IsNotExist(err) {
-			isNew = true
-			if isReservedSlug(slug) {
-				docErr(w, http.StatusBadRequest, "reserved slug")
-				return
-			}
-		}
-
-		
-		targetPath, err := docPathFromSlugWithHint(slug, meta.Status, targetHub)
-		if err != nil {
-			docErr(w, http.StatusBadRequest, "invalid slug")
-			return
-		}
-
-		
-		if !isNew && (currentStatus != meta.Status || currentPath != targetPath) {
-			targetPath, err = moveDocumentToStatus(currentPath, slug, meta.Status, targetHub)
-			if err != nil {
-				docErr(w, http.StatusInternalServerError, "move failed")
-				return
-			}
-		}
-
-		path := targetPath
-		os.MkdirAll(filepath.Dir(path), 0o755)
-
-		existed := false
-		if _, err := os.Stat(path); err == nil {
-			existed = true
-			note := "edited (anonymous)"
-			if u := auth.UserFromContext(r); u != nil {
-				note = fmt.Sprintf("%s edited", u.Username)
-			}
-			recordHistory(db, slug, note, mustReadFile(path))
-		}
-
-		if err := os.WriteFile(path, body, 0o644); err != nil {
-			docErr(w, http.StatusInternalServerError, "write failed")
+		if !checkDocumentLock(w, r, db, slug, false) {
 			return
 		}
-
-		if !existed {
-			note := "created (anonymous)"
-			if u := auth.UserFromContext(r); u != nil {
-				note = fmt.Sprintf("%s created", u.Username)
-			}
-			recordHistory(db, slug, note, body)
-		}
-
-		var oldSlugVal string
-		wasStartPage := false
-		if renToRaw != "" {
-			newSlug := slugify(renToRaw)
-			if newSlug == "" {
-				newSlug = "untitled"
-			}
-			if newSlug != slug {
-				if isReservedSlug(newSlug) {
-					docErr(w, http.StatusBadRequest, "reserved slug")
-					return
-				}
-
-				if overwriteTargetDocID.Valid {
-					if overwriteTargetDocID.String == "" {
-						if !allowOverwrite {
-							docErr(w, http.StatusConflict, "slug exists")
-							return
-						}
-					} else if overwriteTargetDocID.String != meta.ID {
-						docErr(w, http.StatusConflict, "slug exists")
-						return
-					}
-				}
-
-				useIndexLayout := strings.EqualFold(filepath.Base(path), "_index.md")
-				var newPath string
-				var pErr error
-				if useIndexLayout {
-					newPath, pErr = docPathFromSlugWithHint(newSlug, meta.Status, true)
-				} else {
-					newPath, pErr = docPathFromSlug(newSlug, meta.Status)
-				}
-				if pErr != nil {
-					docErr(w, http.StatusBadRequest, "invalid new slug")
-					return
-				}
-				if info, statErr := os.Stat(newPath); statErr == nil {
-					if info.IsDir() || !allowOverwrite {
-						docErr(w, http.StatusConflict, "slug exists")
-						return
-					}
-					if err := os.Remove(newPath); err != nil {
-						docErr(w, http.StatusInternalServerError, "overwrite failed")
-						return
-					}
-				}
-				var sIsStart int
-				if err := db.QueryRow(`SELECT is_start_page FROM documents WHERE slug = ?`, slug).Scan(&sIsStart); err == nil && sIsStart != 0 {
-					wasStartPage = true
-				}
-
-				if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
-					docErr(w, http.StatusInternalServerError, "write failed")
-					return
-				}
-
-				if err := os.Rename(path, newPath); err != nil {
-					docErr(w, http.StatusInternalServerError, "rename failed")
-					return
-				}
-				oldSlugVal = slug
-				slug = newSlug
-				path = newPath
-
-				db.Exec(`UPDATE history SET page_slug = ? WHERE page_slug = ?`, slug, oldSlugVal)
-			}
-		}
-
-		if oldSlugVal != "" && oldSlugVal != slug {
-			if _, err := db.Exec(`DELETE FROM documents WHERE slug = ?`, oldSlugVal); err != nil {
-				docErr(w, http.StatusInternalServerError, "db update failed")
-				return
+		// A save published from the caller's draft is rebased onto the
+		// current document, and one creating a document at a taken slug
+		// gets 409 or overwrites it, so neither is checked against If-Match.
+		u := auth.UserFromContext(r)
+		if fromDraft, _ := flagParam(r.URL.Query(), "from_draft"); fromDraft && u != nil {
+			if base, ok := loadDraftBase(db, u.ID, slug); ok {
+				opts.Draft = &base
 			}
-			db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE slug = ?)`, oldSlugVal)
-		}
-
-		title := extractTitle(content)
-		status := meta.Status
-		if status == "" {
-			status = "published"
-		}
-		parent := parentSlug(slug)
-		var parentVal sql.NullString
-		if parent != "" {
-			parentVal = sql.NullString{String: parent, Valid: true}
 		}
-		now := time.Now().UTC().Format(time.RFC3339)
-		createdAt := now
-
-		homeVal := 1
-		if meta.ID != "" {
-			var existingHome sql.NullInt64
-			if err := db.QueryRow(`SELECT is_home FROM documents WHERE doc_id = ?`, meta.ID).Scan(&existingHome); err == nil {
-				if existingHome.Valid {
-					homeVal = int(existingHome.Int64)
-				}
-			} else if err != sql.ErrNoRows {
-				docErr(w, http.StatusInternalServerError, "query error")
-				return
-			}
-		}
-
-		linkTokens := extractDocLinkTokens(stripFrontMatter(content))
-		slugMap := make(map[string]string)
-		if len(linkTokens) > 0 {
-			targetSet := make(map[string]struct{})
-			for _, token := range linkTokens {
-				if token.Slug == "" {
-					continue
-				}
-				targetSet[token.Slug] = struct{}{}
-			}
-			if len(targetSet) > 0 {
-				targetSlugs := make([]string, 0, len(targetSet))
-				for target := range targetSet {
-					targetSlugs = append(targetSlugs, target)
-				}
-				args := make([]any, len(targetSlugs))
-				for i, target := range targetSlugs {
-					args[i] = target
-				}
-				rows, err := db.Query(fmt.Sprintf(`SELECT slug,doc_id FROM documents WHERE slug IN (%s)`, placeholders(len(targetSlugs))), args...)
-				if err == nil {
-					for rows.Next() {
-						var existingSlug sql.NullString
-						var existingID sql.NullString
-						if scanErr := rows.Scan(&existingSlug, &existingID); scanErr == nil && existingSlug.Valid {
-							slugMap[existingSlug.String] = existingID.String
-						}
-					}
-					rows.Close()
-				} else {
-					log.Printf("load slug map: %v", err)
-				}
-			}
-		}
-		slugMap[slug] = meta.ID
-		linkIDs := resolveDocLinkIDs(linkTokens, slugMap, meta.ID)
-		linkJSON := idsToJSON(linkIDs)
-
-		var docCount int
-		_ = db.QueryRow(`SELECT COUNT(1) FROM documents`).Scan(&docCount)
-		isFirst := docCount == 0
-
-		var isStart int
-		if err := db.QueryRow(`SELECT is_start_page FROM documents WHERE slug = ?`, slug).Scan(&isStart); err != nil && err != sql.ErrNoRows {
-			docErr(w, http.StatusInternalServerError, "query error")
+		unchecked := opts.Draft != nil || r.Header.Get("If-Match") == "" && replacesDocument(db, slug, body, opts.Overwrite)
+		if !unchecked && !checkIfMatch(w, r, db, slug) {
 			return
 		}
-
-		_, err = db.Exec(`INSERT INTO documents(doc_id,slug,title,path,parent_slug,status,owner,created_at,updated_at,is_home,links)
-			VALUES(?,?,?,?,?,?,?,?,?,?,?)
-			ON CONFLICT(slug) DO UPDATE SET doc_id=excluded.doc_id, title=excluded.title, path=excluded.path, parent_slug=excluded.parent_slug, status=excluded.status, owner=excluded.owner, updated_at=excluded.updated_at, links=excluded.links;`,
-			meta.ID, slug, title, path, parentVal, status, meta.Owner, createdAt, now, homeVal, linkJSON)
+		res, err := saveDocument(r.Context(), db, u, slug, body, opts)
 		if err != nil {
-			docErr(w, http.StatusInternalServerError, "db update failed")
+			writeSaveError(w, err)
 			return
 		}
-
-		db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, meta.ID)
-		db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body) VALUES((SELECT id FROM documents WHERE doc_id = ?),?,?,?)`, meta.ID, slug, title, string(body))
-
-		if wasStartPage {
-			_ = SetStartPageSlug(db, slug)
-		}
-
-		if u := auth.UserFromContext(r); u != nil {
-			db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, "edit_document", slug)
-			clearUserDraftBySlug(db, u, slug)
-			if oldSlugVal != "" && oldSlugVal != slug {
-				clearUserDraftBySlug(db, u, oldSlugVal)
-			}
-		}
-		if isFirst {
-			EnsureStartPageMeta(db, slug, true)
-		}
-		if slug == "start-page" {
-			seededSlugs := seedDefaultStructureIfNeeded(db)
-
-			if len(seededSlugs) > 0 {
-				if err := SyncContentIndex(db); err != nil {
-
-					log.Printf("sync after seed: %v", err)
-				}
-				var placeholders strings.Builder
-				args := make([]any, len(seededSlugs))
-				for i, s := range seededSlugs {
-					if i > 0 {
-						placeholders.WriteString(",")
-					}
-					placeholders.WriteString("?")
-					args[i] = s
-				}
-				_, err := db.Exec(fmt.Sprintf("UPDATE documents SET is_home = 1 WHERE slug IN (%s)", placeholders.String()), args...)
-				if err != nil {
-					log.Printf("set seeded home flag: %v", err)
-				}
-			}
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"slug": slug})
+		writeSaveResult(w, res)
 	}
 }
 
@@ -718,7 +421,9 @@ func documentDeleteHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		
+		if !checkDocumentLock(w, r, db, slug, false) {
+			return
+		}
 		path, _, err := findDocumentPath(slug, explicitIndex)
 		if err != nil {
 			docErr(w, http.StatusBadRequest, "invalid slug")
@@ -733,10 +438,21 @@ func documentDeleteHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE slug = ?)`, slug)
+		var deletedID sql.NullString
+		db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&deletedID)
+		detachDocumentLinks(db, deletedID.String)
+		db.Exec(`DELETE FROM document_headings WHERE doc_id = ?`, deletedID.String)
+		db.Exec(`DELETE FROM document_tags WHERE doc_id = ?`, deletedID.String)
+		db.Exec(`DELETE FROM document_locks WHERE doc_id = ?`, deletedID.String)
+		deleteDocumentComments(db, deletedID.String)
+		db.Exec(`UPDATE document_suggestions SET status = 'withdrawn' WHERE doc_id = ? AND status IN ('pending','partial')`, deletedID.String)
+		db.Exec(`DELETE FROM document_aliases WHERE doc_id = (SELECT doc_id FROM documents WHERE slug = ?)`, slug)
 		db.Exec(`DELETE FROM documents WHERE slug = ?`, slug)
 		if u := auth.UserFromContext(r); u != nil {
 			db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, "delete_document", slug)
 		}
+		events.Publish(events.DocumentDeleted, slug, actorName(r), map[string]string{"doc_id": deletedID.String})
+		events.Publish(events.TreeChanged, slug, actorName(r), nil)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -747,10 +463,11 @@ func moveDocumentHandler(db *sql.DB) http.HandlerFunc {
 		Parent string `json:"parent"`
 	}
 	type moveRow struct {
-		DocID  sql.NullString
-		Slug   string
-		Parent sql.NullString
-		Path   string
+		DocID   sql.NullString
+		Slug    string
+		Parent  sql.NullString
+		Path    string
+		NewPath string
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -804,6 +521,9 @@ func moveDocumentHandler(db *sql.DB) http.HandlerFunc {
 			_ = json.NewEncoder(w).Encode(map[string]string{"slug": slug})
 			return
 		}
+		if !checkReviewPolicy(w, r, db, true, slug, targetSlug) || !checkDocumentLock(w, r, db, slug, true) || !checkIfMatch(w, r, db, slug) {
+			return
+		}
 
 		var rows []*moveRow
 		rawRows, err := db.Query(`SELECT doc_id, slug, parent_slug, path FROM documents WHERE slug = ? OR slug LIKE ?`, slug, slug+"/%")
@@ -976,6 +696,7 @@ func moveDocumentHandler(db *sql.DB) http.HandlerFunc {
 			} else if row.Slug == slug {
 				newPath = newFilePath
 			}
+			row.NewPath = newPath
 			var res sql.Result
 			if row.DocID.Valid && row.DocID.String != "" {
 				res, err = tx.Exec(`UPDATE documents SET slug = ?, parent_slug = ?, path = ? WHERE doc_id = ?`, newSlug, parentVal, newPath, row.DocID.String)
@@ -1035,6 +756,19 @@ func moveDocumentHandler(db *sql.DB) http.HandlerFunc {
 			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "move_document", slug, targetSlug)
 		}
 
+		renames := make(map[string]string, len(rows))
+		var movedIDs []string
+		for _, row := range rows {
+			renames[row.Slug] = replaceSlug(row.Slug)
+			recordDocumentAlias(db, auth.UserFromContext(r), row.NewPath, renames[row.Slug], row.Slug)
+			if row.DocID.Valid && row.DocID.String != "" {
+				movedIDs = append(movedIDs, row.DocID.String)
+			}
+		}
+		relinkReferencingDocuments(db, auth.UserFromContext(r), renames, movedIDs)
+		events.Publish(events.DocumentMoved, targetSlug, actorName(r), events.DocumentMovedData{From: slug, To: targetSlug})
+		events.Publish(events.TreeChanged, targetSlug, actorName(r), nil)
+
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]string{"slug": targetSlug})
 	}
@@ -1067,6 +801,7 @@ func documentPinHandler(db *sql.DB, pinned bool) http.HandlerFunc {
 			}
 			db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, action, slug)
 		}
+		events.Publish(events.TreeChanged, slug, actorName(r), nil)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -1111,6 +846,7 @@ func documentHomeHandler(db *sql.DB, homed bool) http.HandlerFunc {
 				}
 				db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, action, slug)
 			}
+			events.Publish(events.TreeChanged, slug, actorName(r), nil)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -1130,6 +866,7 @@ func documentHomeHandler(db *sql.DB, homed bool) http.HandlerFunc {
 			}
 			db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, action, slug)
 		}
+		events.Publish(events.TreeChanged, slug, actorName(r), nil)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -1153,63 +890,99 @@ func documentStatusHandler(db *sql.DB) http.HandlerFunc {
 			docErr(w, http.StatusBadRequest, "invalid status")
 			return
 		}
-
-		like := slug + "/%"
-		rows, err := db.Query(`SELECT slug,path FROM documents WHERE slug = ? OR slug LIKE ?`, slug, like)
-		if err != nil {
-			docErr(w, http.StatusInternalServerError, "query failed")
+		if !checkReviewPolicy(w, r, db, true, slug) || !checkDocumentLock(w, r, db, slug, true) || !checkIfMatch(w, r, db, slug) {
 			return
 		}
-		defer rows.Close()
 
-		type docRow struct {
-			Slug string
-			Path string
-		}
-		var docs []docRow
-		for rows.Next() {
-			var row docRow
-			if scanErr := rows.Scan(&row.Slug, &row.Path); scanErr != nil {
-				docErr(w, http.StatusInternalServerError, "scan error")
+		if err := applyDocumentStatus(db, slug, status, true, ""); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				docErr(w, http.StatusNotFound, "not found")
 				return
 			}
-			docs = append(docs, row)
-		}
-		if len(docs) == 0 {
-			docErr(w, http.StatusNotFound, "not found")
+			docErr(w, http.StatusInternalServerError, "update failed")
 			return
 		}
+		events.Publish(events.DocumentStatus, slug, actorName(r), events.DocumentStatusData{Status: status})
+		events.Publish(events.TreeChanged, slug, actorName(r), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
 
-		for _, doc := range docs {
-			content, readErr := os.ReadFile(doc.Path)
-			if readErr != nil {
-				docErr(w, http.StatusNotFound, "not found")
-				return
-			}
-			next, _ := setFrontMatterField(string(content), "status", status)
-			if writeErr := os.WriteFile(doc.Path, []byte(next), 0o644); writeErr != nil {
-				docErr(w, http.StatusInternalServerError, "write failed")
-				return
-			}
+// applyDocumentStatus writes status into the front matter of slug, and of its
+// descendants when subtree is set, and updates the index. A non-empty note
+// marks a scheduled transition: each file also gets a history entry with the
+// note and moves under the root matching its new status.
+func applyDocumentStatus(db *sql.DB, slug, status string, subtree bool, note string) error {
+	query := `SELECT slug,path FROM documents WHERE slug = ?`
+	args := []any{slug}
+	if subtree {
+		query += ` OR slug LIKE ?`
+		args = append(args, slug+"/%")
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	type docRow struct {
+		Slug string
+		Path string
+	}
+	var docs []docRow
+	for rows.Next() {
+		var row docRow
+		if err := rows.Scan(&row.Slug, &row.Path); err != nil {
+			rows.Close()
+			return err
 		}
+		docs = append(docs, row)
+	}
+	rows.Close()
+	if len(docs) == 0 {
+		return os.ErrNotExist
+	}
 
-		now := time.Now().UTC().Format(time.RFC3339)
-		query := `UPDATE documents SET status = ?, updated_at = ? WHERE slug = ? OR slug LIKE ?`
-		args := []any{status, now, slug, like}
-		if status == "unlisted" {
-			query = `UPDATE documents SET status = ?, is_home = 0, updated_at = ? WHERE slug = ? OR slug LIKE ?`
+	for _, doc := range docs {
+		content, err := os.ReadFile(doc.Path)
+		if err != nil {
+			return err
+		}
+		next, _ := setFrontMatterField(string(content), "status", status)
+		if note != "" {
+			recordHistory(db, doc.Slug, note, content)
 		}
-		res, err := db.Exec(query, args...)
+		if err := os.WriteFile(doc.Path, []byte(next), 0o644); err != nil {
+			return err
+		}
+		if note == "" {
+			continue
+		}
+		asHub := strings.EqualFold(filepath.Base(doc.Path), "_index.md")
+		newPath, err := moveDocumentToStatus(doc.Path, doc.Slug, status, asHub)
 		if err != nil {
-			docErr(w, http.StatusInternalServerError, "update failed")
-			return
+			return err
 		}
-		if n, _ := res.RowsAffected(); n == 0 {
-			docErr(w, http.StatusNotFound, "not found")
-			return
+		if newPath != doc.Path {
+			db.Exec(`UPDATE documents SET path = ? WHERE slug = ?`, newPath, doc.Slug)
 		}
-		w.WriteHeader(http.StatusNoContent)
 	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	set := `status = ?, updated_at = ?`
+	if status == "unlisted" {
+		set = `status = ?, is_home = 0, updated_at = ?`
+	}
+	where := `slug = ?`
+	if subtree {
+		where = `slug = ? OR slug LIKE ?`
+	}
+	res, err := db.Exec(`UPDATE documents SET `+set+` WHERE `+where, append([]any{status, now}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return os.ErrNotExist
+	}
+	return nil
 }
 
 func documentHistoryHandler(db *sql.DB) http.HandlerFunc {
@@ -1263,6 +1036,24 @@ type historyDiffResponse struct {
 	Segments []historyDiffSegment `json:"segments"`
 }
 
+func diffSegments(from, to string) []historyDiffSegment {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(from, to, false)
+	dmp.DiffCleanupSemantic(diffs)
+	segments := make([]historyDiffSegment, 0, len(diffs))
+	for _, diff := range diffs {
+		t := "equal"
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			t = "delete"
+		case diffmatchpatch.DiffInsert:
+			t = "insert"
+		}
+		segments = append(segments, historyDiffSegment{Type: t, Text: diff.Text})
+	}
+	return segments
+}
+
 func documentHistoryDiffHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slug := cleanSlugParam(chi.URLParam(r, "*"))
@@ -1308,26 +1099,12 @@ func documentHistoryDiffHandler(db *sql.DB) http.HandlerFunc {
 				currentData = cur
 			}
 		}
-		dmp := diffmatchpatch.New()
-		diffs := dmp.DiffMain(string(historyData), string(currentData), false)
-		dmp.DiffCleanupSemantic(diffs)
-		segments := make([]historyDiffSegment, 0, len(diffs))
-		for _, diff := range diffs {
-			t := "equal"
-			switch diff.Type {
-			case diffmatchpatch.DiffDelete:
-				t = "delete"
-			case diffmatchpatch.DiffInsert:
-				t = "insert"
-			}
-			segments = append(segments, historyDiffSegment{Type: t, Text: diff.Text})
-		}
 		resp := historyDiffResponse{
 			ID:       id,
 			Slug:     slug,
 			SavedAt:  savedAt.String,
 			Note:     note.String,
-			Segments: segments,
+			Segments: diffSegments(string(historyData), string(currentData)),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
@@ -1356,6 +1133,9 @@ func documentRestoreHandler(db *sql.DB) http.HandlerFunc {
 			docErr(w, http.StatusInternalServerError, "read failed")
 			return
 		}
+		if !checkReviewPolicy(w, r, db, false, slug) || !checkDocumentLock(w, r, db, slug, false) || !checkIfMatch(w, r, db, slug) {
+			return
+		}
 		var dbStatus sql.NullString
 		db.QueryRow(`SELECT status FROM documents WHERE slug = ?`, slug).Scan(&dbStatus)
 		docStatus := "published"
@@ -1408,10 +1188,26 @@ func documentRestoreHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE slug = ?)`, slug)
-		db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body) VALUES((SELECT id FROM documents WHERE slug = ?),?,?,?)`, slug, slug, title, string(data))
+		syncDocumentAliases(db, meta.ID, slug, meta.Aliases)
+		var restoredID sql.NullString
+		db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&restoredID)
+		storeDocumentMetadata(db, restoredID.String, meta)
+		restoredHeadings := documentHeadings(string(data))
+		db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body,headings) VALUES((SELECT id FROM documents WHERE slug = ?),?,?,?,?)`, slug, slug, title, expandEmbeds(db, restoredID.String, string(data)), headingsText(restoredHeadings))
+		restoredTokens := extractDocLinkTokens(stripFrontMatter(string(data)))
+		storeDocumentLinks(db, restoredID.String, restoredTokens, resolveLinkSlugs(db, restoredTokens))
+		storeDocumentHeadings(db, restoredID.String, restoredHeadings)
+		reanchorComments(db, restoredID.String, stripFrontMatter(string(data)))
+		reindexEmbedders(db, restoredID.String)
 		if u := auth.UserFromContext(r); u != nil {
 			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "restore_document", slug, filePath)
 		}
+		events.Publish(events.DocumentSaved, slug, actorName(r), events.DocumentSavedData{
+			DocID:        restoredID.String,
+			Revision:     documentETag(data),
+			RestoredFrom: strconv.Itoa(req.ID),
+		})
+		events.Publish(events.TreeChanged, slug, actorName(r), nil)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -1424,11 +1220,18 @@ func backlinksHandler(db *sql.DB) http.HandlerFunc {
 			docErr(w, http.StatusBadRequest, "missing slug")
 			return
 		}
+		kind := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("kind")))
 		var docID sql.NullString
 		if err := db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&docID); err != nil && err != sql.ErrNoRows {
 			docErr(w, http.StatusInternalServerError, "query error")
 			return
 		}
+		if docID.String == "" {
+			if target, aliasID, ok := resolveSlugAlias(db, slug); ok {
+				slug = target
+				docID = sql.NullString{String: aliasID, Valid: true}
+			}
+		}
 		if docID.String == "" {
 			if path, err := docPathFromSlug(slug, "published"); err == nil {
 				if content, err := os.ReadFile(path); err == nil {
@@ -1445,8 +1248,10 @@ func backlinksHandler(db *sql.DB) http.HandlerFunc {
 			json.NewEncoder(w).Encode([]documentListRow{})
 			return
 		}
-		pattern := "%\"" + docID.String + "\"%"
-		rows, err := db.Query(`SELECT doc_id,slug,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,path,links FROM documents WHERE links LIKE ? AND slug != ? ORDER BY updated_at DESC`, pattern, slug)
+		rows, err := db.Query(`SELECT doc_id,slug,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,path,`+linkedDocIDsColumn("documents.doc_id")+`,
+			(SELECT json_group_array(DISTINCT anchor ORDER BY anchor) FROM document_links WHERE source_id = documents.doc_id AND target_id = ? AND anchor IS NOT NULL AND anchor != '')
+			FROM documents
+			WHERE doc_id IN (SELECT source_id FROM document_links WHERE target_id = ? AND (? = '' OR kind = ?)) AND slug != ? ORDER BY updated_at DESC`, docID.String, docID.String, kind, kind, slug)
 		if err != nil {
 			docErr(w, http.StatusInternalServerError, "query error")
 			return
@@ -1457,8 +1262,8 @@ func backlinksHandler(db *sql.DB) http.HandlerFunc {
 			var row documentListRow
 			var parent sql.NullString
 			var path string
-			var links sql.NullString
-			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.CreatedAt, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &path, &links); err != nil {
+			var links, anchors sql.NullString
+			if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.CreatedAt, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &path, &links, &anchors); err != nil {
 				docErr(w, http.StatusInternalServerError, "scan error")
 				return
 			}
@@ -1468,6 +1273,7 @@ func backlinksHandler(db *sql.DB) http.HandlerFunc {
 			row.Path = path
 			row.IsFolder = strings.EqualFold(filepath.Base(path), "_index.md")
 			row.LinkedDocIDs = idsFromJSON(links.String)
+			row.Anchors = stringListFromJSON(anchors.String)
 			if row.Title == "" {
 				row.Title = humanizeSlug(row.Slug)
 			}
@@ -1529,8 +1335,12 @@ func cleanPrefix(raw string) string {
 	return prefix
 }
 
-func buildDocumentQuery(statuses []string, pathPrefix, owner string) (string, []any) {
-	parts := []string{"SELECT doc_id,slug,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,is_home,path,links,owner FROM documents"}
+func documentListSelect() string {
+	return "SELECT doc_id,slug,title,status,created_at,updated_at,parent_slug,is_start_page,is_pinned,is_home,path," + linkedDocIDsColumn("documents.doc_id") + ",owner," + metadataColumns + "," + lockColumn("documents.doc_id") + " FROM documents"
+}
+
+func buildDocumentQuery(statuses []string, pathPrefix, owner, tag string) (string, []any) {
+	parts := []string{documentListSelect()}
 	var filters []string
 	var args []any
 	if len(statuses) > 0 {
@@ -1547,6 +1357,10 @@ func buildDocumentQuery(statuses []string, pathPrefix, owner string) (string, []
 		filters = append(filters, "owner = ?")
 		args = append(args, owner)
 	}
+	if tag != "" {
+		filters = append(filters, "doc_id IN (SELECT doc_id FROM document_tags WHERE tag = ?)")
+		args = append(args, tag)
+	}
 	if len(filters) > 0 {
 		parts = append(parts, "WHERE "+strings.Join(filters, " AND "))
 	}
@@ -1554,6 +1368,30 @@ func buildDocumentQuery(statuses []string, pathPrefix, owner string) (string, []
 	return strings.Join(parts, " "), args
 }
 
+func scanDocumentListRow(rows *sql.Rows) (documentListRow, error) {
+	var row documentListRow
+	var parent sql.NullString
+	var path string
+	var links sql.NullString
+	var owner sql.NullString
+	var description, tags, fields sql.NullString
+	var lock sql.NullString
+	if err := rows.Scan(&row.DocID, &row.Slug, &row.Title, &row.Status, &row.CreatedAt, &row.UpdatedAt, &parent, &row.IsStartPage, &row.IsPinned, &row.IsHome, &path, &links, &owner, &description, &tags, &fields, &lock); err != nil {
+		return row, err
+	}
+	row.ParentSlug = parent.String
+	row.Path = path
+	row.IsFolder = strings.EqualFold(filepath.Base(path), "_index.md")
+	row.LinkedDocIDs = idsFromJSON(links.String)
+	if row.Title == "" {
+		row.Title = humanizeSlug(row.Slug)
+	}
+	row.Owner = owner.String
+	row.applyMetadata(description, tags, fields)
+	row.Lock = lockFromJSON(lock)
+	return row, nil
+}
+
 func ensureDocumentMetadata(content string, meta *DocumentMetadata, user *auth.User) (string, error) {
 	block := frontMatterRE.FindString(content)
 	hasStatus := block != "" && frontMatterHasKey(block, "status")
@@ -0,0 +1,206 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextUnderlineRE    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceOpenPattern     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	headingLinkPattern   = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	headingMarkupReplace = strings.NewReplacer("**", "", "__", "", "`", "", "~~", "")
+)
+
+type docHeading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+	Line   int    `json:"line"`
+}
+
+func headingAnchor(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '_', r == '-':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+func plainHeadingText(raw string) string {
+	text := headingLinkPattern.ReplaceAllString(raw, "$1")
+	text = wikiLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		inner := match[2 : len(match)-2]
+		if _, label, ok := strings.Cut(inner, "|"); ok {
+			return strings.TrimSpace(label)
+		}
+		return strings.TrimSpace(inner)
+	})
+	return strings.TrimSpace(headingMarkupReplace.Replace(text))
+}
+
+type anchorSet map[string]int
+
+func (s anchorSet) unique(text string) string {
+	base := headingAnchor(text)
+	if base == "" {
+		base = "section"
+	}
+	anchor := base
+	if n, ok := s[base]; ok {
+		for {
+			n++
+			anchor = fmt.Sprintf("%s-%d", base, n)
+			if _, taken := s[anchor]; !taken {
+				break
+			}
+		}
+		s[base] = n
+	}
+	s[anchor] = 0
+	return anchor
+}
+
+func extractHeadings(body string) []docHeading {
+	var headings []docHeading
+	anchors := anchorSet{}
+	lines := strings.Split(body, "\n")
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceOpenPattern.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			continue
+		}
+		if m := atxHeadingPattern.FindStringSubmatch(line); m != nil {
+			text := plainHeadingText(m[2])
+			headings = append(headings, docHeading{Level: len(m[1]), Text: text, Anchor: anchors.unique(text), Line: i + 1})
+			continue
+		}
+		if strings.TrimSpace(line) == "" || i+1 >= len(lines) {
+			continue
+		}
+		if m := setextUnderlineRE.FindStringSubmatch(strings.TrimRight(lines[i+1], "\r")); m != nil && !strings.HasPrefix(strings.TrimSpace(line), "- ") {
+			level := 1
+			if strings.HasPrefix(m[1], "-") {
+				level = 2
+			}
+			text := plainHeadingText(line)
+			headings = append(headings, docHeading{Level: level, Text: text, Anchor: anchors.unique(text), Line: i + 1})
+			i++
+		}
+	}
+	return headings
+}
+
+type documentOutlineResponse struct {
+	DocID    string       `json:"doc_id"`
+	Slug     string       `json:"slug"`
+	Headings []docHeading `json:"headings"`
+}
+
+func documentHeadings(raw string) []docHeading {
+	body := stripFrontMatter(raw)
+	offset := strings.Count(raw[:len(raw)-len(body)], "\n")
+	headings := extractHeadings(body)
+	for i := range headings {
+		headings[i].Line += offset
+	}
+	return headings
+}
+
+func headingsText(headings []docHeading) string {
+	texts := make([]string, 0, len(headings))
+	for _, heading := range headings {
+		texts = append(texts, heading.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func storeDocumentHeadings(db sqlExecer, docID string, headings []docHeading) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM document_headings WHERE doc_id = ?`, docID); err != nil {
+		log.Printf("clear headings %s: %v", docID, err)
+		return
+	}
+	for i, heading := range headings {
+		if _, err := db.Exec(`INSERT INTO document_headings(doc_id,position,level,text,anchor,line) VALUES(?,?,?,?,?,?)`,
+			docID, i, heading.Level, heading.Text, heading.Anchor, heading.Line); err != nil {
+			log.Printf("insert heading %s: %v", docID, err)
+		}
+	}
+}
+
+func loadDocumentHeadings(db *sql.DB, docID string) ([]docHeading, error) {
+	rows, err := db.Query(`SELECT level,text,anchor,line FROM document_headings WHERE doc_id = ? ORDER BY position`, docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []docHeading{}
+	for rows.Next() {
+		var h docHeading
+		if err := rows.Scan(&h.Level, &h.Text, &h.Anchor, &h.Line); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+func documentOutlineHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		var docID sql.NullString
+		err := db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&docID)
+		if err == sql.ErrNoRows {
+			if target, aliasID, ok := resolveSlugAlias(db, slug); ok {
+				slug = target
+				docID = sql.NullString{String: aliasID, Valid: true}
+				err = nil
+			}
+		}
+		if err == sql.ErrNoRows || (err == nil && docID.String == "") {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		headings, err := loadDocumentHeadings(db, docID.String)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, documentOutlineResponse{DocID: docID.String, Slug: slug, Headings: headings})
+	}
+}
@@ -25,7 +25,9 @@ type scannedDoc struct {
 	updatedAt string
 	body      string
 	raw       string
-	links     []string
+	links     []docLinkToken
+	aliases   []string
+	meta      DocumentMetadata
 }
 
 const contentIndexMetaKey = "content_index_last_sync"
@@ -147,6 +149,8 @@ func SyncContentIndex(db *sql.DB) error {
 				updatedAt: updated.Format(time.RFC3339),
 				body:      body,
 				raw:       content,
+				aliases:   meta.Aliases,
+				meta:      meta,
 			})
 			return nil
 		})
@@ -186,9 +190,16 @@ func SyncContentIndex(db *sql.DB) error {
 	for _, doc := range scans {
 		slugToDocID[doc.slug] = doc.docID
 	}
+	for _, doc := range scans {
+		for _, alias := range doc.aliases {
+			if _, ok := slugToDocID[alias]; !ok {
+				slugToDocID[alias] = doc.docID
+			}
+		}
+	}
 
 	for i := range scans {
-		scans[i].links = resolveDocLinkIDs(extractDocLinkTokens(scans[i].body), slugToDocID, scans[i].docID)
+		scans[i].links = extractDocLinkTokens(scans[i].body)
 	}
 
 	for _, doc := range scans {
@@ -196,10 +207,10 @@ func SyncContentIndex(db *sql.DB) error {
 		if doc.parent != "" {
 			parentVal = sql.NullString{String: doc.parent, Valid: true}
 		}
-		result, err := db.Exec(`INSERT INTO documents(doc_id,slug,title,path,parent_slug,status,owner,created_at,updated_at,is_home,links)
-			VALUES(?,?,?,?,?,?,?,?,?,?,?)
-			ON CONFLICT(slug) DO UPDATE SET doc_id=excluded.doc_id, path=excluded.path, parent_slug=excluded.parent_slug, status=excluded.status, owner=excluded.owner, updated_at=excluded.updated_at, links=excluded.links;`,
-			doc.docID, doc.slug, doc.title, doc.path, parentVal, doc.status, doc.owner, doc.updatedAt, doc.updatedAt, 0, idsToJSON(doc.links))
+		result, err := db.Exec(`INSERT INTO documents(doc_id,slug,title,path,parent_slug,status,owner,created_at,updated_at,is_home)
+			VALUES(?,?,?,?,?,?,?,?,?,?)
+			ON CONFLICT(slug) DO UPDATE SET doc_id=excluded.doc_id, path=excluded.path, parent_slug=excluded.parent_slug, status=excluded.status, owner=excluded.owner, updated_at=excluded.updated_at;`,
+			doc.docID, doc.slug, doc.title, doc.path, parentVal, doc.status, doc.owner, doc.updatedAt, doc.updatedAt, 0)
 		if err != nil {
 			log.Printf("sync document %s: %v", doc.slug, err)
 			continue
@@ -208,7 +219,33 @@ func SyncContentIndex(db *sql.DB) error {
 		log.Printf("[SyncContentIndex] Inserted/updated document %s (rows affected: %d)", doc.slug, rowsAffected)
 
 		db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, doc.docID)
-		db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body) VALUES((SELECT id FROM documents WHERE doc_id = ?),?,?,?)`, doc.docID, doc.slug, doc.title, doc.raw)
+		headings := documentHeadings(doc.raw)
+		db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body,headings) VALUES((SELECT id FROM documents WHERE doc_id = ?),?,?,?,?)`, doc.docID, doc.slug, doc.title, doc.raw, headingsText(headings))
+		syncDocumentAliases(db, doc.docID, doc.slug, doc.aliases)
+		storeDocumentMetadata(db, doc.docID, doc.meta)
+		storeDocumentLinks(db, doc.docID, doc.links, slugToDocID)
+		storeDocumentHeadings(db, doc.docID, headings)
+		reanchorComments(db, doc.docID, doc.body)
+	}
+	for _, doc := range scans {
+		for _, token := range doc.links {
+			if token.Kind == "embed" {
+				db.Exec(`UPDATE documents_fts SET body = ? WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, expandEmbeds(db, doc.docID, doc.raw), doc.docID)
+				break
+			}
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM document_links WHERE source_id NOT IN (SELECT doc_id FROM documents WHERE doc_id IS NOT NULL)`); err != nil {
+		log.Printf("cleanup document_links: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM document_tags WHERE doc_id NOT IN (SELECT doc_id FROM documents WHERE doc_id IS NOT NULL)`); err != nil {
+		log.Printf("cleanup document_tags: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM document_headings WHERE doc_id NOT IN (SELECT doc_id FROM documents WHERE doc_id IS NOT NULL)`); err != nil {
+		log.Printf("cleanup document_headings: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM document_aliases WHERE doc_id NOT IN (SELECT doc_id FROM documents WHERE doc_id IS NOT NULL)`); err != nil {
+		log.Printf("cleanup document_aliases: %v", err)
 	}
 
 	
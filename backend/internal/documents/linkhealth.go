@@ -0,0 +1,331 @@
+package documents
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"atlas/internal/httpx"
+)
+
+var uploadRefPattern = regexp.MustCompile(`/uploads/([A-Za-z0-9][A-Za-z0-9._\-]*)`)
+
+const uploadsDir = "./data/uploads"
+
+type uploadRef struct {
+	Name string
+	Line int
+}
+
+type linkHealthEntry struct {
+	docID   string
+	slug    string
+	title   string
+	modTime time.Time
+	links   []docLinkToken
+	anchors map[string]struct{}
+	uploads []uploadRef
+}
+
+type linkHealthCache struct {
+	mu      sync.Mutex
+	entries map[string]*linkHealthEntry
+}
+
+var linkHealth = &linkHealthCache{entries: make(map[string]*linkHealthEntry)}
+
+type brokenLinkRow struct {
+	SourceSlug  string `json:"source_slug"`
+	SourceTitle string `json:"source_title"`
+	Line        int    `json:"line"`
+	Kind        string `json:"kind"`
+	Target      string `json:"target"`
+	Anchor      string `json:"anchor,omitempty"`
+}
+
+type orphanRow struct {
+	DocID string `json:"doc_id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type uploadRow struct {
+	File        string `json:"file"`
+	SourceSlug  string `json:"source_slug,omitempty"`
+	SourceTitle string `json:"source_title,omitempty"`
+	Line        int    `json:"line,omitempty"`
+}
+
+type linkHealthReport struct {
+	GeneratedAt     string          `json:"generated_at"`
+	BrokenLinks     []brokenLinkRow `json:"broken_links"`
+	BrokenAnchors   []brokenLinkRow `json:"broken_anchors"`
+	Orphans         []orphanRow     `json:"orphans"`
+	MissingUploads  []uploadRow     `json:"missing_uploads"`
+	UnusedUploads   []uploadRow     `json:"unused_uploads"`
+	DocumentsParsed int             `json:"documents_parsed"`
+}
+
+func parseLinkHealthEntry(docID, slug, raw string, modTime time.Time) *linkHealthEntry {
+	body := stripFrontMatter(raw)
+	offset := strings.Count(raw[:len(raw)-len(body)], "\n")
+	entry := &linkHealthEntry{
+		docID:   docID,
+		slug:    slug,
+		title:   extractTitle(raw),
+		modTime: modTime,
+		anchors: make(map[string]struct{}),
+	}
+	for _, heading := range extractHeadings(body) {
+		entry.anchors[heading.Anchor] = struct{}{}
+	}
+	for _, token := range extractDocLinkTokens(body) {
+		token.Line += offset
+		entry.links = append(entry.links, token)
+	}
+	lines := newLineIndex(body)
+	for _, loc := range uploadRefPattern.FindAllStringSubmatchIndex(body, -1) {
+		entry.uploads = append(entry.uploads, uploadRef{Name: body[loc[2]:loc[3]], Line: lines.lineAt(loc[0]) + offset})
+	}
+	return entry
+}
+
+func (c *linkHealthCache) update(path, docID, slug, raw string) {
+	modTime := time.Now()
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+	entry := parseLinkHealthEntry(docID, slug, raw, modTime)
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.mu.Unlock()
+}
+
+func (c *linkHealthCache) refresh(db *sql.DB) (map[string]*linkHealthEntry, error) {
+	rows, err := db.Query(`SELECT doc_id,slug,path FROM documents`)
+	if err != nil {
+		return nil, err
+	}
+	type docRow struct{ docID, slug, path string }
+	var docs []docRow
+	for rows.Next() {
+		var row docRow
+		var docID sql.NullString
+		if err := rows.Scan(&docID, &row.slug, &row.path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		row.docID = docID.String
+		docs = append(docs, row)
+	}
+	rows.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current := make(map[string]*linkHealthEntry, len(docs))
+	for _, doc := range docs {
+		fi, err := os.Stat(doc.path)
+		if err != nil {
+			continue
+		}
+		entry := c.entries[doc.path]
+		if entry == nil || !entry.modTime.Equal(fi.ModTime()) || entry.slug != doc.slug || entry.docID != doc.docID {
+			raw, err := os.ReadFile(doc.path)
+			if err != nil {
+				continue
+			}
+			entry = parseLinkHealthEntry(doc.docID, doc.slug, string(raw), fi.ModTime())
+		}
+		current[doc.path] = entry
+	}
+	c.entries = current
+	out := make(map[string]*linkHealthEntry, len(current))
+	for path, entry := range current {
+		out[path] = entry
+	}
+	return out, nil
+}
+
+func buildLinkHealthReport(db *sql.DB) (linkHealthReport, error) {
+	report := linkHealthReport{
+		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		BrokenLinks:    []brokenLinkRow{},
+		BrokenAnchors:  []brokenLinkRow{},
+		Orphans:        []orphanRow{},
+		MissingUploads: []uploadRow{},
+		UnusedUploads:  []uploadRow{},
+	}
+	entries, err := linkHealth.refresh(db)
+	if err != nil {
+		return report, err
+	}
+	report.DocumentsParsed = len(entries)
+
+	slugToID := make(map[string]string, len(entries))
+	byID := make(map[string]*linkHealthEntry, len(entries))
+	for _, entry := range entries {
+		slugToID[entry.slug] = entry.docID
+		byID[entry.docID] = entry
+	}
+	if rows, err := db.Query(`SELECT alias,doc_id FROM document_aliases`); err == nil {
+		for rows.Next() {
+			var alias, docID string
+			if rows.Scan(&alias, &docID) == nil {
+				if _, ok := slugToID[alias]; !ok {
+					slugToID[alias] = docID
+				}
+			}
+		}
+		rows.Close()
+	}
+
+	linkedIDs := make(map[string]struct{})
+	referenced := make(map[string]struct{})
+	uploadsOnDisk := listUploadFiles()
+	for _, entry := range entries {
+		for _, token := range entry.links {
+			target := token.ID
+			resolved := ""
+			if token.ID != "" {
+				if _, ok := byID[token.ID]; ok {
+					resolved = token.ID
+				}
+				target = "doc:" + token.ID
+			} else {
+				target = token.Slug
+				resolved = slugToID[token.Slug]
+			}
+			if resolved == "" {
+				report.BrokenLinks = append(report.BrokenLinks, brokenLinkRow{
+					SourceSlug:  entry.slug,
+					SourceTitle: entry.title,
+					Line:        token.Line,
+					Kind:        token.Kind,
+					Target:      target,
+				})
+				continue
+			}
+			if resolved != entry.docID {
+				linkedIDs[resolved] = struct{}{}
+			}
+			if token.Anchor == "" {
+				continue
+			}
+			if targetEntry, ok := byID[resolved]; ok {
+				if _, ok := targetEntry.anchors[token.Anchor]; !ok {
+					report.BrokenAnchors = append(report.BrokenAnchors, brokenLinkRow{
+						SourceSlug:  entry.slug,
+						SourceTitle: entry.title,
+						Line:        token.Line,
+						Kind:        token.Kind,
+						Target:      target,
+						Anchor:      token.Anchor,
+					})
+				}
+			}
+		}
+		for _, ref := range entry.uploads {
+			referenced[ref.Name] = struct{}{}
+			if _, ok := uploadsOnDisk[ref.Name]; !ok {
+				report.MissingUploads = append(report.MissingUploads, uploadRow{
+					File:        "/uploads/" + ref.Name,
+					SourceSlug:  entry.slug,
+					SourceTitle: entry.title,
+					Line:        ref.Line,
+				})
+			}
+		}
+	}
+
+	var appIcon sql.NullString
+	_ = db.QueryRow(`SELECT value FROM meta WHERE key = 'app_icon'`).Scan(&appIcon)
+	referenced[strings.TrimPrefix(appIcon.String, "/uploads/")] = struct{}{}
+	for name := range uploadsOnDisk {
+		if _, ok := referenced[name]; !ok {
+			report.UnusedUploads = append(report.UnusedUploads, uploadRow{File: "/uploads/" + name})
+		}
+	}
+
+	var startPage sql.NullString
+	_ = db.QueryRow(`SELECT value FROM meta WHERE key = 'start_page'`).Scan(&startPage)
+	rows, err := db.Query(`SELECT doc_id,slug,title FROM documents WHERE (parent_slug IS NULL OR parent_slug = '') AND slug != ?`, startPage.String)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row orphanRow
+		var docID, title sql.NullString
+		if err := rows.Scan(&docID, &row.Slug, &title); err != nil {
+			return report, err
+		}
+		row.DocID = docID.String
+		if _, ok := linkedIDs[row.DocID]; ok {
+			continue
+		}
+		row.Title = title.String
+		if row.Title == "" {
+			row.Title = humanizeSlug(row.Slug)
+		}
+		report.Orphans = append(report.Orphans, row)
+	}
+
+	sort.Slice(report.BrokenLinks, func(i, j int) bool {
+		a, b := report.BrokenLinks[i], report.BrokenLinks[j]
+		if a.SourceSlug != b.SourceSlug {
+			return a.SourceSlug < b.SourceSlug
+		}
+		return a.Line < b.Line
+	})
+	sort.Slice(report.BrokenAnchors, func(i, j int) bool {
+		a, b := report.BrokenAnchors[i], report.BrokenAnchors[j]
+		if a.SourceSlug != b.SourceSlug {
+			return a.SourceSlug < b.SourceSlug
+		}
+		return a.Line < b.Line
+	})
+	sort.Slice(report.MissingUploads, func(i, j int) bool {
+		a, b := report.MissingUploads[i], report.MissingUploads[j]
+		if a.SourceSlug != b.SourceSlug {
+			return a.SourceSlug < b.SourceSlug
+		}
+		return a.Line < b.Line
+	})
+	sort.Slice(report.UnusedUploads, func(i, j int) bool {
+		return report.UnusedUploads[i].File < report.UnusedUploads[j].File
+	})
+	return report, nil
+}
+
+func listUploadFiles() map[string]struct{} {
+	out := make(map[string]struct{})
+	entries, err := os.ReadDir(filepath.Clean(uploadsDir))
+	if err != nil {
+		return out
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		out[e.Name()] = struct{}{}
+	}
+	return out
+}
+
+func linkHealthHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		report, err := buildLinkHealthReport(db)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "link health failed")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,119 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func linkedDocIDsColumn(docColumn string) string {
+	return fmt.Sprintf(`(SELECT json_group_array(DISTINCT target_id ORDER BY target_id) FROM document_links WHERE source_id = %s AND target_id IS NOT NULL)`, docColumn)
+}
+
+func storeDocumentLinks(db sqlExecer, sourceID string, tokens []docLinkToken, slugMap map[string]string) {
+	if strings.TrimSpace(sourceID) == "" {
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM document_links WHERE source_id = ?`, sourceID); err != nil {
+		log.Printf("clear links %s: %v", sourceID, err)
+		return
+	}
+	seen := make(map[string]struct{})
+	for _, token := range tokens {
+		var targetID, targetSlug sql.NullString
+		if token.ID != "" {
+			targetID = sql.NullString{String: token.ID, Valid: true}
+		} else if token.Slug != "" {
+			targetSlug = sql.NullString{String: token.Slug, Valid: true}
+			if resolved, ok := slugMap[token.Slug]; ok && resolved != "" {
+				targetID = sql.NullString{String: resolved, Valid: true}
+			}
+		}
+		if targetID.String == sourceID || (!targetID.Valid && !targetSlug.Valid) {
+			continue
+		}
+		kind := token.Kind
+		if kind == "" {
+			kind = "wiki"
+		}
+		key := strings.Join([]string{targetID.String, targetSlug.String, kind, token.Anchor}, "\x00")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		var anchor sql.NullString
+		if token.Anchor != "" {
+			anchor = sql.NullString{String: token.Anchor, Valid: true}
+		}
+		if _, err := db.Exec(`INSERT INTO document_links(source_id,target_id,target_slug,kind,anchor) VALUES(?,?,?,?,?)`, sourceID, targetID, targetSlug, kind, anchor); err != nil {
+			log.Printf("insert link %s: %v", sourceID, err)
+		}
+	}
+}
+
+func resolveLinkSlugs(db *sql.DB, tokens []docLinkToken) map[string]string {
+	slugMap := make(map[string]string)
+	targetSet := make(map[string]struct{})
+	for _, token := range tokens {
+		if token.Slug == "" {
+			continue
+		}
+		targetSet[token.Slug] = struct{}{}
+	}
+	if len(targetSet) == 0 {
+		return slugMap
+	}
+	targetSlugs := make([]string, 0, len(targetSet))
+	args := make([]any, 0, len(targetSet))
+	for target := range targetSet {
+		targetSlugs = append(targetSlugs, target)
+		args = append(args, target)
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT slug,doc_id FROM documents WHERE slug IN (%s)`, placeholders(len(targetSlugs))), args...)
+	if err == nil {
+		for rows.Next() {
+			var existingSlug sql.NullString
+			var existingID sql.NullString
+			if scanErr := rows.Scan(&existingSlug, &existingID); scanErr == nil && existingSlug.Valid {
+				slugMap[existingSlug.String] = existingID.String
+			}
+		}
+		rows.Close()
+	} else {
+		log.Printf("load slug map: %v", err)
+	}
+	for alias, docID := range loadAliasTargets(db, targetSlugs) {
+		if _, ok := slugMap[alias]; !ok {
+			slugMap[alias] = docID
+		}
+	}
+	return slugMap
+}
+
+func resolveGhostLinks(db *sql.DB, docID, slug string, aliases []string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	targets := append([]string{slug}, aliases...)
+	args := []any{docID}
+	for _, target := range targets {
+		args = append(args, target)
+	}
+	query := fmt.Sprintf(`UPDATE document_links SET target_id = ? WHERE target_id IS NULL AND target_slug IN (%s)`, placeholders(len(targets)))
+	if _, err := db.Exec(query, args...); err != nil {
+		log.Printf("resolve ghost links %s: %v", slug, err)
+	}
+}
+
+func detachDocumentLinks(db *sql.DB, docID string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	db.Exec(`DELETE FROM document_links WHERE source_id = ?`, docID)
+	db.Exec(`UPDATE document_links SET target_id = NULL WHERE target_id = ? AND target_slug IS NOT NULL AND target_slug != ''`, docID)
+}
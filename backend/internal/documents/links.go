@@ -7,81 +7,77 @@ import (
 	"strings"
 )
 
-var wikiLinkPattern = regexp.MustCompile(`\[\[([^\]]+)\]\]`)
+var (
+	wikiLinkPattern     = regexp.MustCompile(`\[\[([^\]]+)\]\]`)
+	markdownLinkPattern = regexp.MustCompile(`\]\((/doc/[^)\s]+)((?:\s+"[^"]*")?)\)`)
+)
 
 type docLinkToken struct {
-	ID   string
-	Slug string
+	ID     string
+	Slug   string
+	Anchor string
+	Kind   string
+	Line   int
 }
 
 func extractDocLinkTokens(text string) []docLinkToken {
 	if text == "" {
 		return nil
 	}
+	lines := newLineIndex(text)
 	var tokens []docLinkToken
-	matches := wikiLinkPattern.FindAllStringSubmatch(text, -1)
-	for _, match := range matches {
-		inner := strings.TrimSpace(match[1])
-		if inner == "" {
+	matches := wikiLinkPattern.FindAllStringSubmatchIndex(text, -1)
+	for _, loc := range matches {
+		token, ok := parseWikiTarget(text[loc[2]:loc[3]])
+		if !ok {
 			continue
 		}
-		parts := strings.SplitN(inner, "|", 2)
-		target := strings.TrimSpace(parts[0])
-		if target == "" {
-			continue
+		token.Line = lines.lineAt(loc[0])
+		if loc[0] > 0 && text[loc[0]-1] == '!' {
+			token.Kind = "embed"
 		}
-		lower := strings.ToLower(target)
-		switch {
-		case strings.HasPrefix(lower, "doc:"):
-			id := strings.TrimSpace(target[len("doc:"):])
-			if id != "" {
-				tokens = append(tokens, docLinkToken{ID: id})
-			}
-			continue
-		case strings.HasPrefix(lower, "path:"):
-			slug := normalizeWikiTarget(target[len("path:"):])
-			if slug != "" {
-				tokens = append(tokens, docLinkToken{Slug: slug})
-			}
-			continue
-		default:
-			slug := normalizeWikiTarget(target)
-			if slug != "" {
-				tokens = append(tokens, docLinkToken{Slug: slug})
-			}
+		tokens = append(tokens, token)
+	}
+	for _, loc := range markdownLinkPattern.FindAllStringSubmatchIndex(text, -1) {
+		href := text[loc[2]:loc[3]]
+		if slug := markdownDocLinkSlug(href); slug != "" {
+			tokens = append(tokens, docLinkToken{Slug: slug, Anchor: markdownDocLinkAnchor(href), Kind: "markdown", Line: lines.lineAt(loc[0])})
 		}
 	}
 	return tokens
 }
 
-func resolveDocLinkIDs(tokens []docLinkToken, slugMap map[string]string, skipDocID string) []string {
-	if len(tokens) == 0 {
-		return nil
+func parseWikiTarget(inner string) (docLinkToken, bool) {
+	parts := strings.SplitN(strings.TrimSpace(inner), "|", 2)
+	target, anchor, _ := strings.Cut(strings.TrimSpace(parts[0]), "#")
+	token := docLinkToken{Anchor: headingAnchor(anchor), Kind: "wiki"}
+	target = strings.TrimSpace(target)
+	lower := strings.ToLower(target)
+	switch {
+	case strings.HasPrefix(lower, "doc:"):
+		token.ID = strings.TrimSpace(target[len("doc:"):])
+	case strings.HasPrefix(lower, "path:"):
+		token.Slug = normalizeWikiTarget(target[len("path:"):])
+	default:
+		token.Slug = normalizeWikiTarget(target)
 	}
-	seen := make(map[string]struct{})
-	for _, token := range tokens {
-		var candidate string
-		if token.ID != "" {
-			candidate = token.ID
-		} else if token.Slug != "" && slugMap != nil {
-			if resolved, ok := slugMap[token.Slug]; ok {
-				candidate = resolved
-			}
-		}
-		if candidate == "" || candidate == skipDocID {
-			continue
+	return token, token.ID != "" || token.Slug != ""
+}
+
+type lineIndex []int
+
+func newLineIndex(text string) lineIndex {
+	starts := lineIndex{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
 		}
-		seen[candidate] = struct{}{}
-	}
-	if len(seen) == 0 {
-		return nil
 	}
-	result := make([]string, 0, len(seen))
-	for id := range seen {
-		result = append(result, id)
-	}
-	sort.Strings(result)
-	return result
+	return starts
+}
+
+func (l lineIndex) lineAt(offset int) int {
+	return sort.SearchInts(l, offset+1)
 }
 
 func normalizeWikiTarget(raw string) string {
@@ -96,3 +92,77 @@ func normalizeWikiTarget(raw string) string {
 	slug = strings.ReplaceAll(slug, "\\", "/")
 	return slug
 }
+
+func splitLinkSuffix(target string) (string, string) {
+	if idx := strings.IndexAny(target, "#?"); idx >= 0 {
+		return target[:idx], target[idx:]
+	}
+	return target, ""
+}
+
+func markdownDocLinkSlug(href string) string {
+	target, _ := splitLinkSuffix(strings.TrimPrefix(href, "/doc/"))
+	return normalizeWikiTarget(target)
+}
+
+func markdownDocLinkAnchor(href string) string {
+	_, fragment, ok := strings.Cut(href, "#")
+	if !ok {
+		return ""
+	}
+	if v, err := url.PathUnescape(fragment); err == nil {
+		fragment = v
+	}
+	return headingAnchor(fragment)
+}
+
+func escapeSlugPath(slug string) string {
+	parts := strings.Split(slug, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func rewriteDocLinkTargets(text string, renames map[string]string) (string, bool) {
+	if text == "" || len(renames) == 0 {
+		return text, false
+	}
+	changed := false
+	out := wikiLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		inner := match[2 : len(match)-2]
+		target, label, hasLabel := strings.Cut(inner, "|")
+		trimmed := strings.TrimSpace(target)
+		lower := strings.ToLower(trimmed)
+		prefix := ""
+		switch {
+		case strings.HasPrefix(lower, "doc:"):
+			return match
+		case strings.HasPrefix(lower, "path:"):
+			prefix = trimmed[:len("path:")]
+			trimmed = trimmed[len("path:"):]
+		}
+		slugPart, suffix := splitLinkSuffix(trimmed)
+		next, ok := renames[normalizeWikiTarget(slugPart)]
+		if !ok {
+			return match
+		}
+		changed = true
+		rebuilt := "[[" + prefix + next + suffix
+		if hasLabel {
+			rebuilt += "|" + label
+		}
+		return rebuilt + "]]"
+	})
+	out = markdownLinkPattern.ReplaceAllStringFunc(out, func(match string) string {
+		sub := markdownLinkPattern.FindStringSubmatch(match)
+		target, suffix := splitLinkSuffix(strings.TrimPrefix(sub[1], "/doc/"))
+		next, ok := renames[normalizeWikiTarget(target)]
+		if !ok {
+			return match
+		}
+		changed = true
+		return "](/doc/" + escapeSlugPath(next) + suffix + sub[2] + ")"
+	})
+	return out, changed
+}
@@ -0,0 +1,220 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultLockMinutes = 60
+	maxLockMinutes     = 7 * 24 * 60
+)
+
+// lockNow matches the RFC 3339 form of expires_at so the two compare as text.
+const lockNow = `strftime('%Y-%m-%dT%H:%M:%SZ','now')`
+
+type documentLock struct {
+	HolderID  int    `json:"holder_id"`
+	Holder    string `json:"holder"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type lockedResponse struct {
+	Error map[string]string `json:"error"`
+	Slug  string            `json:"slug"`
+	Lock  documentLock      `json:"lock"`
+}
+
+// lockColumn selects the active lock on docColumn as a JSON object, or NULL.
+func lockColumn(docColumn string) string {
+	return `(SELECT json_object('holder_id',holder_id,'holder',holder,'reason',reason,'created_at',created_at,'expires_at',expires_at) FROM document_locks WHERE doc_id = ` + docColumn + ` AND expires_at > ` + lockNow + `)`
+}
+
+func lockFromJSON(raw sql.NullString) *documentLock {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var lock documentLock
+	if json.Unmarshal([]byte(raw.String), &lock) != nil {
+		return nil
+	}
+	return &lock
+}
+
+func loadDocumentLock(db *sql.DB, docID string) *documentLock {
+	if strings.TrimSpace(docID) == "" {
+		return nil
+	}
+	var raw sql.NullString
+	if db.QueryRow(`SELECT `+lockColumn("?"), docID).Scan(&raw) != nil {
+		return nil
+	}
+	return lockFromJSON(raw)
+}
+
+// checkDocumentLock writes 423 when slug, or a descendant when subtree is
+// set, is locked by someone other than the caller.
+func checkDocumentLock(w http.ResponseWriter, r *http.Request, db *sql.DB, slug string, subtree bool) bool {
+	resp, locked := lockedByOther(db, auth.UserFromContext(r), slug, subtree)
+	if !locked {
+		return true
+	}
+	httpx.WriteJSON(w, http.StatusLocked, resp)
+	return false
+}
+
+// lockedByOther reports the lock on slug, or a descendant when subtree is
+// set, held by someone other than u.
+func lockedByOther(db *sql.DB, u *auth.User, slug string, subtree bool) (lockedResponse, bool) {
+	userID := 0
+	if u != nil {
+		userID = u.ID
+	}
+	query := `SELECT d.slug, l.holder_id, l.holder, COALESCE(l.reason,''), l.created_at, l.expires_at
+		FROM document_locks l JOIN documents d ON d.doc_id = l.doc_id
+		WHERE l.holder_id != ? AND l.expires_at > ` + lockNow + ` AND (d.slug = ?`
+	args := []any{userID, slug}
+	if subtree {
+		query += ` OR d.slug LIKE ?`
+		args = append(args, slug+"/%")
+	}
+	query += `) ORDER BY d.slug LIMIT 1`
+	var resp lockedResponse
+	lock := &resp.Lock
+	err := db.QueryRow(query, args...).Scan(&resp.Slug, &lock.HolderID, &lock.Holder, &lock.Reason, &lock.CreatedAt, &lock.ExpiresAt)
+	if err != nil {
+		return lockedResponse{}, false
+	}
+	resp.Error = map[string]string{
+		"code":    "LOCKED",
+		"message": "document is locked by " + lock.Holder,
+	}
+	return resp, true
+}
+
+func documentIDForSlug(db *sql.DB, slug string) (string, bool) {
+	var docID sql.NullString
+	if err := db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&docID); err != nil || strings.TrimSpace(docID.String) == "" {
+		return "", false
+	}
+	return docID.String, true
+}
+
+// documentLockHandler checks slug out to the caller. Holding the lock already
+// renews it with the new reason and expiry.
+func documentLockHandler(db *sql.DB) http.HandlerFunc {
+	type lockRequest struct {
+		Reason  string `json:"reason"`
+		Minutes int    `json:"minutes"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		var req lockRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				docErr(w, http.StatusBadRequest, "invalid request")
+				return
+			}
+		}
+		if req.Minutes == 0 {
+			req.Minutes = defaultLockMinutes
+		}
+		if req.Minutes < 0 || req.Minutes > maxLockMinutes {
+			docErr(w, http.StatusBadRequest, "invalid lock duration")
+			return
+		}
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !checkDocumentLock(w, r, db, slug, false) {
+			return
+		}
+		u := auth.UserFromContext(r)
+		now := time.Now().UTC()
+		lock := documentLock{
+			HolderID:  u.ID,
+			Holder:    u.Username,
+			Reason:    strings.TrimSpace(req.Reason),
+			CreatedAt: now.Format(time.RFC3339),
+			ExpiresAt: now.Add(time.Duration(req.Minutes) * time.Minute).Format(time.RFC3339),
+		}
+		_, err := db.Exec(`INSERT INTO document_locks(doc_id,holder_id,holder,reason,created_at,expires_at) VALUES(?,?,?,?,?,?)
+			ON CONFLICT(doc_id) DO UPDATE SET holder_id=excluded.holder_id, holder=excluded.holder, reason=excluded.reason,
+				created_at=CASE WHEN document_locks.holder_id = excluded.holder_id AND document_locks.expires_at > `+lockNow+` THEN document_locks.created_at ELSE excluded.created_at END,
+				expires_at=excluded.expires_at`,
+			docID, lock.HolderID, lock.Holder, lock.Reason, lock.CreatedAt, lock.ExpiresAt)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "lock failed")
+			return
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, "lock_document", slug)
+		if current := loadDocumentLock(db, docID); current != nil {
+			lock = *current
+		}
+		events.Publish(events.DocumentLocked, slug, u.Username, lock)
+		events.Publish(events.TreeChanged, slug, u.Username, nil)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"slug": slug, "lock": lock})
+	}
+}
+
+// documentUnlockHandler releases the caller's lock on slug. Admins and owners
+// can break another user's lock with ?force=1.
+func documentUnlockHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		u := auth.UserFromContext(r)
+		lock := loadDocumentLock(db, docID)
+		if lock == nil {
+			db.Exec(`DELETE FROM document_locks WHERE doc_id = ?`, docID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		action := "unlock_document"
+		if lock.HolderID != u.ID {
+			force := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("force")))
+			if force != "1" && force != "true" {
+				checkDocumentLock(w, r, db, slug, false)
+				return
+			}
+			if u.Role != "Admin" && u.Role != "Owner" {
+				docErr(w, http.StatusForbidden, "only admins can break a lock")
+				return
+			}
+			action = "break_lock"
+		}
+		if _, err := db.Exec(`DELETE FROM document_locks WHERE doc_id = ?`, docID); err != nil {
+			docErr(w, http.StatusInternalServerError, "unlock failed")
+			return
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, action, slug)
+		events.Publish(events.DocumentUnlocked, slug, u.Username, map[string]any{"holder": lock.Holder, "broken": action == "break_lock"})
+		events.Publish(events.TreeChanged, slug, u.Username, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
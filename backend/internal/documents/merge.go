@@ -0,0 +1,209 @@
+package documents
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+type mergeConflict struct {
+	Line   int      `json:"line"`
+	Base   []string `json:"base"`
+	Ours   []string `json:"ours"`
+	Theirs []string `json:"theirs"`
+}
+
+type mergeResult struct {
+	Merged    string          `json:"merged"`
+	Conflicts []mergeConflict `json:"conflicts"`
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineMatches maps each line of a to the index of the line of b it is
+// aligned with, or -1 when it was removed.
+func lineMatches(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	dmp := diffmatchpatch.New()
+	ca, cb, _ := dmp.DiffLinesToChars(strings.Join(a, ""), strings.Join(b, ""))
+	i, j := 0, 0
+	for _, diff := range dmp.DiffMain(ca, cb, false) {
+		n := utf8.RuneCountInString(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				matches[i+k] = j + k
+			}
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			i += n
+		case diffmatchpatch.DiffInsert:
+			j += n
+		}
+	}
+	return matches
+}
+
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeThreeWay merges ours and theirs, both derived from base, line by line.
+// Regions changed on only one side are taken from that side; regions changed
+// differently on both sides are reported as conflicts and written to Merged
+// with conflict markers.
+func mergeThreeWay(base, ours, theirs string) mergeResult {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	mo, mt := lineMatches(b, o), lineMatches(b, t)
+	result := mergeResult{Conflicts: []mergeConflict{}}
+	var out []string
+
+	emit := func(bc, oc, tc []string) {
+		switch {
+		case sameLines(oc, bc):
+			out = append(out, tc...)
+		case sameLines(tc, bc), sameLines(oc, tc):
+			out = append(out, oc...)
+		default:
+			result.Conflicts = append(result.Conflicts, mergeConflict{Line: len(out) + 1, Base: bc, Ours: oc, Theirs: tc})
+			out = append(out, "<<<<<<< draft\n")
+			out = append(out, withTrailingNewline(oc)...)
+			out = append(out, "=======\n")
+			out = append(out, withTrailingNewline(tc)...)
+			out = append(out, ">>>>>>> current\n")
+		}
+	}
+
+	i, oi, ti := 0, 0, 0
+	for i < len(b) {
+		if mo[i] == oi && mt[i] == ti {
+			out = append(out, b[i])
+			i, oi, ti = i+1, oi+1, ti+1
+			continue
+		}
+		k := i
+		for k < len(b) && (mo[k] < oi || mt[k] < ti) {
+			k++
+		}
+		if k == len(b) {
+			break
+		}
+		emit(b[i:k], o[oi:mo[k]], t[ti:mt[k]])
+		i, oi, ti = k, mo[k], mt[k]
+	}
+	if i < len(b) || oi < len(o) || ti < len(t) {
+		emit(b[i:], o[oi:], t[ti:])
+	}
+	result.Merged = strings.Join(out, "")
+	return result
+}
+
+func withTrailingNewline(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	out := append([]string{}, lines...)
+	out[len(out)-1] += "\n"
+	return out
+}
+
+type draftBase struct {
+	docID   string
+	hash    string
+	content string
+}
+
+type mergeConflictResponse struct {
+	Error       map[string]string `json:"error"`
+	BaseHash    string            `json:"base_hash"`
+	CurrentHash string            `json:"current_hash"`
+	mergeResult
+}
+
+func loadDraftBase(db *sql.DB, userID int, slug string) (draftBase, bool) {
+	var base draftBase
+	var docID sql.NullString
+	err := db.QueryRow(`SELECT doc_id,base_hash,content FROM draft_bases WHERE user_id = ? AND slug = ?`, userID, slug).Scan(&docID, &base.hash, &base.content)
+	base.docID = docID.String
+	return base, err == nil
+}
+
+// recordDraftBase remembers the document revision a draft started from. It is
+// recorded once, on the first save of a draft of an existing document.
+func recordDraftBase(db *sql.DB, userID int, slug, draft string) {
+	if _, ok := loadDraftBase(db, userID, slug); ok {
+		return
+	}
+	var docID, path string
+	err := sql.ErrNoRows
+	if meta, _ := parseDocumentMetadata(draft); meta.ID != "" {
+		err = db.QueryRow(`SELECT doc_id,path FROM documents WHERE doc_id = ?`, meta.ID).Scan(&docID, &path)
+	}
+	if err == sql.ErrNoRows {
+		err = db.QueryRow(`SELECT COALESCE(doc_id,''),path FROM documents WHERE slug = ?`, slug).Scan(&docID, &path)
+	}
+	if err != nil {
+		return
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if _, err := db.Exec(`INSERT OR IGNORE INTO draft_bases(user_id,slug,doc_id,base_hash,content,created_at) VALUES(?,?,?,?,?,?)`,
+		userID, slug, docID, contentHash(current), string(current), time.Now().UTC().Format(time.RFC3339)); err != nil {
+		log.Printf("record draft base %s: %v", slug, err)
+	}
+}
+
+// rebaseDraft rebases a save to slug made from a draft started at base onto
+// the current document when the document changed since. resolved equal to
+// the current hash marks conflicts as resolved.
+func rebaseDraft(db *sql.DB, base draftBase, slug string, body []byte, resolved string) ([]byte, *mergeConflictResponse) {
+	current, exists := currentDocumentContent(db, slug)
+	if !exists {
+		return body, nil
+	}
+	currentHash := contentHash(current)
+	if currentHash == base.hash || resolved == currentHash {
+		return body, nil
+	}
+	result := mergeThreeWay(base.content, string(body), string(current))
+	if len(result.Conflicts) > 0 {
+		return nil, &mergeConflictResponse{
+			Error: map[string]string{
+				"code":    "MERGE_CONFLICT",
+				"message": "the document changed since this draft was started",
+			},
+			BaseHash:    base.hash,
+			CurrentHash: currentHash,
+			mergeResult: result,
+		}
+	}
+	return []byte(result.Merged), nil
+}
@@ -0,0 +1,153 @@
+package documents
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeThreeWay(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		merged    string
+		conflicts []mergeConflict
+	}{
+		{
+			name:   "only ours changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nc\n",
+			merged: "a\nB\nc\n",
+		},
+		{
+			name:   "only theirs changed",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nC\n",
+			merged: "a\nb\nC\n",
+		},
+		{
+			name:   "separate edits on both sides",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			merged: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:   "identical edits on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nX\nc\n",
+			theirs: "a\nX\nc\n",
+			merged: "a\nX\nc\n",
+		},
+		{
+			name:   "identical deletions on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nc\n",
+			theirs: "a\nc\n",
+			merged: "a\nc\n",
+		},
+		{
+			name:   "different edits to the same line",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nX\nc\n",
+			merged: "a\n<<<<<<< draft\nB\n=======\nX\n>>>>>>> current\nc\n",
+			conflicts: []mergeConflict{
+				{Line: 2, Base: []string{"b\n"}, Ours: []string{"B\n"}, Theirs: []string{"X\n"}},
+			},
+		},
+		{
+			name:   "adjacent edits conflict",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nC\n",
+			merged: "a\n<<<<<<< draft\nB\nc\n=======\nb\nC\n>>>>>>> current\n",
+			conflicts: []mergeConflict{
+				{Line: 2, Base: []string{"b\n", "c\n"}, Ours: []string{"B\n", "c\n"}, Theirs: []string{"b\n", "C\n"}},
+			},
+		},
+		{
+			name:   "insert at end of file",
+			base:   "a\nb\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\n",
+			merged: "a\nb\nc\n",
+		},
+		{
+			name:   "different inserts at end of file",
+			base:   "a\n",
+			ours:   "a\nb\n",
+			theirs: "a\nc\n",
+			merged: "a\n<<<<<<< draft\nb\n=======\nc\n>>>>>>> current\n",
+			conflicts: []mergeConflict{
+				{Line: 2, Base: []string{}, Ours: []string{"b\n"}, Theirs: []string{"c\n"}},
+			},
+		},
+		{
+			name:   "empty base with one side",
+			base:   "",
+			ours:   "",
+			theirs: "x\ny\n",
+			merged: "x\ny\n",
+		},
+		{
+			name:   "empty base with both sides",
+			base:   "",
+			ours:   "x\n",
+			theirs: "y\n",
+			merged: "<<<<<<< draft\nx\n=======\ny\n>>>>>>> current\n",
+			conflicts: []mergeConflict{
+				{Line: 1, Ours: []string{"x\n"}, Theirs: []string{"y\n"}},
+			},
+		},
+		{
+			name:   "no trailing newline",
+			base:   "a\nb",
+			ours:   "a\nB",
+			theirs: "a\nb",
+			merged: "a\nB",
+		},
+		{
+			name:   "no trailing newline in a conflict",
+			base:   "a\nb",
+			ours:   "a\nB",
+			theirs: "a\nC",
+			merged: "a\n<<<<<<< draft\nB\n=======\nC\n>>>>>>> current\n",
+			conflicts: []mergeConflict{
+				{Line: 2, Base: []string{"b"}, Ours: []string{"B"}, Theirs: []string{"C"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeThreeWay(tt.base, tt.ours, tt.theirs)
+			if got.Merged != tt.merged {
+				t.Errorf("merged = %q, want %q", got.Merged, tt.merged)
+			}
+			want := tt.conflicts
+			if want == nil {
+				want = []mergeConflict{}
+			}
+			if len(got.Conflicts) != len(want) {
+				t.Fatalf("conflicts = %+v, want %+v", got.Conflicts, want)
+			}
+			for i := range want {
+				g, w := got.Conflicts[i], want[i]
+				if g.Line != w.Line || !sameLines(g.Base, w.Base) || !sameLines(g.Ours, w.Ours) || !sameLines(g.Theirs, w.Theirs) {
+					t.Errorf("conflict %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeThreeWayUnchanged(t *testing.T) {
+	base := "# Title\n\nbody\n"
+	got := mergeThreeWay(base, base, base)
+	if !reflect.DeepEqual(got, mergeResult{Merged: base, Conflicts: []mergeConflict{}}) {
+		t.Errorf("got %+v", got)
+	}
+}
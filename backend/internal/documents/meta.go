@@ -1,10 +1,13 @@
 package documents
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -16,54 +19,248 @@ var (
 )
 
 type DocumentMetadata struct {
-	Status string
-	ID     string
-	Owner  string
+	Status      string
+	ID          string
+	Owner       string
+	Aliases     []string
+	Tags        []string
+	Description string
+	PublishAt   string
+	ExpireAt    string
+	Fields      map[string]any
 }
 
 func parseDocumentMetadata(raw string) (DocumentMetadata, string) {
 	trimmed := strings.TrimPrefix(raw, "\ufeff")
-	meta := DocumentMetadata{}
 	loc := frontMatterRE.FindStringIndex(trimmed)
 	if loc == nil {
-		return meta, trimmed
+		return DocumentMetadata{}, trimmed
 	}
 	block := trimmed[loc[0]:loc[1]]
 	body := trimmed[loc[1]:]
-	status, id, owner := parseFrontMatterBlock(block)
-	if status != "" {
-		meta.Status = status
+	return parseFrontMatterBlock(block), strings.TrimLeft(body, "\r\n")
+}
+
+func parseFrontMatterBlock(block string) DocumentMetadata {
+	root, err := decodeFrontMatter(block)
+	if err != nil {
+		return parseFrontMatterLines(block)
 	}
-	meta.ID = id
-	meta.Owner = owner
-	return meta, strings.TrimLeft(body, "\r\n")
+	meta := DocumentMetadata{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		switch strings.ToLower(key) {
+		case "status":
+			meta.Status = normalizeStatus(value.Value)
+		case "id":
+			meta.ID = strings.TrimSpace(value.Value)
+		case "owner":
+			meta.Owner = strings.TrimSpace(value.Value)
+		case "aliases":
+			meta.Aliases = append(meta.Aliases, yamlStringList(value)...)
+		case "tags":
+			meta.Tags = append(meta.Tags, yamlStringList(value)...)
+		case "description":
+			meta.Description = strings.TrimSpace(value.Value)
+		case "publish_at":
+			meta.PublishAt = strings.TrimSpace(value.Value)
+		case "expire_at":
+			meta.ExpireAt = strings.TrimSpace(value.Value)
+		default:
+			if meta.Fields == nil {
+				meta.Fields = make(map[string]any)
+			}
+			meta.Fields[key] = yamlNodeValue(value)
+		}
+	}
+	meta.Aliases = normalizeAliases(meta.Aliases)
+	meta.Tags = normalizeTags(meta.Tags)
+	return meta
 }
 
-func parseFrontMatterBlock(block string) (string, string, string) {
-	status := ""
-	id := ""
-	owner := ""
+func parseFrontMatterLines(block string) DocumentMetadata {
+	meta := DocumentMetadata{}
+	listKey := ""
 	for _, rawLine := range strings.Split(block, "\n") {
 		line := strings.TrimSpace(rawLine)
 		if line == "" || line == "---" {
 			continue
 		}
+		if listKey != "" && strings.HasPrefix(line, "- ") {
+			switch listKey {
+			case "aliases":
+				meta.Aliases = append(meta.Aliases, strings.TrimSpace(line[2:]))
+			case "tags":
+				meta.Tags = append(meta.Tags, strings.TrimSpace(line[2:]))
+			}
+			continue
+		}
+		listKey = ""
 		if strings.Contains(line, ":") {
 			parts := strings.SplitN(line, ":", 2)
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
 			switch strings.ToLower(key) {
 			case "status":
-				status = normalizeStatus(value)
+				meta.Status = normalizeStatus(value)
 			case "id":
-				id = value
+				meta.ID = value
 			case "owner":
-				owner = value
+				meta.Owner = strings.TrimSpace(value)
+			case "description":
+				meta.Description = strings.Trim(value, `"'`)
+			case "publish_at":
+				meta.PublishAt = strings.Trim(value, `"'`)
+			case "expire_at":
+				meta.ExpireAt = strings.Trim(value, `"'`)
+			case "aliases", "tags":
+				if value == "" {
+					listKey = strings.ToLower(key)
+				} else if strings.EqualFold(key, "tags") {
+					meta.Tags = append(meta.Tags, parseInlineList(value)...)
+				} else {
+					meta.Aliases = append(meta.Aliases, parseInlineList(value)...)
+				}
 			}
 			continue
 		}
 	}
-	return status, id, strings.TrimSpace(owner)
+	meta.Aliases = normalizeAliases(meta.Aliases)
+	meta.Tags = normalizeTags(meta.Tags)
+	return meta
+}
+
+func decodeFrontMatter(block string) (*yaml.Node, error) {
+	inner := ""
+	if m := frontMatterRE.FindStringSubmatch(block); m != nil {
+		inner = m[1]
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(inner), &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("front matter is not a mapping")
+	}
+	return root, nil
+}
+
+func encodeFrontMatter(root *yaml.Node) (string, error) {
+	if len(root.Content) == 0 {
+		return "---\n\n---", nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return "---\n" + buf.String() + "---", nil
+}
+
+func yamlStringList(node *yaml.Node) []string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var out []string
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				out = append(out, item.Value)
+			}
+		}
+		return out
+	case yaml.ScalarNode:
+		return parseInlineList(node.Value)
+	}
+	return nil
+}
+
+func yamlNodeValue(node *yaml.Node) any {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlNodeValue(node.Alias)
+	case yaml.SequenceNode:
+		out := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			out = append(out, yamlNodeValue(item))
+		}
+		return out
+	case yaml.MappingNode:
+		out := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			out[node.Content[i].Value] = yamlNodeValue(node.Content[i+1])
+		}
+		return out
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!timestamp" {
+			return node.Value
+		}
+		var v any
+		if err := node.Decode(&v); err == nil {
+			return v
+		}
+		return node.Value
+	}
+	return nil
+}
+
+func yamlValueNode(value any) *yaml.Node {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(value)}
+	}
+	if node.Kind == yaml.SequenceNode {
+		node.Style = yaml.FlowStyle
+	}
+	return node
+}
+
+func yamlNodeEqual(a, b *yaml.Node) bool {
+	left, errA := yaml.Marshal(a)
+	right, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(left, right)
+}
+
+func mappingKeyIndex(root *yaml.Node, key string) int {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if strings.EqualFold(root.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeTags(list []string) []string {
+	var out []string
+	for _, item := range trimStrings(list) {
+		if tag := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(item, "#"))); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return uniqueStrings(out)
+}
+
+func parseInlineList(value string) []string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "[")
+	value = strings.TrimSuffix(value, "]")
+	return trimStrings(strings.Split(value, ","))
+}
+
+func normalizeAliases(list []string) []string {
+	var out []string
+	for _, item := range trimStrings(list) {
+		if slug := cleanSlugParam(item); slug != "" {
+			out = append(out, slug)
+		}
+	}
+	return uniqueStrings(out)
 }
 
 func normalizeStatus(raw string) string {
@@ -100,10 +297,6 @@ func uniqueStrings(list []string) []string {
 	return out
 }
 
-func idsToJSON(ids []string) string {
-	return stringListToJSON(ids)
-}
-
 func idsFromJSON(raw string) []string {
 	return stringListFromJSON(raw)
 }
@@ -139,47 +332,103 @@ func stripFrontMatter(raw string) string {
 	return strings.TrimLeft(trimmed[loc[1]:], "\r\n")
 }
 
-func ensureFrontMatterID(raw string, id string) (string, bool) {
-	if id == "" {
-		return raw, false
-	}
+type frontMatterEdit func(root *yaml.Node) bool
+
+func editFrontMatter(raw string, edit frontMatterEdit) (string, bool, error) {
 	trimmed := strings.TrimPrefix(raw, "\ufeff")
-	hasBOM := len(raw) != len(trimmed)
+	bom := raw[:len(raw)-len(trimmed)]
 	loc := frontMatterRE.FindStringIndex(trimmed)
 	if loc == nil {
-		body := trimmed
+		root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if !edit(root) {
+			return raw, false, nil
+		}
+		block, err := encodeFrontMatter(root)
+		if err != nil {
+			return raw, false, err
+		}
+		body := strings.TrimLeft(trimmed, "\r\n")
 		if body == "" {
 			body = "\n"
 		}
-		result := fmt.Sprintf("---\nid: %s\n---\n\n%s", id, body)
-		if hasBOM {
-			result = "\ufeff" + result
-		}
-		return result, true
+		return bom + block + "\n\n" + body, true, nil
 	}
 	block := trimmed[loc[0]:loc[1]]
-	if frontMatterHasID(block) {
+	root, err := decodeFrontMatter(block)
+	if err != nil {
+		return raw, false, err
+	}
+	if !edit(root) {
+		return raw, false, nil
+	}
+	next, err := encodeFrontMatter(root)
+	if err != nil {
+		return raw, false, err
+	}
+	if strings.HasSuffix(block, "\n") {
+		next += "\n"
+	}
+	return bom + trimmed[:loc[0]] + next + trimmed[loc[1]:], true, nil
+}
+
+func setFrontMatterEdit(key string, value *yaml.Node, prepend bool) frontMatterEdit {
+	return func(root *yaml.Node) bool {
+		if idx := mappingKeyIndex(root, key); idx >= 0 {
+			current := root.Content[idx+1]
+			if yamlNodeEqual(current, value) {
+				return false
+			}
+			if current.Kind == value.Kind {
+				value.Style = current.Style
+			}
+			value.LineComment = current.LineComment
+			root.Content[idx+1] = value
+			return true
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		if prepend {
+			root.Content = append([]*yaml.Node{keyNode, value}, root.Content...)
+		} else {
+			root.Content = append(root.Content, keyNode, value)
+		}
+		return true
+	}
+}
+
+func ensureFrontMatterID(raw string, id string) (string, bool) {
+	if id == "" {
+		return raw, false
+	}
+	if block := frontMatterRE.FindString(strings.TrimPrefix(raw, "\ufeff")); block != "" && frontMatterHasID(block) {
 		return raw, false
 	}
+	updated, changed, err := editFrontMatter(raw, setFrontMatterEdit("id", yamlValueNode(id), false))
+	if err != nil {
+		return ensureFrontMatterIDLine(raw, id)
+	}
+	return updated, changed
+}
 
-	
-	insertion := fmt.Sprintf("id: %s\n", id)
+func ensureFrontMatterIDLine(raw string, id string) (string, bool) {
+	trimmed := strings.TrimPrefix(raw, "\ufeff")
+	hasBOM := len(raw) != len(trimmed)
+	loc := frontMatterRE.FindStringIndex(trimmed)
+	if loc == nil {
+		return raw, false
+	}
+	block := trimmed[loc[0]:loc[1]]
+	insertion := fmt.Sprintf("id: %s", id)
 	lines := strings.Split(block, "\n")
-
-	
 	var newLines []string
 	inserted := false
 	for i, line := range lines {
 		if i > 0 && strings.TrimSpace(line) == "---" && !inserted {
-			
-			newLines = append(newLines, insertion[:len(insertion)-1]) 
+			newLines = append(newLines, insertion)
 			inserted = true
 		}
 		newLines = append(newLines, line)
 	}
-
-	newBlock := strings.Join(newLines, "\n")
-	result := trimmed[:loc[0]] + newBlock + trimmed[loc[1]:]
+	result := trimmed[:loc[0]] + strings.Join(newLines, "\n") + trimmed[loc[1]:]
 	if hasBOM {
 		result = "\ufeff" + result
 	}
@@ -190,20 +439,45 @@ func setFrontMatterField(raw, key, value string) (string, bool) {
 	if key == "" || value == "" {
 		return raw, false
 	}
+	updated, changed, err := editFrontMatter(raw, setFrontMatterEdit(key, yamlValueNode(value), true))
+	if err != nil {
+		return setFrontMatterLine(raw, key, value)
+	}
+	return updated, changed
+}
+
+func setFrontMatterValue(raw, key string, value any) (string, bool) {
+	if key == "" {
+		return raw, false
+	}
+	updated, changed, err := editFrontMatter(raw, setFrontMatterEdit(key, yamlValueNode(value), true))
+	if err != nil {
+		return raw, false
+	}
+	return updated, changed
+}
+
+func removeFrontMatterField(raw, key string) (string, bool) {
+	updated, changed, err := editFrontMatter(raw, func(root *yaml.Node) bool {
+		idx := mappingKeyIndex(root, key)
+		if idx < 0 {
+			return false
+		}
+		root.Content = append(root.Content[:idx], root.Content[idx+2:]...)
+		return true
+	})
+	if err != nil {
+		return raw, false
+	}
+	return updated, changed
+}
+
+func setFrontMatterLine(raw, key, value string) (string, bool) {
 	trimmed := strings.TrimPrefix(raw, "\ufeff")
 	hasBOM := len(raw) != len(trimmed)
 	loc := frontMatterRE.FindStringIndex(trimmed)
-	insertion := fmt.Sprintf("%s: %s", key, value)
 	if loc == nil {
-		body := strings.TrimLeft(trimmed, "\r\n")
-		if body == "" {
-			body = "\n"
-		}
-		result := fmt.Sprintf("---\n%s\n---\n\n%s", insertion, body)
-		if hasBOM {
-			result = "\ufeff" + result
-		}
-		return result, true
+		return raw, false
 	}
 	block := trimmed[loc[0]:loc[1]]
 	lines := strings.Split(block, "\n")
@@ -218,6 +492,11 @@ func setFrontMatterField(raw, key, value string) (string, bool) {
 			name := strings.ToLower(strings.TrimSpace(clean[:idx]))
 			if name == loweredKey {
 				lines[i] = fmt.Sprintf("%s: %s", key, value)
+				end := i + 1
+				for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "- ") {
+					end++
+				}
+				lines = append(lines[:i+1], lines[end:]...)
 				replaced = true
 				break
 			}
@@ -228,7 +507,7 @@ func setFrontMatterField(raw, key, value string) (string, bool) {
 	if replaced {
 		newBlock = strings.Join(lines, "\n")
 	} else {
-		line := fmt.Sprintf("%s\n", insertion)
+		line := fmt.Sprintf("%s: %s\n", key, value)
 		if idx := strings.Index(block, "\n"); idx == -1 {
 			newBlock = block + "\n" + line
 		} else {
@@ -247,19 +526,7 @@ func setFrontMatterField(raw, key, value string) (string, bool) {
 }
 
 func frontMatterHasID(block string) bool {
-	for _, rawLine := range strings.Split(block, "\n") {
-		line := strings.TrimSpace(rawLine)
-		if line == "" || line == "---" {
-			continue
-		}
-		if strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if strings.EqualFold(strings.TrimSpace(parts[0]), "id") {
-				return true
-			}
-		}
-	}
-	return false
+	return frontMatterHasKey(block, "id")
 }
 
 func frontMatterHasKey(block, key string) bool {
@@ -267,6 +534,9 @@ func frontMatterHasKey(block, key string) bool {
 	if name == "" {
 		return false
 	}
+	if root, err := decodeFrontMatter(block); err == nil {
+		return mappingKeyIndex(root, name) >= 0
+	}
 	for _, rawLine := range strings.Split(block, "\n") {
 		line := strings.TrimSpace(rawLine)
 		if line == "" || line == "---" {
@@ -0,0 +1,253 @@
+package documents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+var errOpMismatch = errors.New("operation does not match document length")
+
+// opComponent is one step of a textOp: it retains, deletes or inserts. Lengths
+// count UTF-16 code units so offsets agree with browser editors.
+type opComponent struct {
+	retain int
+	delete int
+	insert []uint16
+}
+
+// textOp is a text operation in the ot.js format: in JSON a positive number
+// retains, a negative number deletes and a string inserts.
+type textOp []opComponent
+
+func (op textOp) MarshalJSON() ([]byte, error) {
+	out := make([]any, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.retain > 0:
+			out = append(out, c.retain)
+		case c.delete > 0:
+			out = append(out, -c.delete)
+		default:
+			out = append(out, string(utf16.Decode(c.insert)))
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (op *textOp) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var out textOp
+	for _, item := range raw {
+		var n int
+		if err := json.Unmarshal(item, &n); err == nil {
+			if n > 0 {
+				out = out.withRetain(n)
+			} else if n < 0 {
+				out = out.withDelete(-n)
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(item, &s); err != nil {
+			return fmt.Errorf("invalid operation component %s", item)
+		}
+		out = out.withInsert(utf16.Encode([]rune(s)))
+	}
+	*op = out
+	return nil
+}
+
+func (op textOp) withRetain(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if l := len(op); l > 0 && op[l-1].retain > 0 {
+		op[l-1].retain += n
+		return op
+	}
+	return append(op, opComponent{retain: n})
+}
+
+// withInsert keeps inserts ahead of adjacent deletes so equal operations have
+// a single representation.
+func (op textOp) withInsert(s []uint16) textOp {
+	if len(s) == 0 {
+		return op
+	}
+	l := len(op)
+	switch {
+	case l > 0 && op[l-1].isInsert():
+		op[l-1].insert = append(append([]uint16{}, op[l-1].insert...), s...)
+	case l > 0 && op[l-1].delete > 0:
+		if l > 1 && op[l-2].isInsert() {
+			op[l-2].insert = append(append([]uint16{}, op[l-2].insert...), s...)
+			return op
+		}
+		op = append(op, op[l-1])
+		op[l-1] = opComponent{insert: append([]uint16{}, s...)}
+	default:
+		op = append(op, opComponent{insert: append([]uint16{}, s...)})
+	}
+	return op
+}
+
+func (op textOp) withDelete(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if l := len(op); l > 0 && op[l-1].delete > 0 {
+		op[l-1].delete += n
+		return op
+	}
+	return append(op, opComponent{delete: n})
+}
+
+func (c opComponent) isInsert() bool {
+	return c.retain == 0 && c.delete == 0
+}
+
+func (op textOp) baseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.retain + c.delete
+	}
+	return n
+}
+
+func (op textOp) apply(doc []uint16) ([]uint16, error) {
+	if op.baseLen() != len(doc) {
+		return nil, errOpMismatch
+	}
+	out := make([]uint16, 0, len(doc))
+	i := 0
+	for _, c := range op {
+		switch {
+		case c.retain > 0:
+			out = append(out, doc[i:i+c.retain]...)
+			i += c.retain
+		case c.delete > 0:
+			i += c.delete
+		default:
+			out = append(out, c.insert...)
+		}
+	}
+	return out, nil
+}
+
+// transformOps returns a' and b' such that applying a then b' gives the same
+// text as applying b then a'. Inserts at the same position put a first.
+func transformOps(a, b textOp) (textOp, textOp, error) {
+	if a.baseLen() != b.baseLen() {
+		return nil, nil, errOpMismatch
+	}
+	var a1, b1 textOp
+	i, j := 0, 0
+	var op1, op2 opComponent
+	has1, has2 := false, false
+	next1 := func() {
+		has1 = i < len(a)
+		if has1 {
+			op1 = a[i]
+			i++
+		}
+	}
+	next2 := func() {
+		has2 = j < len(b)
+		if has2 {
+			op2 = b[j]
+			j++
+		}
+	}
+	next1()
+	next2()
+	for has1 || has2 {
+		if has1 && op1.isInsert() {
+			a1 = a1.withInsert(op1.insert)
+			b1 = b1.withRetain(len(op1.insert))
+			next1()
+			continue
+		}
+		if has2 && op2.isInsert() {
+			a1 = a1.withRetain(len(op2.insert))
+			b1 = b1.withInsert(op2.insert)
+			next2()
+			continue
+		}
+		if !has1 || !has2 {
+			return nil, nil, errOpMismatch
+		}
+		n1, n2 := op1.retain+op1.delete, op2.retain+op2.delete
+		m := min(n1, n2)
+		switch {
+		case op1.retain > 0 && op2.retain > 0:
+			a1 = a1.withRetain(m)
+			b1 = b1.withRetain(m)
+		case op1.delete > 0 && op2.retain > 0:
+			a1 = a1.withDelete(m)
+		case op1.retain > 0 && op2.delete > 0:
+			b1 = b1.withDelete(m)
+		}
+		if n1 == m {
+			next1()
+		} else if op1.retain > 0 {
+			op1.retain -= m
+		} else {
+			op1.delete -= m
+		}
+		if n2 == m {
+			next2()
+		} else if op2.retain > 0 {
+			op2.retain -= m
+		} else {
+			op2.delete -= m
+		}
+	}
+	return a1, b1, nil
+}
+
+// transformIndex moves a cursor position across op.
+func transformIndex(index int, op textOp) int {
+	moved := index
+	for _, c := range op {
+		switch {
+		case c.retain > 0:
+			index -= c.retain
+		case c.delete > 0:
+			moved -= min(index, c.delete)
+			index -= c.delete
+		default:
+			moved += len(c.insert)
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return moved
+}
+
+// diffOp builds the operation that turns from into to.
+func diffOp(from, to string) textOp {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(from, to, false)
+	dmp.DiffCleanupEfficiency(diffs)
+	var op textOp
+	for _, diff := range diffs {
+		units := utf16.Encode([]rune(diff.Text))
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			op = op.withRetain(len(units))
+		case diffmatchpatch.DiffDelete:
+			op = op.withDelete(len(units))
+		case diffmatchpatch.DiffInsert:
+			op = op.withInsert(units)
+		}
+	}
+	return op
+}
@@ -0,0 +1,196 @@
+package documents
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+func units(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+func mustOp(t *testing.T, raw string) textOp {
+	t.Helper()
+	var op textOp
+	if err := json.Unmarshal([]byte(raw), &op); err != nil {
+		t.Fatalf("unmarshal %s: %v", raw, err)
+	}
+	return op
+}
+
+func applyString(t *testing.T, op textOp, doc string) string {
+	t.Helper()
+	out, err := op.apply(units(doc))
+	if err != nil {
+		t.Fatalf("apply %v to %q: %v", op, doc, err)
+	}
+	return string(utf16.Decode(out))
+}
+
+var randomRunes = []rune("ab \né\U0001F600")
+
+func randomText(r *rand.Rand, max int) []uint16 {
+	n := 1 + r.IntN(max)
+	runes := make([]rune, n)
+	for i := range runes {
+		runes[i] = randomRunes[r.IntN(len(randomRunes))]
+	}
+	return utf16.Encode(runes)
+}
+
+// randomOp builds an operation over a document of n code units. Lengths may
+// split surrogate pairs, which transformOps must handle like any other unit.
+func randomOp(r *rand.Rand, n int) textOp {
+	var op textOp
+	for n > 0 {
+		k := 1 + r.IntN(n)
+		switch r.IntN(3) {
+		case 0:
+			op = op.withRetain(k)
+			n -= k
+		case 1:
+			op = op.withDelete(k)
+			n -= k
+		default:
+			op = op.withInsert(randomText(r, 4))
+		}
+	}
+	if r.IntN(2) == 0 {
+		op = op.withInsert(randomText(r, 4))
+	}
+	return op
+}
+
+func TestTransformOpsConverges(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 2000; i++ {
+		doc := randomText(r, 20)
+		a, b := randomOp(r, len(doc)), randomOp(r, len(doc))
+		a1, b1, err := transformOps(a, b)
+		if err != nil {
+			t.Fatalf("transform %v %v: %v", a, b, err)
+		}
+		da, err := a.apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := b.apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left, err := b1.apply(da)
+		if err != nil {
+			t.Fatalf("apply b' %v after a %v: %v", b1, a, err)
+		}
+		right, err := a1.apply(db)
+		if err != nil {
+			t.Fatalf("apply a' %v after b %v: %v", a1, b, err)
+		}
+		if !slices.Equal(left, right) {
+			t.Fatalf("doc %q, a %v, b %v: a then b' = %q, b then a' = %q",
+				string(utf16.Decode(doc)), a, b, string(utf16.Decode(left)), string(utf16.Decode(right)))
+		}
+	}
+}
+
+func TestTransformOpsInsertTie(t *testing.T) {
+	a := mustOp(t, `[1,"X",1]`)
+	b := mustOp(t, `[1,"Y",1]`)
+	a1, b1, err := transformOps(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := applyString(t, b1, applyString(t, a, "ab")); got != "aXYb" {
+		t.Errorf("a then b' = %q, want %q", got, "aXYb")
+	}
+	if got := applyString(t, a1, applyString(t, b, "ab")); got != "aXYb" {
+		t.Errorf("b then a' = %q, want %q", got, "aXYb")
+	}
+}
+
+func TestTransformOpsMismatch(t *testing.T) {
+	if _, _, err := transformOps(mustOp(t, `[2]`), mustOp(t, `[3]`)); err != errOpMismatch {
+		t.Errorf("err = %v, want errOpMismatch", err)
+	}
+	if _, err := mustOp(t, `[2]`).apply(units("abc")); err != errOpMismatch {
+		t.Errorf("apply err = %v, want errOpMismatch", err)
+	}
+}
+
+func TestTextOpSurrogates(t *testing.T) {
+	op := mustOp(t, `[1,"😀",-1]`)
+	if got := op.baseLen(); got != 2 {
+		t.Fatalf("baseLen = %d, want 2", got)
+	}
+	if got := applyString(t, op, "ab"); got != "a\U0001F600" {
+		t.Errorf("apply = %q", got)
+	}
+	// The emoji is two code units, so deleting it takes -2.
+	if got := applyString(t, mustOp(t, `[1,-2,1]`), "a\U0001F600b"); got != "ab" {
+		t.Errorf("delete = %q", got)
+	}
+	raw, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `[1,"😀",-1]` {
+		t.Errorf("marshal = %s", raw)
+	}
+}
+
+func TestTextOpUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`[]`, `[]`},
+		{`[2,3]`, `[5]`},
+		{`[-1,-2]`, `[-3]`},
+		{`["a","b"]`, `["ab"]`},
+		{`[0,1]`, `[1]`},
+		// Inserts are kept ahead of adjacent deletes.
+		{`[1,-2,"x"]`, `[1,"x",-2]`},
+		{`["x",-2,"y"]`, `["xy",-2]`},
+	}
+	for _, tt := range tests {
+		op := mustOp(t, tt.raw)
+		got, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+
+	var op textOp
+	for _, raw := range []string{`[true]`, `[1.5]`, `{}`} {
+		if err := json.Unmarshal([]byte(raw), &op); err == nil {
+			t.Errorf("%s: expected error", raw)
+		}
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		index int
+		op    string
+		want  int
+	}{
+		{0, `["xy",3]`, 2},
+		{1, `[1,"xy",2]`, 3},
+		{2, `[3,"xy"]`, 2},
+		{3, `[-2,1]`, 1},
+		{1, `[-2,1]`, 0},
+		{2, `[1,-1,"z",1]`, 2},
+		{2, `[1,"😀",2]`, 4},
+	}
+	for _, tt := range tests {
+		if got := transformIndex(tt.index, mustOp(t, tt.op)); got != tt.want {
+			t.Errorf("transformIndex(%d, %s) = %d, want %d", tt.index, tt.op, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package documents
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"atlas/internal/auth"
+	"atlas/internal/events"
 	"atlas/internal/httpx"
 
 	"github.com/go-chi/chi/v5"
@@ -36,34 +38,19 @@ func documentPresenceListHandler(db *sql.DB) http.HandlerFunc {
 			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
 			return
 		}
-		cutoff := time.Now().Add(-presenceTTL).Unix()
-		rows, err := db.Query(
-			`SELECT user_id, username, updated_at FROM editor_presence WHERE slug = ? AND updated_at >= ? ORDER BY updated_at DESC`,
-			slug,
-			cutoff,
-		)
-		if err != nil {
-			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "presence lookup failed")
-			return
-		}
-		defer rows.Close()
-
 		out := []editorPresenceRow{}
-		for rows.Next() {
-			var row editorPresenceRow
-			var updated int64
-			if err := rows.Scan(&row.UserID, &row.Username, &updated); err != nil {
-				httpx.WriteErrorMessage(w, http.StatusInternalServerError, "presence scan failed")
-				return
+		for _, user := range events.Presence(slug) {
+			if user.State == events.StateEditing {
+				out = append(out, editorPresenceRow{UserID: user.UserID, Username: user.Username, UpdatedAt: user.UpdatedAt})
 			}
-			row.UpdatedAt = time.Unix(updated, 0).UTC().Format(time.RFC3339)
-			out = append(out, row)
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(out)
 	}
 }
 
+// documentPresenceUpdateHandler marks the user as editing slug for
+// presenceTTL, for clients that poll instead of using the event stream.
 func documentPresenceUpdateHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slug := cleanSlugParam(chi.URLParam(r, "*"))
@@ -80,21 +67,8 @@ func documentPresenceUpdateHandler(db *sql.DB) http.HandlerFunc {
 			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
 			return
 		}
-		now := time.Now().UTC().Unix()
-		if _, err := db.Exec(
-			`INSERT INTO editor_presence (slug, user_id, username, updated_at)
-			 VALUES(?,?,?,?)
-			 ON CONFLICT(slug, user_id) DO UPDATE SET username=excluded.username, updated_at=excluded.updated_at`,
-			slug,
-			u.ID,
-			u.Username,
-			now,
-		); err != nil {
-			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "presence update failed")
-			return
-		}
-		cutoff := now - int64(presenceTTL.Seconds())
-		db.Exec(`DELETE FROM editor_presence WHERE updated_at < ?`, cutoff)
+		key := fmt.Sprintf("poll:%d:%s", u.ID, slug)
+		events.SetPresence(key, u.ID, u.Username, slug, events.StateEditing, presenceTTL)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,401 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/httpx"
+)
+
+const (
+	queryFenceInfo    = "atlas-query"
+	queryDefaultLimit = 50
+	queryMaxLimit     = 200
+)
+
+var (
+	queryFieldKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	queryFenceOpen       = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*" + queryFenceInfo + "\\s*$")
+	querySortColumns     = map[string]string{
+		"title":      "title",
+		"slug":       "slug",
+		"owner":      "owner",
+		"status":     "status",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	}
+)
+
+type documentQuery struct {
+	Tags          []string          `json:"tags,omitempty"`
+	Owner         string            `json:"owner,omitempty"`
+	Statuses      []string          `json:"status,omitempty"`
+	Parent        string            `json:"parent,omitempty"`
+	Under         string            `json:"under,omitempty"`
+	UpdatedAfter  string            `json:"updated_after,omitempty"`
+	UpdatedBefore string            `json:"updated_before,omitempty"`
+	CreatedAfter  string            `json:"created_after,omitempty"`
+	CreatedBefore string            `json:"created_before,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+	Sort          string            `json:"sort"`
+	Desc          bool              `json:"desc"`
+	Limit         int               `json:"limit"`
+	Format        string            `json:"format"`
+	Columns       []string          `json:"columns"`
+}
+
+type documentQueryResponse struct {
+	Query documentQuery     `json:"query"`
+	Rows  []documentListRow `json:"rows"`
+}
+
+func parseDocumentQuery(text string) (documentQuery, error) {
+	q := documentQuery{Sort: "title", Limit: queryDefaultLimit, Format: "list"}
+	for _, rawLine := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return q, fmt.Errorf("expected key: value, got %q", line)
+		}
+		key = normalizeQueryKey(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "tag", "tags":
+			q.Tags = append(q.Tags, normalizeTags(parseInlineList(value))...)
+		case "owner":
+			q.Owner = strings.Trim(value, `"'`)
+		case "status":
+			for _, item := range parseInlineList(value) {
+				status := normalizeStatus(item)
+				if status == "" {
+					return q, fmt.Errorf("unknown status %q", item)
+				}
+				q.Statuses = append(q.Statuses, status)
+			}
+		case "parent":
+			q.Parent = cleanSlugParam(value)
+		case "under":
+			q.Under = cleanSlugParam(value)
+		case "updated_after", "updated_before", "created_after", "created_before":
+			date, err := parseQueryDate(value)
+			if err != nil {
+				return q, fmt.Errorf("%s: %v", key, err)
+			}
+			switch key {
+			case "updated_after":
+				q.UpdatedAfter = date
+			case "updated_before":
+				q.UpdatedBefore = date
+			case "created_after":
+				q.CreatedAfter = date
+			case "created_before":
+				q.CreatedBefore = date
+			}
+		case "sort":
+			parts := strings.Fields(value)
+			if len(parts) == 0 || len(parts) > 2 {
+				return q, fmt.Errorf("sort expects a field and optional direction")
+			}
+			field := normalizeQueryKey(parts[0])
+			if _, ok := querySortColumns[field]; !ok && !isQueryFieldKey(field) {
+				return q, fmt.Errorf("cannot sort by %q", parts[0])
+			}
+			q.Sort = field
+			direction := ""
+			if len(parts) == 2 {
+				direction = strings.ToLower(parts[1])
+			}
+			q.Desc = direction == "desc"
+			if direction != "" && direction != "asc" && direction != "desc" {
+				return q, fmt.Errorf("sort direction must be asc or desc")
+			}
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return q, fmt.Errorf("limit must be a positive number")
+			}
+			if n > queryMaxLimit {
+				n = queryMaxLimit
+			}
+			q.Limit = n
+		case "format":
+			format := strings.ToLower(value)
+			if format != "list" && format != "table" {
+				return q, fmt.Errorf("format must be list or table")
+			}
+			q.Format = format
+		case "columns":
+			q.Columns = nil
+			for _, column := range parseInlineList(value) {
+				column = normalizeQueryKey(column)
+				if _, ok := querySortColumns[column]; !ok && column != "tags" && column != "description" && !isQueryFieldKey(column) {
+					return q, fmt.Errorf("unknown column %q", column)
+				}
+				q.Columns = append(q.Columns, column)
+			}
+		default:
+			if !isQueryFieldKey(key) {
+				return q, fmt.Errorf("unknown filter %q", key)
+			}
+			if q.Fields == nil {
+				q.Fields = make(map[string]string)
+			}
+			q.Fields[strings.TrimPrefix(key, "field.")] = strings.Trim(value, `"'`)
+		}
+	}
+	q.Tags = uniqueStrings(q.Tags)
+	if len(q.Statuses) == 0 {
+		q.Statuses = []string{"published"}
+	}
+	if len(q.Columns) == 0 {
+		q.Columns = []string{"title", "owner", "updated_at"}
+	}
+	return q, nil
+}
+
+// normalizeQueryKey lowercases a reserved key. Custom fields are stored as
+// written in the front matter, so the name after "field." keeps its case.
+func normalizeQueryKey(key string) string {
+	if prefix, name, ok := strings.Cut(key, "."); ok && strings.EqualFold(prefix, "field") {
+		return "field." + name
+	}
+	return strings.ToLower(key)
+}
+
+func isQueryFieldKey(key string) bool {
+	name, ok := strings.CutPrefix(key, "field.")
+	return ok && queryFieldKeyPattern.MatchString(name)
+}
+
+func parseQueryDate(value string) (string, error) {
+	value = strings.Trim(value, `"'`)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Format("2006-01-02"), nil
+	}
+	return "", fmt.Errorf("invalid date %q", value)
+}
+
+func queryFieldPath(name string) string {
+	return fmt.Sprintf(`'$."%s"'`, name)
+}
+
+func buildQuerySQL(q documentQuery) (string, []any) {
+	var filters []string
+	var args []any
+	filters = append(filters, fmt.Sprintf("status IN (%s)", placeholders(len(q.Statuses))))
+	for _, status := range q.Statuses {
+		args = append(args, status)
+	}
+	for _, tag := range q.Tags {
+		filters = append(filters, "doc_id IN (SELECT doc_id FROM document_tags WHERE tag = ?)")
+		args = append(args, tag)
+	}
+	if q.Owner != "" {
+		filters = append(filters, "owner = ?")
+		args = append(args, q.Owner)
+	}
+	if q.Parent != "" {
+		filters = append(filters, "parent_slug = ?")
+		args = append(args, q.Parent)
+	}
+	if q.Under != "" {
+		filters = append(filters, "slug LIKE ?")
+		args = append(args, q.Under+"/%")
+	}
+	for column, bound := range map[string][2]string{
+		"updated_at": {q.UpdatedAfter, q.UpdatedBefore},
+		"created_at": {q.CreatedAfter, q.CreatedBefore},
+	} {
+		if bound[0] != "" {
+			filters = append(filters, column+" >= ?")
+			args = append(args, bound[0])
+		}
+		if bound[1] != "" {
+			filters = append(filters, column+" < ?")
+			args = append(args, bound[1])
+		}
+	}
+	for name, value := range q.Fields {
+		filters = append(filters, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(front_matter, %s) WHERE CAST(value AS TEXT) = ?)", queryFieldPath(name)))
+		args = append(args, value)
+	}
+
+	order := querySortColumns[q.Sort]
+	if order == "" {
+		order = fmt.Sprintf("json_extract(front_matter, %s)", queryFieldPath(strings.TrimPrefix(q.Sort, "field.")))
+	}
+	direction := "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+	query := fmt.Sprintf("%s WHERE %s ORDER BY %s %s, slug LIMIT ?", documentListSelect(), strings.Join(filters, " AND "), order, direction)
+	args = append(args, q.Limit)
+	return query, args
+}
+
+func runDocumentQuery(db *sql.DB, q documentQuery) ([]documentListRow, error) {
+	query, args := buildQuerySQL(q)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []documentListRow{}
+	for rows.Next() {
+		row, err := scanDocumentListRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+func queryColumnValue(row documentListRow, column string) string {
+	switch column {
+	case "title":
+		return fmt.Sprintf("[%s](/doc/%s)", escapeQueryCell(row.Title), escapeSlugPath(row.Slug))
+	case "slug":
+		return row.Slug
+	case "owner":
+		return row.Owner
+	case "status":
+		return row.Status
+	case "created_at":
+		return row.CreatedAt
+	case "updated_at":
+		return row.UpdatedAt
+	case "tags":
+		return strings.Join(row.Tags, ", ")
+	case "description":
+		return row.Description
+	}
+	value, ok := row.Fields[strings.TrimPrefix(column, "field.")]
+	if !ok || value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ", ")
+	case map[string]any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+func escapeQueryCell(value string) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	value = strings.ReplaceAll(value, "|", `\|`)
+	value = strings.ReplaceAll(value, "[", `\[`)
+	return strings.ReplaceAll(value, "]", `\]`)
+}
+
+func formatQueryResults(q documentQuery, rows []documentListRow) string {
+	if len(rows) == 0 {
+		return "_No matching documents._"
+	}
+	var b strings.Builder
+	if q.Format == "table" {
+		b.WriteString("| " + strings.Join(q.Columns, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat(" --- |", len(q.Columns)) + "\n")
+		for _, row := range rows {
+			cells := make([]string, 0, len(q.Columns))
+			for _, column := range q.Columns {
+				value := queryColumnValue(row, column)
+				if column != "title" {
+					value = escapeQueryCell(value)
+				}
+				cells = append(cells, value)
+			}
+			b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+		return strings.TrimRight(b.String(), "\n")
+	}
+	for _, row := range rows {
+		b.WriteString("- " + queryColumnValue(row, "title"))
+		if row.Description != "" {
+			b.WriteString(" — " + escapeQueryCell(row.Description))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func expandQueryBlocks(db *sql.DB, text string) string {
+	if !strings.Contains(text, queryFenceInfo) {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		m := queryFenceOpen.FindStringSubmatch(strings.TrimRight(lines[i], "\r"))
+		if m == nil {
+			out = append(out, lines[i])
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), m[1]) {
+			end++
+		}
+		block := strings.Join(lines[i+1:min(end, len(lines))], "\n")
+		out = append(out, renderQueryBlock(db, block))
+		i = end
+	}
+	return strings.Join(out, "\n")
+}
+
+func renderQueryBlock(db *sql.DB, block string) string {
+	q, err := parseDocumentQuery(block)
+	if err != nil {
+		return "> Query error: " + escapeQueryCell(err.Error())
+	}
+	rows, err := runDocumentQuery(db, q)
+	if err != nil {
+		return "> Query failed."
+	}
+	return formatQueryResults(q, rows)
+}
+
+func documentQueryHandler(db *sql.DB) http.HandlerFunc {
+	type queryRequest struct {
+		Query string `json:"query"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		var req queryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		q, err := parseDocumentQuery(req.Query)
+		if err != nil {
+			docErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rows, err := runDocumentQuery(db, q)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, documentQueryResponse{Query: q, Rows: rows})
+	}
+}
@@ -0,0 +1,163 @@
+package documents
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDocumentQuery(t *testing.T) {
+	defaults := func(q documentQuery) documentQuery {
+		if q.Sort == "" {
+			q.Sort = "title"
+		}
+		if q.Limit == 0 {
+			q.Limit = queryDefaultLimit
+		}
+		if q.Format == "" {
+			q.Format = "list"
+		}
+		if q.Statuses == nil {
+			q.Statuses = []string{"published"}
+		}
+		if q.Columns == nil {
+			q.Columns = []string{"title", "owner", "updated_at"}
+		}
+		return q
+	}
+	tests := []struct {
+		name  string
+		text  string
+		want  documentQuery
+		error string
+	}{
+		{
+			name: "empty",
+			text: "",
+			want: defaults(documentQuery{}),
+		},
+		{
+			name: "filters",
+			text: "# guides only\nTags: [Go, go]\nowner: \"ann\"\nstatus: unlisted, published\nunder: guides/\nupdated_after: 2026-01-02",
+			want: defaults(documentQuery{
+				Tags:         []string{"go"},
+				Owner:        "ann",
+				Statuses:     []string{"unlisted", "published"},
+				Under:        "guides",
+				UpdatedAfter: "2026-01-02",
+			}),
+		},
+		{
+			name: "field names keep their case",
+			text: "Field.Team: Platform\nsort: field.Team DESC\ncolumns: Title, field.Team",
+			want: defaults(documentQuery{
+				Fields:  map[string]string{"Team": "Platform"},
+				Sort:    "field.Team",
+				Desc:    true,
+				Columns: []string{"title", "field.Team"},
+			}),
+		},
+		{
+			name: "limit is capped",
+			text: "limit: 1000\nformat: Table",
+			want: defaults(documentQuery{Limit: queryMaxLimit, Format: "table"}),
+		},
+		{name: "missing colon", text: "tags go", error: `expected key: value, got "tags go"`},
+		{name: "unknown filter", text: "color: red", error: `unknown filter "color"`},
+		{name: "unknown status", text: "status: gone", error: `unknown status "gone"`},
+		{name: "bad date", text: "created_before: soon", error: `created_before: invalid date "soon"`},
+		{name: "bad sort field", text: "sort: size", error: `cannot sort by "size"`},
+		{name: "bad sort direction", text: "sort: title up", error: "sort direction must be asc or desc"},
+		{name: "bad limit", text: "limit: 0", error: "limit must be a positive number"},
+		{name: "bad format", text: "format: grid", error: "format must be list or table"},
+		{name: "bad column", text: "columns: size", error: `unknown column "size"`},
+		{name: "bad field name", text: "field.a b: c", error: `unknown filter "field.a b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDocumentQuery(tt.text)
+			if tt.error != "" {
+				if err == nil || err.Error() != tt.error {
+					t.Fatalf("error = %v, want %q", err, tt.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildQuerySQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   documentQuery
+		clauses []string
+		order   string
+		args    []any
+	}{
+		{
+			name:    "statuses only",
+			query:   documentQuery{Statuses: []string{"published"}, Sort: "title", Limit: 10},
+			clauses: []string{"status IN (?)"},
+			order:   "ORDER BY title ASC, slug LIMIT ?",
+			args:    []any{"published", 10},
+		},
+		{
+			name: "tags owner and location",
+			query: documentQuery{
+				Statuses: []string{"unlisted", "published"},
+				Tags:     []string{"go"},
+				Owner:    "ann",
+				Parent:   "guides",
+				Under:    "guides",
+				Sort:     "updated_at",
+				Desc:     true,
+				Limit:    5,
+			},
+			clauses: []string{
+				"status IN (?,?)",
+				"doc_id IN (SELECT doc_id FROM document_tags WHERE tag = ?)",
+				"owner = ?",
+				"parent_slug = ?",
+				"slug LIKE ?",
+			},
+			order: "ORDER BY updated_at DESC, slug LIMIT ?",
+			args:  []any{"unlisted", "published", "go", "ann", "guides", "guides/%", 5},
+		},
+		{
+			name:    "updated range",
+			query:   documentQuery{Statuses: []string{"published"}, UpdatedAfter: "2026-01-01", UpdatedBefore: "2026-02-01", Sort: "title", Limit: 1},
+			clauses: []string{"updated_at >= ?", "updated_at < ?"},
+			order:   "ORDER BY title ASC, slug LIMIT ?",
+			args:    []any{"published", "2026-01-01", "2026-02-01", 1},
+		},
+		{
+			name:    "custom field filter and sort",
+			query:   documentQuery{Statuses: []string{"published"}, Fields: map[string]string{"Team": "Platform"}, Sort: "field.Team", Limit: 3},
+			clauses: []string{`EXISTS (SELECT 1 FROM json_each(front_matter, '$."Team"') WHERE CAST(value AS TEXT) = ?)`},
+			order:   `ORDER BY json_extract(front_matter, '$."Team"') ASC, slug LIMIT ?`,
+			args:    []any{"published", "Platform", 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := buildQuerySQL(tt.query)
+			for _, clause := range tt.clauses {
+				if !strings.Contains(query, clause) {
+					t.Errorf("query %q lacks %q", query, clause)
+				}
+			}
+			if !strings.HasSuffix(query, tt.order) {
+				t.Errorf("query %q does not end with %q", query, tt.order)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
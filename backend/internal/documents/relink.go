@@ -0,0 +1,94 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+)
+
+func relinkReferencingDocuments(db *sql.DB, user *auth.User, renames map[string]string, targetIDs []string) {
+	if len(renames) == 0 || len(targetIDs) == 0 {
+		return
+	}
+	sources := make(map[string]string)
+	for _, id := range targetIDs {
+		if strings.TrimSpace(id) == "" {
+			continue
+		}
+		rows, err := db.Query(`SELECT DISTINCT d.slug,d.path FROM document_links l JOIN documents d ON d.doc_id = l.source_id WHERE l.target_id = ?`, id)
+		if err != nil {
+			log.Printf("relink lookup %s: %v", id, err)
+			continue
+		}
+		for rows.Next() {
+			var slug, path string
+			if err := rows.Scan(&slug, &path); err == nil {
+				sources[slug] = path
+			}
+		}
+		rows.Close()
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	actor := "system"
+	if user != nil && strings.TrimSpace(user.Username) != "" {
+		actor = user.Username
+	}
+	oldSlugs := make([]string, 0, len(renames))
+	for old := range renames {
+		oldSlugs = append(oldSlugs, old)
+	}
+	sort.Strings(oldSlugs)
+	note := fmt.Sprintf("%s updated links (%s → %s)", actor, oldSlugs[0], renames[oldSlugs[0]])
+	if len(oldSlugs) > 1 {
+		note = fmt.Sprintf("%s updated links (%d moved pages under %s)", actor, len(oldSlugs), oldSlugs[0])
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for slug, path := range sources {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		updated, changed := rewriteDocumentBodyLinks(string(raw), renames)
+		if !changed {
+			continue
+		}
+		recordHistory(db, slug, note, raw)
+		if err := os.WriteFile(path, []byte(updated), 0o644); err != nil {
+			log.Printf("relink write %s: %v", slug, err)
+			continue
+		}
+		relinkedMeta, _ := parseDocumentMetadata(updated)
+		linkHealth.update(path, relinkedMeta.ID, slug, updated)
+		db.Exec(`UPDATE documents SET updated_at = ? WHERE slug = ?`, now, slug)
+		db.Exec(`UPDATE documents_fts SET body = ? WHERE rowid = (SELECT id FROM documents WHERE slug = ?)`, expandEmbeds(db, relinkedMeta.ID, updated), slug)
+		if user != nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, user.ID, "relink_document", slug, note)
+		}
+	}
+}
+
+func rewriteDocumentBodyLinks(raw string, renames map[string]string) (string, bool) {
+	trimmed := strings.TrimPrefix(raw, "\ufeff")
+	bom := raw[:len(raw)-len(trimmed)]
+	head := ""
+	body := trimmed
+	if loc := frontMatterRE.FindStringIndex(trimmed); loc != nil {
+		head = trimmed[:loc[1]]
+		body = trimmed[loc[1]:]
+	}
+	next, changed := rewriteDocLinkTargets(body, renames)
+	if !changed {
+		return raw, false
+	}
+	return bom + head + next, true
+}
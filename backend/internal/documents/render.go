@@ -0,0 +1,285 @@
+package documents
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const renderCacheLimit = 512
+
+var (
+	wikiTargetsKey = parser.NewContextKey()
+
+	markdownRenderer = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199)),
+		),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+
+	htmlPolicy  = newHTMLPolicy()
+	renderCache = &renderedHTMLCache{entries: make(map[string]string)}
+)
+
+func newHTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wiki-link( wiki-link-missing)?$`)).OnElements("a")
+	return p
+}
+
+type documentRenderResponse struct {
+	DocID string `json:"doc_id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	HTML  string `json:"html"`
+	Hash  string `json:"hash"`
+}
+
+type renderedHTMLCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+func (c *renderedHTMLCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out, ok := c.entries[key]
+	return out, ok
+}
+
+func (c *renderedHTMLCache) put(key, out string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= renderCacheLimit {
+		c.entries = make(map[string]string)
+	}
+	c.entries[key] = out
+}
+
+type headingIDs struct {
+	anchors anchorSet
+}
+
+func (h *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	return []byte(h.anchors.unique(plainHeadingText(string(value))))
+}
+
+func (h *headingIDs) Put(value []byte) {
+	h.anchors[string(value)] = 0
+}
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := string(line[2 : 2+end])
+	if strings.Contains(inner, "[") {
+		return nil
+	}
+	token, ok := parseWikiTarget(inner)
+	if !ok {
+		return nil
+	}
+	block.Advance(end + 4)
+
+	target, label, hasLabel := strings.Cut(inner, "|")
+	label = strings.TrimSpace(label)
+	if !hasLabel || label == "" {
+		label = strings.TrimSpace(target)
+	}
+	targets, _ := pc.Get(wikiTargetsKey).(map[string]string)
+	slug, resolved := targets[wikiTargetKey(token)]
+	if resolved && token.ID != "" && !hasLabel {
+		label = slug
+	}
+
+	link := ast.NewLink()
+	class := "wiki-link"
+	switch {
+	case resolved:
+		link.Destination = []byte("/doc/" + escapeSlugPath(slug))
+	case token.ID != "":
+		link.Destination = []byte("/d/" + escapeSlugPath(token.ID))
+		class += " wiki-link-missing"
+	default:
+		link.Destination = []byte("/doc/" + escapeSlugPath(token.Slug))
+		class += " wiki-link-missing"
+	}
+	if token.Anchor != "" {
+		link.Destination = append(link.Destination, []byte("#"+token.Anchor)...)
+	}
+	link.SetAttributeString("class", []byte(class))
+	link.AppendChild(link, ast.NewString([]byte(label)))
+	return link
+}
+
+func wikiTargetKey(token docLinkToken) string {
+	if token.ID != "" {
+		return "doc:" + token.ID
+	}
+	return token.Slug
+}
+
+func resolveWikiTargets(db *sql.DB, tokens []docLinkToken) map[string]string {
+	out := make(map[string]string)
+	slugMap := resolveLinkSlugs(db, tokens)
+	idSet := make(map[string]struct{})
+	for _, token := range tokens {
+		if token.ID != "" {
+			idSet[token.ID] = struct{}{}
+		} else if docID := slugMap[token.Slug]; docID != "" {
+			idSet[docID] = struct{}{}
+		}
+	}
+	idSlugs := make(map[string]string, len(idSet))
+	if len(idSet) > 0 {
+		args := make([]any, 0, len(idSet))
+		for id := range idSet {
+			args = append(args, id)
+		}
+		rows, err := db.Query(fmt.Sprintf(`SELECT doc_id,slug FROM documents WHERE doc_id IN (%s)`, placeholders(len(args))), args...)
+		if err == nil {
+			for rows.Next() {
+				var id, slug string
+				if rows.Scan(&id, &slug) == nil {
+					idSlugs[id] = slug
+				}
+			}
+			rows.Close()
+		}
+	}
+	for _, token := range tokens {
+		if token.ID != "" {
+			if slug, ok := idSlugs[token.ID]; ok {
+				out["doc:"+token.ID] = slug
+			}
+			continue
+		}
+		docID, ok := slugMap[token.Slug]
+		if !ok {
+			continue
+		}
+		if slug, found := idSlugs[docID]; found {
+			out[token.Slug] = slug
+		} else {
+			out[token.Slug] = token.Slug
+		}
+	}
+	return out
+}
+
+func renderMarkdown(db *sql.DB, docID, body string) (string, string, error) {
+	source := expandQueryBlocks(db, expandEmbeds(db, docID, body))
+	targets := resolveWikiTargets(db, extractDocLinkTokens(source))
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sum := sha256.New()
+	sum.Write([]byte(source))
+	for _, key := range keys {
+		fmt.Fprintf(sum, "\x00%s\x00%s", key, targets[key])
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+	if out, ok := renderCache.get(hash); ok {
+		return out, hash, nil
+	}
+
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{anchors: anchorSet{}}))
+	ctx.Set(wikiTargetsKey, targets)
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(source), &buf, parser.WithContext(ctx)); err != nil {
+		return "", "", err
+	}
+	out := htmlPolicy.Sanitize(buf.String())
+	renderCache.put(hash, out)
+	return out, hash, nil
+}
+
+func documentRenderHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		if slug == "" {
+			docErr(w, http.StatusBadRequest, "missing slug")
+			return
+		}
+		var docID, title sql.NullString
+		var path string
+		err := db.QueryRow(`SELECT doc_id,title,path FROM documents WHERE slug = ?`, slug).Scan(&docID, &title, &path)
+		if err == sql.ErrNoRows {
+			if target, _, ok := resolveSlugAlias(db, slug); ok {
+				slug = target
+				err = db.QueryRow(`SELECT doc_id,title,path FROM documents WHERE slug = ?`, slug).Scan(&docID, &title, &path)
+			}
+		}
+		if err == sql.ErrNoRows {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		rendered, hash, err := renderMarkdown(db, docID.String, stripFrontMatter(string(content)))
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "render failed")
+			return
+		}
+		if title.String == "" {
+			title.String = extractTitle(string(content))
+		}
+		httpx.WriteJSON(w, http.StatusOK, documentRenderResponse{
+			DocID: docID.String,
+			Slug:  slug,
+			Title: title.String,
+			HTML:  rendered,
+			Hash:  hash,
+		})
+	}
+}
@@ -0,0 +1,614 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type reviewPolicy struct {
+	Folder    string   `json:"folder"`
+	Approvers []string `json:"approvers"`
+	UpdatedBy string   `json:"updated_by,omitempty"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+}
+
+type revisionRow struct {
+	ID         int64  `json:"id"`
+	Slug       string `json:"slug"`
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Status     string `json:"status"`
+	Reviewer   string `json:"reviewer,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	ReviewedAt string `json:"reviewed_at,omitempty"`
+	Folder     string `json:"folder,omitempty"`
+}
+
+type revisionEvent struct {
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Comment   string `json:"comment,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type revisionDetailResponse struct {
+	revisionRow
+	Content   string               `json:"content"`
+	Approvers []string             `json:"approvers"`
+	Stale     bool                 `json:"stale"`
+	Segments  []historyDiffSegment `json:"segments"`
+	Events    []revisionEvent      `json:"events"`
+}
+
+// revisionProposal is the response to a save that was stored for review.
+type revisionProposal struct {
+	Slug       string   `json:"slug"`
+	RevisionID int64    `json:"revision_id"`
+	Status     string   `json:"status"`
+	Folder     string   `json:"folder"`
+	Approvers  []string `json:"approvers"`
+}
+
+type revisionRecord struct {
+	revisionRow
+	target   string
+	query    string
+	content  string
+	baseHash string
+	authorID int
+}
+
+// renameTo returns the slug the proposed save renames the page to, if any.
+func (rec revisionRecord) renameTo() string {
+	query, _ := url.ParseQuery(rec.query)
+	return strings.TrimSpace(query.Get("rename_to"))
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadReviewPolicies(db *sql.DB) ([]reviewPolicy, error) {
+	rows, err := db.Query(`SELECT folder,approvers,COALESCE(updated_by,''),COALESCE(updated_at,'') FROM review_policies ORDER BY folder`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []reviewPolicy{}
+	for rows.Next() {
+		var policy reviewPolicy
+		var approvers string
+		if err := rows.Scan(&policy.Folder, &approvers, &policy.UpdatedBy, &policy.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policy.Approvers = stringListFromJSON(approvers)
+		if policy.Approvers == nil {
+			policy.Approvers = []string{}
+		}
+		out = append(out, policy)
+	}
+	return out, rows.Err()
+}
+
+// reviewPolicyFor returns the policy of the deepest reviewed folder that
+// contains slug or, for a save that renames slug, the new slug.
+func reviewPolicyFor(db *sql.DB, slug, renameTo string) (reviewPolicy, bool) {
+	policies, err := loadReviewPolicies(db)
+	if err != nil {
+		return reviewPolicy{}, false
+	}
+	return matchSavePolicy(policies, slug, renameTo)
+}
+
+func matchSavePolicy(policies []reviewPolicy, slug, renameTo string) (reviewPolicy, bool) {
+	if policy, found := matchReviewPolicy(policies, slug); found || renameTo == "" {
+		return policy, found
+	}
+	return matchReviewPolicy(policies, renameSlug(renameTo))
+}
+
+func matchReviewPolicy(policies []reviewPolicy, slug string) (reviewPolicy, bool) {
+	var best reviewPolicy
+	found := false
+	for _, policy := range policies {
+		if slug != policy.Folder && !strings.HasPrefix(slug, policy.Folder+"/") {
+			continue
+		}
+		if !found || len(policy.Folder) > len(best.Folder) {
+			best = policy
+			found = true
+		}
+	}
+	return best, found
+}
+
+func recordRevisionEvent(db *sql.DB, revisionID int64, user *auth.User, action, comment string) {
+	actor := "system"
+	if user != nil {
+		actor = user.Username
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	db.Exec(`INSERT INTO revision_events(revision_id,actor,action,comment,created_at) VALUES(?,?,?,?,?)`, revisionID, actor, action, comment, now)
+	if user != nil {
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, user.ID, action+"_revision", strconv.FormatInt(revisionID, 10), comment)
+	}
+}
+
+// proposeRevision stores a save to a reviewed folder as a pending revision
+// instead of writing it. Earlier pending proposals by the same author for the
+// same page are superseded.
+func proposeRevision(db *sql.DB, u *auth.User, policy reviewPolicy, slug string, opts saveOptions, body []byte) (*revisionProposal, error) {
+	if u == nil {
+		return nil, &saveError{status: http.StatusUnauthorized, message: "unauthorized"}
+	}
+	baseHash := ""
+	if current, ok := currentDocumentContent(db, slug); ok {
+		baseHash = contentHash(current)
+	}
+
+	rows, err := db.Query(`SELECT id FROM document_revisions WHERE slug = ? AND author_id = ? AND status = 'pending'`, slug, u.ID)
+	if err != nil {
+		return nil, saveFailed(http.StatusInternalServerError, "query error")
+	}
+	var superseded []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			superseded = append(superseded, id)
+		}
+	}
+	rows.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.Exec(`INSERT INTO document_revisions(slug,target,query,content,base_hash,author_id,author,status,created_at) VALUES(?,?,?,?,?,?,?,'pending',?)`,
+		slug, slug, opts.query(), string(body), baseHash, u.ID, u.Username, now)
+	if err != nil {
+		return nil, saveFailed(http.StatusInternalServerError, "db update failed")
+	}
+	id, _ := res.LastInsertId()
+	for _, old := range superseded {
+		db.Exec(`UPDATE document_revisions SET status = 'superseded', reviewed_at = ? WHERE id = ?`, now, old)
+		recordRevisionEvent(db, old, u, "supersede", fmt.Sprintf("replaced by revision %d", id))
+	}
+	recordRevisionEvent(db, id, u, "propose", "")
+	events.Publish(events.ReviewRequested, slug, u.Username, map[string]any{
+		"revision_id": id,
+		"approvers":   policy.Approvers,
+	})
+	return &revisionProposal{
+		Slug:       slug,
+		RevisionID: id,
+		Status:     "pending",
+		Folder:     policy.Folder,
+		Approvers:  policy.Approvers,
+	}, nil
+}
+
+func currentDocumentContent(db *sql.DB, slug string) ([]byte, bool) {
+	var path string
+	if err := db.QueryRow(`SELECT path FROM documents WHERE slug = ?`, slug).Scan(&path); err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+const revisionColumns = `id,slug,target,COALESCE(query,''),content,COALESCE(base_hash,''),COALESCE(author_id,0),COALESCE(author,''),status,COALESCE(reviewer,''),COALESCE(comment,''),COALESCE(created_at,''),COALESCE(reviewed_at,'')`
+
+func scanRevision(scan func(...any) error) (revisionRecord, error) {
+	var rec revisionRecord
+	err := scan(&rec.ID, &rec.Slug, &rec.target, &rec.query, &rec.content, &rec.baseHash, &rec.authorID, &rec.Author,
+		&rec.Status, &rec.Reviewer, &rec.Comment, &rec.CreatedAt, &rec.ReviewedAt)
+	if err == nil {
+		rec.Title = extractTitle(rec.content)
+	}
+	return rec, err
+}
+
+func loadRevision(db *sql.DB, id int64) (revisionRecord, error) {
+	return scanRevision(db.QueryRow(`SELECT `+revisionColumns+` FROM document_revisions WHERE id = ?`, id).Scan)
+}
+
+func revisionIDParam(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+func canReview(policy reviewPolicy, found bool, user *auth.User) bool {
+	if user == nil {
+		return false
+	}
+	if !found {
+		return user.Role == "Admin" || user.Role == "Owner"
+	}
+	return containsString(policy.Approvers, user.Username)
+}
+
+// checkReviewPolicy writes 403 unless the caller may change slugs directly.
+// Moves, status changes and restores cannot be proposed as a revision, so in
+// a reviewed folder, or a folder containing one when subtree is set, they are
+// limited to the folder's approvers.
+func checkReviewPolicy(w http.ResponseWriter, r *http.Request, db *sql.DB, subtree bool, slugs ...string) bool {
+	policies, err := loadReviewPolicies(db)
+	if err != nil {
+		docErr(w, http.StatusInternalServerError, "query error")
+		return false
+	}
+	u := auth.UserFromContext(r)
+	for _, slug := range slugs {
+		gated := []reviewPolicy{}
+		if policy, found := matchReviewPolicy(policies, slug); found {
+			gated = append(gated, policy)
+		}
+		if subtree {
+			for _, policy := range policies {
+				if strings.HasPrefix(policy.Folder, slug+"/") {
+					gated = append(gated, policy)
+				}
+			}
+		}
+		for _, policy := range gated {
+			if !canReview(policy, true, u) {
+				httpx.WriteError(w, http.StatusForbidden, "REVIEW_REQUIRED",
+					fmt.Sprintf("%s requires review; only its approvers can change it directly", policy.Folder))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// canViewRevision reports whether user may read rec: its author, the
+// folder's approvers and admins can.
+func canViewRevision(policy reviewPolicy, found bool, user *auth.User, rec revisionRecord) bool {
+	if user == nil {
+		return false
+	}
+	if rec.authorID == user.ID || user.Role == "Admin" || user.Role == "Owner" {
+		return true
+	}
+	return canReview(policy, found, user)
+}
+
+// approvesAny reports whether user may see revisions beyond their own.
+func approvesAny(policies []reviewPolicy, user *auth.User) bool {
+	if user.Role == "Admin" || user.Role == "Owner" {
+		return true
+	}
+	for _, policy := range policies {
+		if containsString(policy.Approvers, user.Username) {
+			return true
+		}
+	}
+	return false
+}
+
+func listReviewPoliciesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policies, err := loadReviewPolicies(db)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, policies)
+	}
+}
+
+func saveReviewPolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req reviewPolicy
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		folder := cleanSlugParam(req.Folder)
+		if folder == "" || strings.Contains(folder, "..") {
+			docErr(w, http.StatusBadRequest, "invalid folder")
+			return
+		}
+		approvers := []string{}
+		for _, name := range req.Approvers {
+			name = strings.TrimSpace(name)
+			if name == "" || containsString(approvers, name) {
+				continue
+			}
+			var exists int
+			if err := db.QueryRow(`SELECT COUNT(1) FROM users WHERE username = ?`, name).Scan(&exists); err != nil {
+				docErr(w, http.StatusInternalServerError, "query error")
+				return
+			}
+			if exists == 0 {
+				httpx.WriteError(w, http.StatusBadRequest, "UNKNOWN_APPROVER", fmt.Sprintf("unknown user %q", name))
+				return
+			}
+			approvers = append(approvers, name)
+		}
+		if len(approvers) == 0 {
+			docErr(w, http.StatusBadRequest, "missing approvers")
+			return
+		}
+		u := auth.UserFromContext(r)
+		encoded, _ := json.Marshal(approvers)
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := db.Exec(`INSERT INTO review_policies(folder,approvers,updated_by,updated_at) VALUES(?,?,?,?)
+			ON CONFLICT(folder) DO UPDATE SET approvers=excluded.approvers, updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+			folder, string(encoded), u.Username, now); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "set_review_policy", folder, string(encoded))
+		httpx.WriteJSON(w, http.StatusOK, reviewPolicy{Folder: folder, Approvers: approvers, UpdatedBy: u.Username, UpdatedAt: now})
+	}
+}
+
+func deleteReviewPolicyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folder := cleanSlugParam(chi.URLParam(r, "*"))
+		res, err := db.Exec(`DELETE FROM review_policies WHERE folder = ?`, folder)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if u := auth.UserFromContext(r); u != nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "delete_review_policy", folder, "")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listRevisionsHandler lists the proposed revisions the current user may
+// see. With queue=mine it returns the pending revisions they may review.
+func listRevisionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		q := r.URL.Query()
+		mine := strings.EqualFold(q.Get("queue"), "mine")
+		status := strings.TrimSpace(q.Get("status"))
+		if status == "" {
+			status = "pending"
+		}
+		query := `SELECT ` + revisionColumns + ` FROM document_revisions WHERE 1=1`
+		var args []any
+		if mine {
+			query += ` AND status = 'pending' AND author_id != ?`
+			args = append(args, u.ID)
+		} else if status != "all" {
+			query += ` AND status = ?`
+			args = append(args, status)
+		}
+		if slug := cleanSlugParam(q.Get("slug")); slug != "" {
+			query += ` AND slug = ?`
+			args = append(args, slug)
+		}
+		if author := strings.TrimSpace(q.Get("author")); author != "" {
+			query += ` AND author = ?`
+			args = append(args, author)
+		}
+		policies, err := loadReviewPolicies(db)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if !mine && !approvesAny(policies, u) {
+			query += ` AND author_id = ?`
+			args = append(args, u.ID)
+		}
+		query += ` ORDER BY id DESC LIMIT 200`
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []revisionRow{}
+		for rows.Next() {
+			rec, err := scanRevision(rows.Scan)
+			if err != nil {
+				docErr(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			policy, found := matchSavePolicy(policies, rec.Slug, rec.renameTo())
+			if mine && !canReview(policy, found, u) || !canViewRevision(policy, found, u, rec) {
+				continue
+			}
+			rec.Folder = policy.Folder
+			out = append(out, rec.revisionRow)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func revisionDetailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := revisionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		rec, err := loadRevision(db, id)
+		if err == sql.ErrNoRows {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		policy, found := reviewPolicyFor(db, rec.Slug, rec.renameTo())
+		if !canViewRevision(policy, found, auth.UserFromContext(r), rec) {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		rec.Folder = policy.Folder
+		current, exists := currentDocumentContent(db, rec.Slug)
+		currentHash := ""
+		if exists {
+			currentHash = contentHash(current)
+		}
+		resp := revisionDetailResponse{
+			revisionRow: rec.revisionRow,
+			Content:     rec.content,
+			Approvers:   policy.Approvers,
+			Stale:       rec.Status == "pending" && currentHash != rec.baseHash,
+			Segments:    diffSegments(string(current), rec.content),
+			Events:      []revisionEvent{},
+		}
+		if resp.Approvers == nil {
+			resp.Approvers = []string{}
+		}
+		rows, err := db.Query(`SELECT COALESCE(actor,''),action,COALESCE(comment,''),COALESCE(created_at,'') FROM revision_events WHERE revision_id = ? ORDER BY id`, id)
+		if err == nil {
+			for rows.Next() {
+				var ev revisionEvent
+				if rows.Scan(&ev.Actor, &ev.Action, &ev.Comment, &ev.CreatedAt) == nil {
+					resp.Events = append(resp.Events, ev)
+				}
+			}
+			rows.Close()
+		}
+		httpx.WriteJSON(w, http.StatusOK, resp)
+	}
+}
+
+// reviewRevisionHandler approves or rejects a pending revision. Approval
+// replays the stored save through saveDocument.
+func reviewRevisionHandler(db *sql.DB, approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		id, ok := revisionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		comment := strings.TrimSpace(req.Comment)
+		if !approve && comment == "" {
+			docErr(w, http.StatusBadRequest, "comment required")
+			return
+		}
+		rec, err := loadRevision(db, id)
+		if err == sql.ErrNoRows {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if rec.Status != "pending" {
+			docErr(w, http.StatusConflict, "revision is "+rec.Status)
+			return
+		}
+		policy, found := reviewPolicyFor(db, rec.Slug, rec.renameTo())
+		if !canReview(policy, found, u) {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "not an approver for this folder")
+			return
+		}
+		if rec.authorID == u.ID {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "authors cannot review their own revisions")
+			return
+		}
+
+		status := "rejected"
+		if approve {
+			status = "approved"
+			currentHash := ""
+			if current, exists := currentDocumentContent(db, rec.Slug); exists {
+				currentHash = contentHash(current)
+			}
+			if currentHash != rec.baseHash {
+				httpx.WriteError(w, http.StatusConflict, "STALE_REVISION", "the document changed since this revision was proposed")
+				return
+			}
+			content := rec.content
+			if meta, _ := parseDocumentMetadata(content); meta.Owner == "" && rec.Author != "" {
+				content, _ = setFrontMatterField(content, "owner", rec.Author)
+			}
+			slug, explicitIndex := slugParamInfo(rec.target)
+			query, _ := url.ParseQuery(rec.query)
+			opts := saveOptionsFromQuery(query, explicitIndex)
+			opts.Approved = true
+			if _, err := saveDocument(r.Context(), db, u, slug, []byte(content), opts); err != nil {
+				writeSaveError(w, err)
+				return
+			}
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := db.Exec(`UPDATE document_revisions SET status = ?, reviewer = ?, comment = ?, reviewed_at = ? WHERE id = ?`,
+			status, u.Username, comment, now, id); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		action := "reject"
+		if approve {
+			action = "approve"
+		}
+		recordRevisionEvent(db, id, u, action, comment)
+		rec.Status = status
+		rec.Reviewer = u.Username
+		rec.Comment = comment
+		rec.ReviewedAt = now
+		rec.Folder = policy.Folder
+		httpx.WriteJSON(w, http.StatusOK, rec.revisionRow)
+	}
+}
+
+func withdrawRevisionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		id, ok := revisionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		rec, err := loadRevision(db, id)
+		if err == sql.ErrNoRows {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if rec.authorID != u.ID {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "only the author can withdraw a revision")
+			return
+		}
+		if rec.Status != "pending" {
+			docErr(w, http.StatusConflict, "revision is "+rec.Status)
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		db.Exec(`UPDATE document_revisions SET status = 'withdrawn', reviewed_at = ? WHERE id = ?`, now, id)
+		recordRevisionEvent(db, id, u, "withdraw", "")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -12,11 +12,37 @@ func RegisterRoutes(r chi.Router, db *sql.DB) {
 	r.Get("/documents", listDocumentsHandler(db))
 	r.Get("/documents/search", searchDocumentsHandler(db))
 	r.Get("/documents/tree", navTreeHandler(db))
+	r.Get("/documents/graph", documentGraphHandler(db))
+	r.Post("/documents/query", documentQueryHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/documents/schedule", upcomingTransitionsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/documents/link-health", linkHealthHandler(db))
+	r.Get("/tags", listTagsHandler(db))
+	r.Get("/tag/*", tagDocumentsHandler(db))
+	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Post("/tags/rename", renameTagHandler(db))
+	r.Get("/templates", listTemplatesHandler(db))
+	r.Get("/template/*", templateDetailHandler(db))
+	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Put("/template/*", templateSaveHandler(db))
+	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Delete("/template/*", templateDeleteHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/documents/from-template", createFromTemplateHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/reviews", listRevisionsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/reviews/policies", listReviewPoliciesHandler(db))
+	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Put("/reviews/policies", saveReviewPolicyHandler(db))
+	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Delete("/reviews/policies/*", deleteReviewPolicyHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/review/{id}", revisionDetailHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/review/{id}/approve", reviewRevisionHandler(db, true))
+	r.With(auth.AuthMiddleware(db)).Post("/review/{id}/reject", reviewRevisionHandler(db, false))
+	r.With(auth.AuthMiddleware(db)).Post("/review/{id}/withdraw", withdrawRevisionHandler(db))
 	r.With(auth.AuthMiddleware(db)).Get("/drafts/tree", draftsTreeHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/draft/shares/*", draftSharesHandler(db))
+	r.With(auth.AuthMiddleware(db)).Put("/draft/shares/*", draftShareHandler(db))
+	r.With(auth.AuthMiddleware(db)).Delete("/draft/shares/*", draftUnshareHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/draft/publish/*", draftPublishHandler(db))
 	r.With(auth.AuthMiddleware(db)).Get("/draft/*", draftDetailHandler(db))
 	r.With(auth.AuthMiddleware(db)).Post("/draft/*", draftSaveHandler(db))
 	r.With(auth.AuthMiddleware(db)).Delete("/draft/*", draftDeleteHandler(db))
 	r.Get("/document/backlinks/*", backlinksHandler(db))
+	r.Get("/document/render/*", documentRenderHandler(db))
+	r.Get("/document/outline/*", documentOutlineHandler(db))
 	r.With(auth.AuthMiddleware(db)).Put("/document/status/*", documentStatusHandler(db))
 	r.Get("/document/*", documentDetailHandler(db))
 	r.With(auth.AuthMiddleware(db)).Post("/document/*", documentSaveHandler(db))
@@ -26,9 +52,33 @@ func RegisterRoutes(r chi.Router, db *sql.DB) {
 	r.With(auth.AuthMiddleware(db)).Delete("/document/pin/*", documentPinHandler(db, false))
 	r.With(auth.AuthMiddleware(db)).Put("/document/home/*", documentHomeHandler(db, true))
 	r.With(auth.AuthMiddleware(db)).Delete("/document/home/*", documentHomeHandler(db, false))
+	r.With(auth.AuthMiddleware(db)).Put("/document/lock/*", documentLockHandler(db))
+	r.With(auth.AuthMiddleware(db)).Delete("/document/lock/*", documentUnlockHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/document/comments/*", listDocumentCommentsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/document/comments/*", createCommentThreadHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/comments", listCommentsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/comment-threads/{id}/replies", replyCommentThreadHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/comment-threads/{id}/resolve", resolveCommentThreadHandler(db, true))
+	r.With(auth.AuthMiddleware(db)).Post("/comment-threads/{id}/reopen", resolveCommentThreadHandler(db, false))
+	r.With(auth.AuthMiddleware(db)).Delete("/comment-threads/{id}", deleteCommentThreadHandler(db))
+	r.With(auth.AuthMiddleware(db)).Put("/comments/{id}", editCommentHandler(db))
+	r.With(auth.AuthMiddleware(db)).Delete("/comments/{id}", deleteCommentHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/document/suggest/*", suggestDocumentHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/document/suggestions/*", listDocumentSuggestionsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/suggestions", listSuggestionsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/suggestion/{id}", suggestionDetailHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/suggestion/{id}/accept", reviewSuggestionHandler(db, true))
+	r.With(auth.AuthMiddleware(db)).Post("/suggestion/{id}/reject", reviewSuggestionHandler(db, false))
+	r.With(auth.AuthMiddleware(db)).Delete("/suggestion/{id}", withdrawSuggestionHandler(db))
 	r.With(auth.AuthMiddleware(db)).Get("/document/presence/*", documentPresenceListHandler(db))
 	r.With(auth.AuthMiddleware(db)).Post("/document/presence/*", documentPresenceUpdateHandler(db))
 	r.With(auth.AuthMiddleware(db)).Get("/documenthistory/*", documentHistoryHandler(db))
 	r.With(auth.AuthMiddleware(db)).Get("/documenthistory/diff/*", documentHistoryDiffHandler(db))
 	r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner")).Post("/documentrestore/*", documentRestoreHandler(db))
 }
+
+// RegisterRealtimeRoutes registers long-lived connections, which must not be
+// subject to the API request timeout.
+func RegisterRealtimeRoutes(r chi.Router, db *sql.DB) {
+	r.With(auth.AuthMiddleware(db)).Get("/api/document/collab/*", documentCollabHandler(db))
+}
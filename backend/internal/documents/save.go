@@ -0,0 +1,482 @@
+package documents
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+	"atlas/internal/random"
+)
+
+// saveOptions are the parts of a save other than the content.
+type saveOptions struct {
+	Hub       bool
+	Overwrite bool
+	RenameTo  string
+	// Note replaces the history note recorded for an edit.
+	Note string
+	// Draft is the revision the caller's draft started from. The content is
+	// rebased onto the current document when it changed since. Base, when it
+	// equals the current hash, accepts the content as already resolved.
+	Draft *draftBase
+	Base  string
+	// Approved writes to a reviewed folder instead of proposing a revision.
+	Approved bool
+}
+
+// saveResult describes a written document, or the proposal stored in its
+// place when the folder requires review.
+type saveResult struct {
+	Slug        string
+	DocID       string
+	Revision    string
+	Created     bool
+	RenamedFrom string
+	Proposal    *revisionProposal
+}
+
+// saveError is a failed save with the HTTP status it maps to. A non-nil body
+// is written as the whole response.
+type saveError struct {
+	status  int
+	code    string
+	message string
+	body    any
+}
+
+func (e *saveError) Error() string {
+	if e.message == "" {
+		return http.StatusText(e.status)
+	}
+	return e.message
+}
+
+func saveFailed(status int, message string) error {
+	return &saveError{status: status, message: message}
+}
+
+func writeSaveError(w http.ResponseWriter, err error) {
+	var se *saveError
+	if !errors.As(err, &se) {
+		docErr(w, http.StatusInternalServerError, "save failed")
+		return
+	}
+	switch {
+	case se.body != nil:
+		httpx.WriteJSON(w, se.status, se.body)
+	case se.code != "":
+		httpx.WriteError(w, se.status, se.code, se.message)
+	default:
+		docErr(w, se.status, se.message)
+	}
+}
+
+// writeSaveResult writes the response of the document save endpoint.
+func writeSaveResult(w http.ResponseWriter, res saveResult) {
+	if res.Proposal != nil {
+		httpx.WriteJSON(w, http.StatusAccepted, res.Proposal)
+		return
+	}
+	w.Header().Set("ETag", res.Revision)
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"slug": res.Slug, "revision": res.Revision})
+}
+
+func flagParam(q url.Values, name string) (value, set bool) {
+	switch strings.TrimSpace(strings.ToLower(q.Get(name))) {
+	case "1", "true", "yes":
+		return true, true
+	case "0", "false", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// saveOptionsFromQuery reads the save endpoint's query parameters. hub
+// defaults to whether the slug named an _index.md explicitly.
+func saveOptionsFromQuery(q url.Values, explicitIndex bool) saveOptions {
+	opts := saveOptions{Hub: explicitIndex}
+	if hub, set := flagParam(q, "hub"); set {
+		opts.Hub = hub
+	}
+	opts.Overwrite, _ = flagParam(q, "overwrite")
+	opts.RenameTo = strings.TrimSpace(q.Get("rename_to"))
+	opts.Base = strings.TrimSpace(q.Get("base"))
+	return opts
+}
+
+// query encodes the options a proposed revision replays on approval.
+func (o saveOptions) query() string {
+	q := url.Values{}
+	if o.Hub {
+		q.Set("hub", "1")
+	}
+	if o.Overwrite {
+		q.Set("overwrite", "1")
+	}
+	if o.RenameTo != "" {
+		q.Set("rename_to", o.RenameTo)
+	}
+	return q.Encode()
+}
+
+// renameSlug returns the slug a rename_to value moves a document to.
+func renameSlug(raw string) string {
+	if slug := slugify(raw); slug != "" {
+		return slug
+	}
+	return "untitled"
+}
+
+// saveDocument writes content as slug on behalf of user through the full save
+// pipeline: history, index, links, aliases and events. Saves to a reviewed
+// folder are stored as a proposal unless opts.Approved is set. Callers
+// enforce If-Match themselves.
+func saveDocument(ctx context.Context, db *sql.DB, user *auth.User, slug string, body []byte, opts saveOptions) (saveResult, error) {
+	if err := ctx.Err(); err != nil {
+		return saveResult{}, err
+	}
+	actor := ""
+	if user != nil {
+		actor = user.Username
+	}
+	if resp, locked := lockedByOther(db, user, slug, false); locked {
+		return saveResult{}, &saveError{status: http.StatusLocked, body: resp}
+	}
+	if opts.Draft != nil {
+		merged, conflict := rebaseDraft(db, *opts.Draft, slug, body, opts.Base)
+		if conflict != nil {
+			return saveResult{}, &saveError{status: http.StatusConflict, body: conflict}
+		}
+		body = merged
+	}
+	if !opts.Approved {
+		if policy, gated := reviewPolicyFor(db, slug, opts.RenameTo); gated {
+			proposal, err := proposeRevision(db, user, policy, slug, opts, body)
+			if err != nil {
+				return saveResult{}, err
+			}
+			return saveResult{Slug: slug, Proposal: proposal}, nil
+		}
+	}
+	content := string(body)
+	meta, _ := parseDocumentMetadata(content)
+
+	var metadataErr error
+	content, metadataErr = ensureDocumentMetadata(content, &meta, user)
+	if metadataErr != nil {
+		return saveResult{}, &saveError{status: http.StatusBadRequest, code: "INVALID_METADATA", message: metadataErr.Error()}
+	}
+
+	if meta.ID == "" {
+		meta.ID = "doc-" + random.GenerateToken(12)
+		if updated, changed := ensureFrontMatterID(content, meta.ID); changed {
+			content = updated
+		}
+	}
+
+	var overwriteTargetDocID sql.NullString
+	var overwriteTargetStatus sql.NullString
+	if opts.RenameTo != "" {
+		newSlug := renameSlug(opts.RenameTo)
+		if newSlug != slug {
+			if err := db.QueryRow(`SELECT doc_id,status FROM documents WHERE slug = ?`, newSlug).Scan(&overwriteTargetDocID, &overwriteTargetStatus); err != nil {
+				if err != sql.ErrNoRows {
+					return saveResult{}, saveFailed(http.StatusInternalServerError, "query error")
+				}
+				overwriteTargetDocID = sql.NullString{}
+				overwriteTargetStatus = sql.NullString{}
+			}
+			if overwriteTargetDocID.Valid {
+				if overwriteTargetDocID.String == "" {
+					if !opts.Overwrite {
+						return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+					}
+				} else if overwriteTargetDocID.String != meta.ID {
+					if !opts.Overwrite {
+						return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+					}
+					meta.ID = overwriteTargetDocID.String
+					if updated, changed := setFrontMatterField(content, "id", meta.ID); changed {
+						content = updated
+					}
+				}
+			}
+			if updated, changed := withFrontMatterAlias(content, slug, newSlug); changed {
+				content = updated
+			}
+		}
+	}
+
+	if opts.RenameTo == "" {
+		var existingDocID sql.NullString
+		var existingStatus sql.NullString
+		if err := db.QueryRow(`SELECT doc_id,status FROM documents WHERE slug = ?`, slug).Scan(&existingDocID, &existingStatus); err == nil {
+			if existingDocID.String != "" && existingDocID.String != meta.ID {
+				if !opts.Overwrite {
+					return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+				}
+				meta.ID = existingDocID.String
+				if updated, changed := setFrontMatterField(content, "id", meta.ID); changed {
+					content = updated
+				}
+			}
+		} else if err != sql.ErrNoRows {
+			return saveResult{}, saveFailed(http.StatusInternalServerError, "query error")
+		}
+	}
+
+	body = []byte(content)
+
+	currentPath, currentStatus, _ := findDocumentPath(slug, opts.Hub)
+
+	isNew := false
+	if _, err := os.Stat(currentPath); os.IsNotExist(err) {
+		isNew = true
+		if isReservedSlug(slug) {
+			return saveResult{}, saveFailed(http.StatusBadRequest, "reserved slug")
+		}
+	}
+
+	var previousStatus sql.NullString
+	if !isNew {
+		db.QueryRow(`SELECT status FROM documents WHERE slug = ?`, slug).Scan(&previousStatus)
+	}
+
+	targetPath, err := docPathFromSlugWithHint(slug, meta.Status, opts.Hub)
+	if err != nil {
+		return saveResult{}, saveFailed(http.StatusBadRequest, "invalid slug")
+	}
+
+	if !isNew && (currentStatus != meta.Status || currentPath != targetPath) {
+		targetPath, err = moveDocumentToStatus(currentPath, slug, meta.Status, opts.Hub)
+		if err != nil {
+			return saveResult{}, saveFailed(http.StatusInternalServerError, "move failed")
+		}
+	}
+
+	path := targetPath
+	os.MkdirAll(filepath.Dir(path), 0o755)
+
+	existed := false
+	if _, err := os.Stat(path); err == nil {
+		existed = true
+		note := "edited (anonymous)"
+		if user != nil {
+			note = fmt.Sprintf("%s edited", user.Username)
+		}
+		if opts.Note != "" {
+			note = opts.Note
+		}
+		recordHistory(db, slug, note, mustReadFile(path))
+	}
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return saveResult{}, saveFailed(http.StatusInternalServerError, "write failed")
+	}
+
+	if !existed {
+		note := "created (anonymous)"
+		if user != nil {
+			note = fmt.Sprintf("%s created", user.Username)
+		}
+		recordHistory(db, slug, note, body)
+	}
+
+	var oldSlugVal string
+	wasStartPage := false
+	if opts.RenameTo != "" {
+		newSlug := renameSlug(opts.RenameTo)
+		if newSlug != slug {
+			if isReservedSlug(newSlug) {
+				return saveResult{}, saveFailed(http.StatusBadRequest, "reserved slug")
+			}
+
+			if overwriteTargetDocID.Valid {
+				if overwriteTargetDocID.String == "" {
+					if !opts.Overwrite {
+						return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+					}
+				} else if overwriteTargetDocID.String != meta.ID {
+					return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+				}
+			}
+
+			useIndexLayout := strings.EqualFold(filepath.Base(path), "_index.md")
+			var newPath string
+			var pErr error
+			if useIndexLayout {
+				newPath, pErr = docPathFromSlugWithHint(newSlug, meta.Status, true)
+			} else {
+				newPath, pErr = docPathFromSlug(newSlug, meta.Status)
+			}
+			if pErr != nil {
+				return saveResult{}, saveFailed(http.StatusBadRequest, "invalid new slug")
+			}
+			if info, statErr := os.Stat(newPath); statErr == nil {
+				if info.IsDir() || !opts.Overwrite {
+					return saveResult{}, saveFailed(http.StatusConflict, "slug exists")
+				}
+				if err := os.Remove(newPath); err != nil {
+					return saveResult{}, saveFailed(http.StatusInternalServerError, "overwrite failed")
+				}
+			}
+			var sIsStart int
+			if err := db.QueryRow(`SELECT is_start_page FROM documents WHERE slug = ?`, slug).Scan(&sIsStart); err == nil && sIsStart != 0 {
+				wasStartPage = true
+			}
+
+			if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+				return saveResult{}, saveFailed(http.StatusInternalServerError, "write failed")
+			}
+
+			if err := os.Rename(path, newPath); err != nil {
+				return saveResult{}, saveFailed(http.StatusInternalServerError, "rename failed")
+			}
+			oldSlugVal = slug
+			slug = newSlug
+			path = newPath
+
+			db.Exec(`UPDATE history SET page_slug = ? WHERE page_slug = ?`, slug, oldSlugVal)
+		}
+	}
+
+	if oldSlugVal != "" && oldSlugVal != slug {
+		if _, err := db.Exec(`DELETE FROM documents WHERE slug = ?`, oldSlugVal); err != nil {
+			return saveResult{}, saveFailed(http.StatusInternalServerError, "db update failed")
+		}
+		db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE slug = ?)`, oldSlugVal)
+	}
+
+	title := extractTitle(content)
+	status := meta.Status
+	if status == "" {
+		status = "published"
+	}
+	parent := parentSlug(slug)
+	var parentVal sql.NullString
+	if parent != "" {
+		parentVal = sql.NullString{String: parent, Valid: true}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	createdAt := now
+
+	homeVal := 1
+	if meta.ID != "" {
+		var existingHome sql.NullInt64
+		if err := db.QueryRow(`SELECT is_home FROM documents WHERE doc_id = ?`, meta.ID).Scan(&existingHome); err == nil {
+			if existingHome.Valid {
+				homeVal = int(existingHome.Int64)
+			}
+		} else if err != sql.ErrNoRows {
+			return saveResult{}, saveFailed(http.StatusInternalServerError, "query error")
+		}
+	}
+
+	linkTokens := extractDocLinkTokens(stripFrontMatter(content))
+	slugMap := resolveLinkSlugs(db, linkTokens)
+	slugMap[slug] = meta.ID
+
+	var docCount int
+	_ = db.QueryRow(`SELECT COUNT(1) FROM documents`).Scan(&docCount)
+	isFirst := docCount == 0
+
+	var isStart int
+	if err := db.QueryRow(`SELECT is_start_page FROM documents WHERE slug = ?`, slug).Scan(&isStart); err != nil && err != sql.ErrNoRows {
+		return saveResult{}, saveFailed(http.StatusInternalServerError, "query error")
+	}
+
+	_, err = db.Exec(`INSERT INTO documents(doc_id,slug,title,path,parent_slug,status,owner,created_at,updated_at,is_home)
+		VALUES(?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(slug) DO UPDATE SET doc_id=excluded.doc_id, title=excluded.title, path=excluded.path, parent_slug=excluded.parent_slug, status=excluded.status, owner=excluded.owner, updated_at=excluded.updated_at;`,
+		meta.ID, slug, title, path, parentVal, status, meta.Owner, createdAt, now, homeVal)
+	if err != nil {
+		return saveResult{}, saveFailed(http.StatusInternalServerError, "db update failed")
+	}
+
+	db.Exec(`DELETE FROM documents_fts WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, meta.ID)
+	headings := documentHeadings(content)
+	db.Exec(`INSERT INTO documents_fts(rowid,slug,title,body,headings) VALUES((SELECT id FROM documents WHERE doc_id = ?),?,?,?,?)`, meta.ID, slug, title, expandEmbeds(db, meta.ID, string(body)), headingsText(headings))
+	savedMeta, _ := parseDocumentMetadata(content)
+	syncDocumentAliases(db, meta.ID, slug, savedMeta.Aliases)
+	storeDocumentMetadata(db, meta.ID, savedMeta)
+	storeDocumentLinks(db, meta.ID, linkTokens, slugMap)
+	storeDocumentHeadings(db, meta.ID, headings)
+	reanchorComments(db, meta.ID, stripFrontMatter(content))
+	resolveGhostLinks(db, meta.ID, slug, savedMeta.Aliases)
+	reindexEmbedders(db, meta.ID)
+	linkHealth.update(path, meta.ID, slug, content)
+	applySchedules(db, time.Now(), slug)
+
+	if wasStartPage {
+		_ = SetStartPageSlug(db, slug)
+	}
+
+	if user != nil {
+		db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, user.ID, "edit_document", slug)
+		clearUserDraftBySlug(db, user, slug)
+		if oldSlugVal != "" && oldSlugVal != slug {
+			clearUserDraftBySlug(db, user, oldSlugVal)
+		}
+	}
+	if oldSlugVal != "" && oldSlugVal != slug {
+		relinkReferencingDocuments(db, user, map[string]string{oldSlugVal: slug}, []string{meta.ID})
+	}
+	if isFirst {
+		EnsureStartPageMeta(db, slug, true)
+	}
+	if slug == "start-page" {
+		seededSlugs := seedDefaultStructureIfNeeded(db)
+
+		if len(seededSlugs) > 0 {
+			if err := SyncContentIndex(db); err != nil {
+
+				log.Printf("sync after seed: %v", err)
+			}
+			var placeholders strings.Builder
+			args := make([]any, len(seededSlugs))
+			for i, s := range seededSlugs {
+				if i > 0 {
+					placeholders.WriteString(",")
+				}
+				placeholders.WriteString("?")
+				args[i] = s
+			}
+			_, err := db.Exec(fmt.Sprintf("UPDATE documents SET is_home = 1 WHERE slug IN (%s)", placeholders.String()), args...)
+			if err != nil {
+				log.Printf("set seeded home flag: %v", err)
+			}
+		}
+	}
+	revision := documentETag(body)
+	events.Publish(events.DocumentSaved, slug, actor, events.DocumentSavedData{
+		DocID:       meta.ID,
+		Revision:    revision,
+		Created:     !existed,
+		RenamedFrom: oldSlugVal,
+	})
+	if oldSlugVal != "" {
+		events.Publish(events.DocumentMoved, slug, actor, events.DocumentMovedData{From: oldSlugVal, To: slug})
+	}
+	if previousStatus.Valid && previousStatus.String != status {
+		events.Publish(events.DocumentStatus, slug, actor, events.DocumentStatusData{Status: status})
+	}
+	events.Publish(events.TreeChanged, slug, actor, nil)
+	return saveResult{
+		Slug:        slug,
+		DocID:       meta.ID,
+		Revision:    revision,
+		Created:     !existed,
+		RenamedFrom: oldSlugVal,
+	}, nil
+}
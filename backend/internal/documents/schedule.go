@@ -0,0 +1,207 @@
+package documents
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+)
+
+const scheduleInterval = time.Minute
+
+var scheduleLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+type scheduledDoc struct {
+	DocID     string
+	Slug      string
+	Title     string
+	Status    string
+	PublishAt string
+	ExpireAt  string
+	State     string
+}
+
+type scheduleTransition struct {
+	DocID        string `json:"doc_id"`
+	Slug         string `json:"slug"`
+	Title        string `json:"title"`
+	Status       string `json:"status"`
+	Action       string `json:"action"`
+	TargetStatus string `json:"target_status"`
+	At           string `json:"at"`
+}
+
+// parseScheduleTime accepts RFC 3339 timestamps as well as dates and times
+// without an offset, which are read in the workspace timezone.
+func parseScheduleTime(raw string, loc *time.Location) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	for _, layout := range scheduleLayouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dueTransition returns the action that applies to doc at now and the status
+// it implies. Expiry wins over publishing; before publish_at the page is held
+// back as unlisted.
+func (doc scheduledDoc) dueTransition(now time.Time, loc *time.Location) (action, status, key string) {
+	if expire, ok := parseScheduleTime(doc.ExpireAt, loc); ok && !now.Before(expire) {
+		return "expire", "unlisted", "expire@" + doc.ExpireAt
+	}
+	publish, ok := parseScheduleTime(doc.PublishAt, loc)
+	if !ok {
+		return "", "", ""
+	}
+	if now.Before(publish) {
+		return "hold", "unlisted", "hold@" + doc.PublishAt
+	}
+	return "publish", "published", "publish@" + doc.PublishAt
+}
+
+func loadScheduledDocs(db *sql.DB, slug string) ([]scheduledDoc, error) {
+	query := `SELECT COALESCE(doc_id,''),slug,COALESCE(title,''),status,COALESCE(publish_at,''),COALESCE(expire_at,''),COALESCE(schedule_state,'')
+		FROM documents WHERE (publish_at IS NOT NULL OR expire_at IS NOT NULL)`
+	var args []any
+	if slug != "" {
+		query += ` AND slug = ?`
+		args = append(args, slug)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []scheduledDoc
+	for rows.Next() {
+		var doc scheduledDoc
+		if err := rows.Scan(&doc.DocID, &doc.Slug, &doc.Title, &doc.Status, &doc.PublishAt, &doc.ExpireAt, &doc.State); err != nil {
+			return nil, err
+		}
+		out = append(out, doc)
+	}
+	return out, rows.Err()
+}
+
+// applySchedules runs due publish and expiry transitions. Each transition is
+// applied once, so a manual status change afterwards is left alone until the
+// schedule itself is edited. An empty slug checks every scheduled document.
+func applySchedules(db *sql.DB, now time.Time, slug string) {
+	docs, err := loadScheduledDocs(db, slug)
+	if err != nil {
+		log.Printf("load schedules: %v", err)
+		return
+	}
+	if len(docs) == 0 {
+		return
+	}
+	loc := workspaceLocation(db)
+	for _, doc := range docs {
+		action, status, key := doc.dueTransition(now, loc)
+		if key == "" || key == doc.State {
+			continue
+		}
+		if doc.Status != status {
+			note := fmt.Sprintf("scheduler set status to %s (%s)", status, strings.TrimPrefix(key, action+"@"))
+			if err := applyDocumentStatus(db, doc.Slug, status, false, note); err != nil {
+				log.Printf("scheduled %s %s: %v", action, doc.Slug, err)
+				continue
+			}
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, nil, "scheduled_"+action, doc.Slug, note)
+			events.Publish(events.DocumentStatus, doc.Slug, "", events.DocumentStatusData{Status: status})
+			events.Publish(events.TreeChanged, doc.Slug, "", nil)
+		}
+		db.Exec(`UPDATE documents SET schedule_state = ? WHERE slug = ?`, key, doc.Slug)
+	}
+}
+
+// StartScheduler applies scheduled publish and expiry transitions until ctx
+// is cancelled.
+func StartScheduler(ctx context.Context, db *sql.DB) {
+	go func() {
+		applySchedules(db, time.Now(), "")
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				applySchedules(db, now, "")
+			}
+		}
+	}()
+}
+
+func upcomingTransitionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		limit := 50
+		if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+			if n, err := strconv.Atoi(raw); err == nil && n > 0 && n <= 500 {
+				limit = n
+			}
+		}
+		docs, err := loadScheduledDocs(db, "")
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		loc := workspaceLocation(db)
+		now := time.Now()
+		type pending struct {
+			at time.Time
+			scheduleTransition
+		}
+		var list []pending
+		for _, doc := range docs {
+			add := func(raw, action, status string) {
+				at, ok := parseScheduleTime(raw, loc)
+				if !ok || !at.After(now) {
+					return
+				}
+				list = append(list, pending{at: at, scheduleTransition: scheduleTransition{
+					DocID:        doc.DocID,
+					Slug:         doc.Slug,
+					Title:        doc.Title,
+					Status:       doc.Status,
+					Action:       action,
+					TargetStatus: status,
+					At:           at.In(loc).Format(time.RFC3339),
+				}})
+			}
+			add(doc.PublishAt, "publish", "published")
+			add(doc.ExpireAt, "expire", "unlisted")
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].at.Before(list[j].at) })
+		out := make([]scheduleTransition, 0, len(list))
+		for i, item := range list {
+			if i >= limit {
+				break
+			}
+			out = append(out, item.scheduleTransition)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
@@ -0,0 +1,507 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/events"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	hunkPending  = "pending"
+	hunkAccepted = "accepted"
+	hunkRejected = "rejected"
+	// hunkProposed marks hunks whose accepted text went to review because
+	// the page is in a reviewed folder.
+	hunkProposed = "proposed"
+)
+
+type suggestionRow struct {
+	ID        int64  `json:"id"`
+	DocID     string `json:"doc_id"`
+	Slug      string `json:"slug"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Note      string `json:"note,omitempty"`
+	Status    string `json:"status"`
+	Reviewer  string `json:"reviewer,omitempty"`
+	BaseHash  string `json:"base_hash"`
+	Stale     bool   `json:"stale"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type suggestionHunk struct {
+	ID       int                  `json:"id"`
+	Line     int                  `json:"line"`
+	Removed  string               `json:"removed"`
+	Added    string               `json:"added"`
+	State    string               `json:"state"`
+	Segments []historyDiffSegment `json:"segments"`
+}
+
+type suggestionDetailResponse struct {
+	suggestionRow
+	Hunks []suggestionHunk `json:"hunks"`
+}
+
+type suggestionRecord struct {
+	suggestionRow
+	base     string
+	content  string
+	states   []string
+	authorID int
+}
+
+const suggestionColumns = `s.id,s.doc_id,COALESCE(d.slug,s.slug),COALESCE(s.author_id,0),COALESCE(s.author,''),COALESCE(s.note,''),s.status,COALESCE(s.reviewer,''),
+	s.base_hash,s.base,s.content,COALESCE(s.hunk_states,''),COALESCE(s.created_at,''),COALESCE(s.updated_at,'')`
+
+func scanSuggestion(scan func(...any) error) (suggestionRecord, error) {
+	var rec suggestionRecord
+	var states string
+	err := scan(&rec.ID, &rec.DocID, &rec.Slug, &rec.authorID, &rec.Author, &rec.Note, &rec.Status, &rec.Reviewer,
+		&rec.BaseHash, &rec.base, &rec.content, &states, &rec.CreatedAt, &rec.UpdatedAt)
+	if err == nil {
+		rec.Title = extractTitle(rec.content)
+		rec.states = stringListFromJSON(states)
+	}
+	return rec, err
+}
+
+func loadSuggestion(db *sql.DB, id int64) (suggestionRecord, error) {
+	return scanSuggestion(db.QueryRow(`SELECT `+suggestionColumns+` FROM document_suggestions s LEFT JOIN documents d ON d.doc_id = s.doc_id WHERE s.id = ?`, id).Scan)
+}
+
+// lineDiffs diffs base and content line by line so hunks cover whole lines.
+func lineDiffs(base, content string) []diffmatchpatch.Diff {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(base, content)
+	return dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+}
+
+// suggestionHunks splits a suggestion into runs of changed lines. Each hunk
+// pairs the base lines it removes with the lines it adds.
+func suggestionHunks(base, content string, states []string) []suggestionHunk {
+	hunks := []suggestionHunk{}
+	line := 1
+	var current *suggestionHunk
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.ID = len(hunks)
+		current.State = hunkPending
+		if current.ID < len(states) && states[current.ID] != "" {
+			current.State = states[current.ID]
+		}
+		current.Segments = diffSegments(current.Removed, current.Added)
+		hunks = append(hunks, *current)
+		current = nil
+	}
+	for _, diff := range lineDiffs(base, content) {
+		if diff.Type == diffmatchpatch.DiffEqual {
+			flush()
+			line += strings.Count(diff.Text, "\n")
+			continue
+		}
+		if current == nil {
+			current = &suggestionHunk{Line: line}
+		}
+		if diff.Type == diffmatchpatch.DiffDelete {
+			current.Removed += diff.Text
+			line += strings.Count(diff.Text, "\n")
+		} else {
+			current.Added += diff.Text
+		}
+	}
+	flush()
+	return hunks
+}
+
+// applyHunks rebuilds base with the hunks listed in accept applied.
+func applyHunks(base, content string, accept map[int]bool) string {
+	var out strings.Builder
+	hunk := -1
+	inHunk := false
+	for _, diff := range lineDiffs(base, content) {
+		if diff.Type == diffmatchpatch.DiffEqual {
+			inHunk = false
+			out.WriteString(diff.Text)
+			continue
+		}
+		if !inHunk {
+			hunk++
+			inHunk = true
+		}
+		if (diff.Type == diffmatchpatch.DiffInsert) == accept[hunk] {
+			out.WriteString(diff.Text)
+		}
+	}
+	return out.String()
+}
+
+// suggestionStatus summarises hunk decisions. A fully reviewed suggestion
+// counts as accepted when any of its hunks was.
+func suggestionStatus(states []string, count int) string {
+	accepted, rejected, proposed := 0, 0, 0
+	for i := 0; i < count; i++ {
+		switch {
+		case i < len(states) && states[i] == hunkAccepted:
+			accepted++
+		case i < len(states) && states[i] == hunkRejected:
+			rejected++
+		case i < len(states) && states[i] == hunkProposed:
+			proposed++
+		}
+	}
+	switch {
+	case accepted+rejected+proposed == count && proposed > 0:
+		return "proposed"
+	case accepted+rejected == count && accepted > 0:
+		return "accepted"
+	case accepted+rejected == count:
+		return "rejected"
+	case accepted > 0 || rejected > 0 || proposed > 0:
+		return "partial"
+	default:
+		return "pending"
+	}
+}
+
+func suggestionIDParam(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+func suggestionOpen(status string) bool {
+	return status == "pending" || status == "partial"
+}
+
+func canReviewSuggestion(db *sql.DB, u *auth.User, slug string) bool {
+	if u == nil {
+		return false
+	}
+	if u.Role == "Admin" || u.Role == "Owner" {
+		return true
+	}
+	var owner sql.NullString
+	db.QueryRow(`SELECT owner FROM documents WHERE slug = ?`, slug).Scan(&owner)
+	return owner.Valid && strings.EqualFold(owner.String, u.Username)
+}
+
+func (rec suggestionRecord) detail(db *sql.DB) suggestionDetailResponse {
+	if current, ok := currentDocumentContent(db, rec.Slug); ok {
+		rec.Stale = contentHash(current) != rec.BaseHash
+	}
+	return suggestionDetailResponse{suggestionRow: rec.suggestionRow, Hunks: suggestionHunks(rec.base, rec.content, rec.states)}
+}
+
+func publishSuggestionEvent(r *http.Request, rec suggestionRecord, action string) {
+	events.Publish(events.DocumentSuggestion, rec.Slug, actorName(r), map[string]any{
+		"suggestion_id": rec.ID,
+		"doc_id":        rec.DocID,
+		"author":        rec.Author,
+		"action":        action,
+	})
+}
+
+// suggestDocumentHandler stores a proposed version of a document as a change
+// set against its current content without writing the file. Suggestions
+// cover the body; the front matter stays as it is.
+func suggestDocumentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		current, ok := currentDocumentContent(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpx.WriteError(w, http.StatusBadRequest, "READ_DOCUMENT_FAILED", err.Error())
+			return
+		}
+		front, _ := documentBody(current)
+		body = []byte(front + stripFrontMatter(string(body)))
+		if len(suggestionHunks(string(current), string(body), nil)) == 0 {
+			docErr(w, http.StatusBadRequest, "suggestion has no changes")
+			return
+		}
+		u := auth.UserFromContext(r)
+		now := time.Now().UTC().Format(time.RFC3339)
+		res, err := db.Exec(`INSERT INTO document_suggestions(doc_id,slug,author_id,author,note,status,base_hash,base,content,hunk_states,created_at,updated_at)
+			VALUES(?,?,?,?,?,'pending',?,?,?,'[]',?,?)`,
+			docID, slug, u.ID, u.Username, strings.TrimSpace(r.URL.Query().Get("note")), contentHash(current), string(current), string(body), now, now)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		id, _ := res.LastInsertId()
+		db.Exec(`INSERT INTO audit(user_id,action,target) VALUES(?,?,?)`, u.ID, "suggest_edit", slug)
+		rec, err := loadSuggestion(db, id)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		publishSuggestionEvent(r, rec, "created")
+		httpx.WriteJSON(w, http.StatusCreated, rec.detail(db))
+	}
+}
+
+func querySuggestions(db *sql.DB, where string, args ...any) ([]suggestionRow, error) {
+	rows, err := db.Query(`SELECT `+suggestionColumns+` FROM document_suggestions s LEFT JOIN documents d ON d.doc_id = s.doc_id WHERE `+where+` ORDER BY s.created_at DESC, s.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []suggestionRow{}
+	for rows.Next() {
+		rec, err := scanSuggestion(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec.suggestionRow)
+	}
+	return out, rows.Err()
+}
+
+func suggestionStatusFilter(r *http.Request) (string, []any) {
+	switch status := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("status"))); status {
+	case "", "open":
+		return `s.status IN ('pending','partial')`, nil
+	case "all":
+		return `1 = 1`, nil
+	default:
+		return `s.status = ?`, []any{status}
+	}
+}
+
+// listDocumentSuggestionsHandler lists the suggestions on a page. Callers
+// who cannot review them only see their own.
+func listDocumentSuggestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := cleanSlugParam(chi.URLParam(r, "*"))
+		docID, ok := documentIDForSlug(db, slug)
+		if !ok {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		where, args := suggestionStatusFilter(r)
+		if !canReviewSuggestion(db, u, slug) {
+			where += ` AND s.author_id = ?`
+			args = append(args, u.ID)
+		}
+		out, err := querySuggestions(db, `s.doc_id = ? AND `+where, append([]any{docID}, args...)...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+// listSuggestionsHandler lists the suggestions the caller made or can review.
+func listSuggestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		where, args := suggestionStatusFilter(r)
+		if u.Role != "Admin" && u.Role != "Owner" {
+			where += ` AND (s.author_id = ? OR lower(d.owner) = lower(?))`
+			args = append(args, u.ID, u.Username)
+		}
+		out, err := querySuggestions(db, where, args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func suggestionDetailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := suggestionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		rec, err := loadSuggestion(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if u := auth.UserFromContext(r); rec.authorID != u.ID && !canReviewSuggestion(db, u, rec.Slug) {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "only the author, the page owner or an admin can view a suggestion")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, rec.detail(db))
+	}
+}
+
+// reviewSuggestionHandler accepts or rejects hunks of a suggestion; no hunk
+// ids means every pending hunk. Accepted hunks are saved through the normal
+// save path, merged onto the current document if it changed since.
+func reviewSuggestionHandler(db *sql.DB, accept bool) http.HandlerFunc {
+	type reviewRequest struct {
+		Hunks []int `json:"hunks"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		id, ok := suggestionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req reviewRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				docErr(w, http.StatusBadRequest, "invalid request")
+				return
+			}
+		}
+		rec, err := loadSuggestion(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !suggestionOpen(rec.Status) {
+			docErr(w, http.StatusConflict, "suggestion is "+rec.Status)
+			return
+		}
+		if !canReviewSuggestion(db, u, rec.Slug) {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "only the page owner or an admin can review suggestions")
+			return
+		}
+		hunks := suggestionHunks(rec.base, rec.content, rec.states)
+		selected := make(map[int]bool)
+		for _, h := range req.Hunks {
+			if h < 0 || h >= len(hunks) {
+				docErr(w, http.StatusBadRequest, fmt.Sprintf("unknown hunk %d", h))
+				return
+			}
+			if hunks[h].State != hunkPending {
+				docErr(w, http.StatusConflict, fmt.Sprintf("hunk %d is already %s", h, hunks[h].State))
+				return
+			}
+			selected[h] = true
+		}
+		if len(req.Hunks) == 0 {
+			for _, h := range hunks {
+				if h.State == hunkPending {
+					selected[h.ID] = true
+				}
+			}
+		}
+
+		acceptedState := hunkAccepted
+		if accept && len(selected) > 0 {
+			current, ok := currentDocumentContent(db, rec.Slug)
+			if !ok {
+				docErr(w, http.StatusNotFound, "document not found")
+				return
+			}
+			proposed := applyHunks(rec.base, rec.content, selected)
+			if contentHash(current) != rec.BaseHash {
+				result := mergeThreeWay(rec.base, proposed, string(current))
+				if len(result.Conflicts) > 0 {
+					httpx.WriteJSON(w, http.StatusConflict, mergeConflictResponse{
+						Error: map[string]string{
+							"code":    "MERGE_CONFLICT",
+							"message": "the document changed since this suggestion was made",
+						},
+						BaseHash:    rec.BaseHash,
+						CurrentHash: contentHash(current),
+						mergeResult: result,
+					})
+					return
+				}
+				proposed = result.Merged
+			}
+			note := fmt.Sprintf("%s accepted a suggestion by %s", u.Username, rec.Author)
+			res, err := saveDocument(r.Context(), db, u, rec.Slug, []byte(proposed), saveOptions{Note: note})
+			if err != nil {
+				writeSaveError(w, err)
+				return
+			}
+			if res.Proposal != nil {
+				acceptedState = hunkProposed
+			}
+		}
+
+		states := make([]string, len(hunks))
+		for i, h := range hunks {
+			states[i] = h.State
+			if selected[i] {
+				states[i] = hunkRejected
+				if accept {
+					states[i] = acceptedState
+				}
+			}
+		}
+		rec.states = states
+		rec.Status = suggestionStatus(states, len(hunks))
+		rec.Reviewer = u.Username
+		rec.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		encoded, _ := json.Marshal(states)
+		if _, err := db.Exec(`UPDATE document_suggestions SET hunk_states = ?, status = ?, reviewer = ?, updated_at = ? WHERE id = ?`,
+			string(encoded), rec.Status, rec.Reviewer, rec.UpdatedAt, id); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		action, eventAction := "reject_suggestion", "rejected"
+		if accept {
+			action, eventAction = "accept_suggestion", acceptedState
+		}
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, action, rec.Slug, fmt.Sprintf("suggestion %d", id))
+		publishSuggestionEvent(r, rec, eventAction)
+		httpx.WriteJSON(w, http.StatusOK, rec.detail(db))
+	}
+}
+
+func withdrawSuggestionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		id, ok := suggestionIDParam(r)
+		if !ok {
+			docErr(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		rec, err := loadSuggestion(db, id)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		if rec.authorID != u.ID {
+			httpx.WriteError(w, http.StatusForbidden, "FORBIDDEN", "only the author can withdraw a suggestion")
+			return
+		}
+		if !suggestionOpen(rec.Status) {
+			docErr(w, http.StatusConflict, "suggestion is "+rec.Status)
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := db.Exec(`UPDATE document_suggestions SET status = 'withdrawn', updated_at = ? WHERE id = ?`, now, id); err != nil {
+			docErr(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		publishSuggestionEvent(r, rec, "withdrawn")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
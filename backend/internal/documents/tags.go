@@ -0,0 +1,226 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type tagCountRow struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func storeDocumentTags(db sqlExecer, docID string, tags []string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM document_tags WHERE doc_id = ?`, docID); err != nil {
+		log.Printf("clear tags %s: %v", docID, err)
+		return
+	}
+	for _, tag := range tags {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO document_tags(doc_id,tag) VALUES(?,?)`, docID, tag); err != nil {
+			log.Printf("insert tag %s: %v", docID, err)
+		}
+	}
+}
+
+func cleanTagParam(raw string) string {
+	tags := normalizeTags([]string{raw})
+	if len(tags) == 0 {
+		return ""
+	}
+	return tags[0]
+}
+
+func listTagsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		statuses := parseStatusParam(r.URL.Query().Get("status"))
+		if len(statuses) == 0 {
+			statuses = []string{"published", "unlisted"}
+		}
+		args := make([]any, 0, len(statuses))
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+		rows, err := db.Query(fmt.Sprintf(`SELECT t.tag, COUNT(DISTINCT t.doc_id) FROM document_tags t JOIN documents d ON d.doc_id = t.doc_id
+			WHERE d.status IN (%s) GROUP BY t.tag ORDER BY t.tag`, placeholders(len(statuses))), args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []tagCountRow{}
+		for rows.Next() {
+			var row tagCountRow
+			if err := rows.Scan(&row.Tag, &row.Count); err != nil {
+				docErr(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			out = append(out, row)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func tagDocumentsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureContentIndexFresh(db)
+		tag := cleanTagParam(chi.URLParam(r, "*"))
+		if tag == "" {
+			docErr(w, http.StatusBadRequest, "missing tag")
+			return
+		}
+		statuses := parseStatusParam(r.URL.Query().Get("status"))
+		if len(statuses) == 0 {
+			statuses = []string{"published", "unlisted"}
+		}
+		query, args := buildDocumentQuery(statuses, "", "", tag)
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []documentListRow{}
+		for rows.Next() {
+			row, err := scanDocumentListRow(rows)
+			if err != nil {
+				docErr(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			out = append(out, row)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func renameTagHandler(db *sql.DB) http.HandlerFunc {
+	type renameRequest struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	type renameResponse struct {
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+		Updated []string `json:"updated"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req renameRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		from := cleanTagParam(req.From)
+		to := cleanTagParam(req.To)
+		if from == "" || to == "" {
+			docErr(w, http.StatusBadRequest, "missing tag")
+			return
+		}
+		if from == to {
+			docErr(w, http.StatusBadRequest, "tags are identical")
+			return
+		}
+
+		rows, err := db.Query(`SELECT d.doc_id,d.slug,d.path FROM document_tags t JOIN documents d ON d.doc_id = t.doc_id WHERE t.tag = ? ORDER BY d.slug`, from)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		type taggedDoc struct{ docID, slug, path string }
+		var docs []taggedDoc
+		for rows.Next() {
+			var doc taggedDoc
+			if err := rows.Scan(&doc.docID, &doc.slug, &doc.path); err != nil {
+				rows.Close()
+				docErr(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			docs = append(docs, doc)
+		}
+		rows.Close()
+
+		user := auth.UserFromContext(r)
+		actor := "system"
+		if user != nil && strings.TrimSpace(user.Username) != "" {
+			actor = user.Username
+		}
+		note := fmt.Sprintf("%s renamed tag %s → %s", actor, from, to)
+		now := time.Now().UTC().Format(time.RFC3339)
+		resp := renameResponse{From: from, To: to, Updated: []string{}}
+		for _, doc := range docs {
+			raw, err := os.ReadFile(doc.path)
+			if err != nil {
+				continue
+			}
+			updated, changed := withRenamedTag(string(raw), from, to)
+			if !changed {
+				continue
+			}
+			recordHistory(db, doc.slug, note, raw)
+			if err := os.WriteFile(doc.path, []byte(updated), 0o644); err != nil {
+				log.Printf("tag rename write %s: %v", doc.slug, err)
+				continue
+			}
+			meta, _ := parseDocumentMetadata(updated)
+			storeDocumentMetadata(db, doc.docID, meta)
+			linkHealth.update(doc.path, doc.docID, doc.slug, updated)
+			db.Exec(`UPDATE documents SET updated_at = ? WHERE doc_id = ?`, now, doc.docID)
+			db.Exec(`UPDATE documents_fts SET body = ? WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, expandEmbeds(db, doc.docID, updated), doc.docID)
+			resp.Updated = append(resp.Updated, doc.slug)
+		}
+		if user != nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, user.ID, "rename_tag", from, to)
+		}
+		httpx.WriteJSON(w, http.StatusOK, resp)
+	}
+}
+
+func withRenamedTag(content, from, to string) (string, bool) {
+	trimmed := strings.TrimPrefix(content, "\ufeff")
+	root, err := decodeFrontMatter(frontMatterRE.FindString(trimmed))
+	if err != nil {
+		return content, false
+	}
+	idx := mappingKeyIndex(root, "tags")
+	if idx < 0 {
+		return content, false
+	}
+	var next []string
+	found := false
+	for _, tag := range yamlStringList(root.Content[idx+1]) {
+		if cleanTagParam(tag) == from {
+			tag = to
+			found = true
+		}
+		if cleanTagParam(tag) == to && containsTag(next, to) {
+			continue
+		}
+		next = append(next, strings.TrimSpace(tag))
+	}
+	if !found {
+		return content, false
+	}
+	return setFrontMatterValue(content, "tags", next)
+}
+
+func containsTag(list []string, tag string) bool {
+	for _, item := range list {
+		if cleanTagParam(item) == tag {
+			return true
+		}
+	}
+	return false
+}
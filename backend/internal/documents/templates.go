@@ -0,0 +1,397 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/contentpath"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][\w.-]*)\s*\}\}`)
+
+type templateInfo struct {
+	Key         string   `json:"key"`
+	Name        string   `json:"name"`
+	Folder      string   `json:"folder"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Tags        []string `json:"tags"`
+}
+
+type templateDetailResponse struct {
+	templateInfo
+	Content string `json:"content"`
+}
+
+func templateKey(folder, name string) string {
+	if folder == "" {
+		return name
+	}
+	return folder + "/" + name
+}
+
+func templatePath(key string) (string, error) {
+	root := contentpath.TemplatesRoot
+	if root == "" {
+		return "", fmt.Errorf("templates root not configured")
+	}
+	cleaned := cleanSlugParam(key)
+	if cleaned == "" || strings.Contains(cleaned, "..") {
+		return "", fmt.Errorf("invalid template")
+	}
+	return absoluteDraftPath(filepath.Join(root, filepath.FromSlash(cleaned)+".md"), root)
+}
+
+func folderChain(folder string) []string {
+	chain := []string{""}
+	folder = cleanSlugParam(folder)
+	if folder == "" {
+		return chain
+	}
+	parts := strings.Split(folder, "/")
+	for i := range parts {
+		chain = append(chain, strings.Join(parts[:i+1], "/"))
+	}
+	return chain
+}
+
+func readTemplate(key string) (templateInfo, string, error) {
+	path, err := templatePath(key)
+	if err != nil {
+		return templateInfo{}, "", err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return templateInfo{}, "", err
+	}
+	content := string(raw)
+	meta, _ := parseDocumentMetadata(content)
+	folder := parentSlug(cleanSlugParam(key))
+	name := strings.TrimPrefix(cleanSlugParam(key), folder+"/")
+	title := extractTitle(content)
+	if title == "" || strings.Contains(title, "{{") {
+		title = humanizeSlug(name)
+	}
+	tags := meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return templateInfo{
+		Key:         templateKey(folder, name),
+		Name:        name,
+		Folder:      folder,
+		Title:       title,
+		Description: meta.Description,
+		Status:      meta.Status,
+		Tags:        tags,
+	}, content, nil
+}
+
+// listTemplates returns the templates available in folder. Templates in a
+// folder override same-named templates from its ancestors.
+func listTemplates(folder string) []templateInfo {
+	byName := make(map[string]templateInfo)
+	for _, dir := range folderChain(folder) {
+		entries, err := os.ReadDir(filepath.Join(contentpath.TemplatesRoot, filepath.FromSlash(dir)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".md") {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			if info, _, err := readTemplate(templateKey(dir, name)); err == nil {
+				byName[name] = info
+			}
+		}
+	}
+	out := make([]templateInfo, 0, len(byName))
+	for _, info := range byName {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func listAllTemplates() []templateInfo {
+	out := []templateInfo{}
+	root := contentpath.TemplatesRoot
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(strings.ToLower(path), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if info, _, err := readTemplate(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))); err == nil {
+			out = append(out, info)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// resolveTemplate finds a template by key. Bare names are looked up from the
+// target folder upwards so the nearest section default wins.
+func resolveTemplate(key, folder string) (templateInfo, string, error) {
+	key = cleanSlugParam(key)
+	if strings.Contains(key, "/") {
+		return readTemplate(key)
+	}
+	chain := folderChain(folder)
+	for i := len(chain) - 1; i >= 0; i-- {
+		info, content, err := readTemplate(templateKey(chain[i], key))
+		if err == nil {
+			return info, content, nil
+		}
+	}
+	return templateInfo{}, "", os.ErrNotExist
+}
+
+func workspaceLocation(db *sql.DB) *time.Location {
+	var tz sql.NullString
+	if err := db.QueryRow(`SELECT value FROM meta WHERE key = 'timezone'`).Scan(&tz); err == nil && strings.TrimSpace(tz.String) != "" {
+		if loc, err := time.LoadLocation(strings.TrimSpace(tz.String)); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+func applyTemplateVars(content string, vars map[string]string) string {
+	return templateVarPattern.ReplaceAllStringFunc(content, func(match string) string {
+		name := templateVarPattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// instantiateTemplate fills in template variables and drops the front matter
+// keys that belong to the template itself rather than the new document.
+func instantiateTemplate(content string, vars map[string]string) string {
+	content = applyTemplateVars(content, vars)
+	for _, key := range []string{"id", "aliases", "owner"} {
+		if updated, changed := removeFrontMatterField(content, key); changed {
+			content = updated
+		}
+	}
+	return content
+}
+
+func listTemplatesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if all := strings.ToLower(q.Get("all")); all == "1" || all == "true" {
+			httpx.WriteJSON(w, http.StatusOK, listAllTemplates())
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, listTemplates(q.Get("folder")))
+	}
+}
+
+func templateDetailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := cleanSlugParam(chi.URLParam(r, "*"))
+		if key == "" {
+			docErr(w, http.StatusBadRequest, "missing template")
+			return
+		}
+		info, content, err := resolveTemplate(key, r.URL.Query().Get("folder"))
+		if err != nil {
+			docErr(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, templateDetailResponse{templateInfo: info, Content: content})
+	}
+}
+
+func templateSaveHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := cleanSlugParam(chi.URLParam(r, "*"))
+		path, err := templatePath(key)
+		if err != nil {
+			docErr(w, http.StatusBadRequest, "invalid template")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpx.WriteError(w, http.StatusBadRequest, "READ_TEMPLATE_FAILED", err.Error())
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			docErr(w, http.StatusInternalServerError, "write failed")
+			return
+		}
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			docErr(w, http.StatusInternalServerError, "write failed")
+			return
+		}
+		if u := auth.UserFromContext(r); u != nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "save_template", key, "")
+		}
+		info, _, err := readTemplate(key)
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "read failed")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, info)
+	}
+}
+
+func templateDeleteHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := cleanSlugParam(chi.URLParam(r, "*"))
+		path, err := templatePath(key)
+		if err != nil {
+			docErr(w, http.StatusBadRequest, "invalid template")
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				docErr(w, http.StatusNotFound, "not found")
+				return
+			}
+			docErr(w, http.StatusInternalServerError, "delete failed")
+			return
+		}
+		if u := auth.UserFromContext(r); u != nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "delete_template", key, "")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func createFromTemplateHandler(db *sql.DB) http.HandlerFunc {
+	type createRequest struct {
+		Template  string            `json:"template"`
+		Slug      string            `json:"slug"`
+		Parent    string            `json:"parent"`
+		Title     string            `json:"title"`
+		Draft     bool              `json:"draft"`
+		Variables map[string]string `json:"variables"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		if u == nil {
+			httpx.WriteErrorMessage(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			docErr(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		if strings.TrimSpace(req.Template) == "" {
+			docErr(w, http.StatusBadRequest, "missing template")
+			return
+		}
+		title := strings.TrimSpace(req.Title)
+		slug := cleanSlugParam(req.Slug)
+		if slug == "" {
+			if title == "" {
+				docErr(w, http.StatusBadRequest, "missing title")
+				return
+			}
+			slug = slugify(title)
+			if parent := cleanSlugParam(req.Parent); parent != "" {
+				slug = parent + "/" + slug
+			}
+		} else {
+			slug = slugify(slug)
+		}
+		if isReservedSlug(slug) {
+			docErr(w, http.StatusBadRequest, "reserved slug")
+			return
+		}
+		if title == "" {
+			title = humanizeSlug(slug)
+		}
+		parent := parentSlug(slug)
+
+		info, content, err := resolveTemplate(req.Template, parent)
+		if err != nil {
+			docErr(w, http.StatusNotFound, "template not found")
+			return
+		}
+
+		var exists int
+		if req.Draft {
+			err = db.QueryRow(`SELECT COUNT(1) FROM user_drafts WHERE user_id = ? AND slug = ?`, u.ID, slug).Scan(&exists)
+		} else {
+			err = db.QueryRow(`SELECT COUNT(1) FROM documents WHERE slug = ?`, slug).Scan(&exists)
+		}
+		if err != nil {
+			docErr(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		if exists > 0 {
+			docErr(w, http.StatusConflict, "slug exists")
+			return
+		}
+
+		now := time.Now().In(workspaceLocation(db))
+		vars := make(map[string]string, len(req.Variables)+6)
+		for name, value := range req.Variables {
+			vars[name] = value
+		}
+		vars["title"] = title
+		vars["date"] = now.Format("2006-01-02")
+		vars["time"] = now.Format("15:04")
+		vars["user"] = u.Username
+		vars["parent"] = parent
+		vars["slug"] = slug
+		content = instantiateTemplate(content, vars)
+
+		if req.Draft {
+			path, isFolder, err := draftPathFromSlug(u.Username, slug, false)
+			if err != nil {
+				docErr(w, http.StatusBadRequest, "invalid slug")
+				return
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				docErr(w, http.StatusInternalServerError, "write failed")
+				return
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				docErr(w, http.StatusInternalServerError, "write failed")
+				return
+			}
+			if err := indexDraft(db, u, slug, path, isFolder, []byte(content)); err != nil {
+				docErr(w, http.StatusInternalServerError, "db update failed")
+				return
+			}
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "create_from_template", slug, info.Key)
+			httpx.WriteJSON(w, http.StatusOK, map[string]string{"slug": slug})
+			return
+		}
+		res, err := saveDocument(r.Context(), db, u, slug, []byte(content), saveOptions{})
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		if res.Proposal == nil {
+			db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "create_from_template", slug, info.Key)
+		}
+		writeSaveResult(w, res)
+	}
+}
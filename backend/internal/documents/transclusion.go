@@ -0,0 +1,157 @@
+package documents
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const maxEmbedDepth = 5
+
+var embedPattern = regexp.MustCompile(`!\[\[([^\]]+)\]\]`)
+
+type embedSource struct {
+	docID string
+	slug  string
+	body  string
+}
+
+type embedResolver struct {
+	db    *sql.DB
+	cache map[string]*embedSource
+}
+
+func expandEmbeds(db *sql.DB, docID, text string) string {
+	if !strings.Contains(text, "![[") {
+		return text
+	}
+	resolver := &embedResolver{db: db, cache: make(map[string]*embedSource)}
+	return resolver.expand(text, []string{docID}, 0)
+}
+
+func (r *embedResolver) expand(text string, stack []string, depth int) string {
+	return embedPattern.ReplaceAllStringFunc(text, func(match string) string {
+		inner := match[3 : len(match)-2]
+		token, ok := parseWikiTarget(inner)
+		if !ok {
+			return match
+		}
+		label := strings.TrimSpace(strings.SplitN(inner, "|", 2)[0])
+		source := r.lookup(token)
+		if source == nil {
+			return fmt.Sprintf("> Embed not found: %s", label)
+		}
+		if containsString(stack, source.docID) {
+			return fmt.Sprintf("> Embed skipped, cycle detected: %s", label)
+		}
+		if depth >= maxEmbedDepth {
+			return fmt.Sprintf("> Embed skipped, depth limit reached: %s", label)
+		}
+		body := source.body
+		if token.Anchor != "" {
+			section, ok := extractSection(body, token.Anchor)
+			if !ok {
+				return fmt.Sprintf("> Embed section not found: %s", label)
+			}
+			body = section
+		}
+		next := append(append([]string{}, stack...), source.docID)
+		return strings.TrimRight(r.expand(body, next, depth+1), "\r\n")
+	})
+}
+
+func (r *embedResolver) lookup(token docLinkToken) *embedSource {
+	key := "doc:" + token.ID
+	if token.ID == "" {
+		key = token.Slug
+	}
+	if source, ok := r.cache[key]; ok {
+		return source
+	}
+	var docID sql.NullString
+	var slug, path string
+	var err error
+	if token.ID != "" {
+		err = r.db.QueryRow(`SELECT doc_id,slug,path FROM documents WHERE doc_id = ?`, token.ID).Scan(&docID, &slug, &path)
+	} else {
+		target := token.Slug
+		if resolved, _, ok := resolveSlugAlias(r.db, target); ok {
+			target = resolved
+		}
+		err = r.db.QueryRow(`SELECT doc_id,slug,path FROM documents WHERE slug = ?`, target).Scan(&docID, &slug, &path)
+	}
+	var source *embedSource
+	if err == nil {
+		if content, readErr := os.ReadFile(path); readErr == nil {
+			id := docID.String
+			if id == "" {
+				id = slug
+			}
+			source = &embedSource{docID: id, slug: slug, body: stripFrontMatter(string(content))}
+		}
+	}
+	r.cache[key] = source
+	return source
+}
+
+func extractSection(body, anchor string) (string, bool) {
+	headings := extractHeadings(body)
+	lines := strings.Split(body, "\n")
+	for i, heading := range headings {
+		if heading.Anchor != anchor {
+			continue
+		}
+		end := len(lines)
+		for _, next := range headings[i+1:] {
+			if next.Level <= heading.Level {
+				end = next.Line - 1
+				break
+			}
+		}
+		return strings.Join(lines[heading.Line-1:end], "\n"), true
+	}
+	return "", false
+}
+
+func reindexEmbedders(db *sql.DB, docID string) {
+	if strings.TrimSpace(docID) == "" {
+		return
+	}
+	seen := map[string]struct{}{docID: {}}
+	queue := []string{docID}
+	for depth := 0; len(queue) > 0 && depth < maxEmbedDepth; depth++ {
+		var next []string
+		for _, target := range queue {
+			rows, err := db.Query(`SELECT DISTINCT d.doc_id,d.path FROM document_links l JOIN documents d ON d.doc_id = l.source_id WHERE l.kind = 'embed' AND l.target_id = ?`, target)
+			if err != nil {
+				log.Printf("load embedders %s: %v", target, err)
+				continue
+			}
+			type embedder struct{ docID, path string }
+			var found []embedder
+			for rows.Next() {
+				var e embedder
+				if rows.Scan(&e.docID, &e.path) == nil {
+					found = append(found, e)
+				}
+			}
+			rows.Close()
+			for _, e := range found {
+				if _, ok := seen[e.docID]; ok {
+					continue
+				}
+				seen[e.docID] = struct{}{}
+				content, err := os.ReadFile(e.path)
+				if err != nil {
+					continue
+				}
+				db.Exec(`UPDATE documents_fts SET body = ? WHERE rowid = (SELECT id FROM documents WHERE doc_id = ?)`, expandEmbeds(db, e.docID, string(content)), e.docID)
+				next = append(next, e.docID)
+			}
+		}
+		queue = next
+	}
+}
@@ -0,0 +1,199 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"atlas/internal/random"
+)
+
+const subscriberBuffer = 64
+
+const (
+	DocumentSaved      = "document.saved"
+	DocumentMoved      = "document.moved"
+	DocumentStatus     = "document.status"
+	DocumentDeleted    = "document.deleted"
+	DocumentLocked     = "document.locked"
+	DocumentUnlocked   = "document.unlocked"
+	DocumentComment    = "document.comment"
+	DocumentSuggestion = "document.suggestion"
+	ReviewRequested    = "review.requested"
+	TreeChanged        = "tree.changed"
+	BackupFinished     = "backup.finished"
+	UserCreated        = "user.created"
+	PresenceChanged    = "presence"
+	Notification       = "notification"
+)
+
+// DocumentSavedData is the Data of DocumentSaved events.
+type DocumentSavedData struct {
+	DocID        string `json:"doc_id"`
+	Revision     string `json:"revision"`
+	Created      bool   `json:"created"`
+	RenamedFrom  string `json:"renamed_from,omitempty"`
+	RestoredFrom string `json:"restored_from,omitempty"`
+}
+
+// DocumentMovedData is the Data of DocumentMoved events.
+type DocumentMovedData struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DocumentStatusData is the Data of DocumentStatus events.
+type DocumentStatusData struct {
+	Status string `json:"status"`
+}
+
+// BackupFinishedData is the Data of BackupFinished events. File is the name
+// accepted by the backup download endpoint.
+type BackupFinishedData struct {
+	ID   string `json:"id"`
+	File string `json:"file"`
+}
+
+// Event is a change notification pushed to connected clients.
+type Event struct {
+	Type  string `json:"type"`
+	Slug  string `json:"slug,omitempty"`
+	Actor string `json:"actor,omitempty"`
+	Data  any    `json:"data,omitempty"`
+	At    string `json:"at"`
+}
+
+type subscriber struct {
+	id       string
+	userID   int
+	username string
+	ch       chan Event
+}
+
+type hub struct {
+	mu       sync.Mutex
+	subs     map[string]*subscriber
+	presence map[string]presenceEntry
+}
+
+var defaultHub = &hub{
+	subs:     make(map[string]*subscriber),
+	presence: make(map[string]presenceEntry),
+}
+
+var (
+	listenersMu sync.RWMutex
+	listeners   []func(Event)
+)
+
+// Listen registers fn to be called with every event passed to Publish.
+// Listeners run on the publishing goroutine and must not block.
+func Listen(fn func(Event)) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Publish sends an event to every connected client. Clients that fall behind
+// are disconnected and resync when they reconnect.
+func Publish(eventType, slug, actor string, data any) {
+	e := Event{
+		Type:  eventType,
+		Slug:  slug,
+		Actor: actor,
+		Data:  data,
+		At:    time.Now().UTC().Format(time.RFC3339),
+	}
+	defaultHub.publish(e)
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, fn := range listeners {
+		fn(e)
+	}
+}
+
+// PublishUser sends an event only to the clients of one user. Listeners are
+// not called.
+func PublishUser(userID int, eventType, slug, actor string, data any) {
+	e := Event{
+		Type:  eventType,
+		Slug:  slug,
+		Actor: actor,
+		Data:  data,
+		At:    time.Now().UTC().Format(time.RFC3339),
+	}
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	for id, sub := range defaultHub.subs {
+		if sub.userID != userID {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			defaultHub.removeLocked(id)
+		}
+	}
+}
+
+func (h *hub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(e)
+}
+
+func (h *hub) publishLocked(e Event) {
+	for id, sub := range h.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			h.removeLocked(id)
+		}
+	}
+}
+
+func (h *hub) subscribe(userID int, username string) *subscriber {
+	sub := &subscriber{
+		id:       random.GenerateToken(8),
+		userID:   userID,
+		username: username,
+		ch:       make(chan Event, subscriberBuffer),
+	}
+	h.mu.Lock()
+	h.subs[sub.id] = sub
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[sub.id] == sub {
+		h.removeLocked(sub.id)
+	}
+}
+
+// removeLocked closes a subscriber and drops the presence tied to it.
+func (h *hub) removeLocked(id string) {
+	sub, ok := h.subs[id]
+	if !ok {
+		return
+	}
+	delete(h.subs, id)
+	close(sub.ch)
+	if entry, ok := h.presence[id]; ok {
+		delete(h.presence, id)
+		h.publishPresenceLocked(entry.slug)
+	}
+}
+
+// Shutdown disconnects every client so open streams do not hold up a server
+// shutdown.
+func Shutdown() {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	for id := range defaultHub.subs {
+		sub := defaultHub.subs[id]
+		delete(defaultHub.subs, id)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const keepAliveInterval = 25 * time.Second
+
+// RegisterRoutes registers the event stream. It is long-lived and must not be
+// mounted behind the API request timeout.
+func RegisterRoutes(r chi.Router, db *sql.DB) {
+	r.With(auth.AuthMiddleware(db)).Get("/api/events", streamHandler())
+	r.With(auth.AuthMiddleware(db)).Post("/api/events/presence", presenceHandler())
+}
+
+func writeEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+func streamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			httpx.WriteError(w, http.StatusInternalServerError, "STREAM_UNSUPPORTED", "streaming unsupported")
+			return
+		}
+		sub := defaultHub.subscribe(u.ID, u.Username)
+		defer defaultHub.unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		hello := Event{Type: "hello", Data: map[string]string{"client_id": sub.id}, At: time.Now().UTC().Format(time.RFC3339)}
+		if writeEvent(w, hello) != nil || rc.Flush() != nil {
+			return
+		}
+
+		ticker := time.NewTicker(keepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-sub.ch:
+				if !ok {
+					return
+				}
+				if writeEvent(w, e) != nil {
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// presenceHandler sets what the client behind an event stream is looking at.
+// The entry is dropped when the stream disconnects.
+func presenceHandler() http.HandlerFunc {
+	type presenceRequest struct {
+		ClientID string `json:"client_id"`
+		Slug     string `json:"slug"`
+		State    string `json:"state"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		var req presenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		slug := strings.Trim(strings.TrimSpace(req.Slug), "/")
+		state := strings.ToLower(strings.TrimSpace(req.State))
+		if slug != "" && !validState(state) {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid state")
+			return
+		}
+		defaultHub.mu.Lock()
+		sub, ok := defaultHub.subs[req.ClientID]
+		defaultHub.mu.Unlock()
+		if !ok || sub.userID != u.ID {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "unknown client")
+			return
+		}
+		defaultHub.setPresence(sub.id, u.ID, u.Username, slug, state, 0)
+		httpx.WriteJSON(w, http.StatusOK, presenceSnapshot{Slug: slug, Users: Presence(slug)})
+	}
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	StateViewing = "viewing"
+	StateEditing = "editing"
+)
+
+type presenceEntry struct {
+	userID    int
+	username  string
+	slug      string
+	state     string
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+// PresenceUser is one user present on a document.
+type PresenceUser struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	State     string `json:"state"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type presenceSnapshot struct {
+	Slug  string         `json:"slug"`
+	Users []PresenceUser `json:"users"`
+}
+
+func validState(state string) bool {
+	return state == StateViewing || state == StateEditing
+}
+
+// SetPresence records that a user is viewing or editing slug under key. An
+// empty slug clears the entry. A positive ttl makes the entry expire; entries
+// tied to an event stream live until it disconnects.
+func SetPresence(key string, userID int, username, slug, state string, ttl time.Duration) {
+	defaultHub.setPresence(key, userID, username, slug, state, ttl)
+}
+
+// Presence lists the users present on slug. A user with several entries is
+// listed once, as editing when any entry is.
+func Presence(slug string) []PresenceUser {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	return defaultHub.presenceLocked(slug)
+}
+
+func (h *hub) setPresence(key string, userID int, username, slug, state string, ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	previous, had := h.presence[key]
+	if slug == "" || !validState(state) {
+		if had {
+			delete(h.presence, key)
+			h.publishPresenceLocked(previous.slug)
+		}
+		return
+	}
+	entry := presenceEntry{userID: userID, username: username, slug: slug, state: state, updatedAt: now}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	h.presence[key] = entry
+	changed := !had || previous.slug != slug || previous.state != state
+	if had && previous.slug != slug {
+		h.publishPresenceLocked(previous.slug)
+	}
+	if changed {
+		h.publishPresenceLocked(slug)
+	}
+}
+
+func (h *hub) presenceLocked(slug string) []PresenceUser {
+	now := time.Now()
+	byUser := make(map[int]PresenceUser)
+	for key, entry := range h.presence {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(h.presence, key)
+			continue
+		}
+		if entry.slug != slug {
+			continue
+		}
+		user, seen := byUser[entry.userID]
+		if seen && user.State == StateEditing && entry.state != StateEditing {
+			continue
+		}
+		updated := entry.updatedAt.UTC().Format(time.RFC3339)
+		if seen && user.State == entry.state && user.UpdatedAt > updated {
+			continue
+		}
+		byUser[entry.userID] = PresenceUser{UserID: entry.userID, Username: entry.username, State: entry.state, UpdatedAt: updated}
+	}
+	out := make([]PresenceUser, 0, len(byUser))
+	for _, user := range byUser {
+		out = append(out, user)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Username) < strings.ToLower(out[j].Username) })
+	return out
+}
+
+func (h *hub) publishPresenceLocked(slug string) {
+	h.publishLocked(Event{
+		Type: PresenceChanged,
+		Slug: slug,
+		Data: presenceSnapshot{Slug: slug, Users: h.presenceLocked(slug)},
+		At:   time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,161 @@
+package mail
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"atlas/internal/auth"
+	"atlas/internal/httpx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type settingsResponse struct {
+	Settings
+	PasswordSet bool `json:"password_set"`
+}
+
+type queueEntry struct {
+	ID            int64  `json:"id"`
+	To            string `json:"to"`
+	Subject       string `json:"subject"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error,omitempty"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	SentAt        string `json:"sent_at,omitempty"`
+}
+
+func RegisterRoutes(r chi.Router, db *sql.DB) {
+	admin := r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner"))
+	admin.Get("/mail/settings", getSettingsHandler(db))
+	admin.Put("/mail/settings", putSettingsHandler(db))
+	admin.Post("/mail/test", testMailHandler(db))
+	admin.Get("/mail/queue", listQueueHandler(db))
+}
+
+func settingsView(s Settings) settingsResponse {
+	out := settingsResponse{Settings: s, PasswordSet: s.Password != ""}
+	out.Password = ""
+	return out
+}
+
+func getSettingsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httpx.WriteJSON(w, http.StatusOK, settingsView(LoadSettings(db)))
+	}
+}
+
+// putSettingsHandler replaces the SMTP settings. An omitted password keeps
+// the stored one; clear_password removes it.
+func putSettingsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Settings
+			ClearPassword bool `json:"clear_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		s := req.Settings
+		s.Host = strings.TrimSpace(s.Host)
+		s.From = strings.TrimSpace(s.From)
+		s.BaseURL = strings.TrimSpace(s.BaseURL)
+		s.Security = strings.ToLower(strings.TrimSpace(s.Security))
+		if s.Security == "" {
+			s.Security = SecurityStartTLS
+		}
+		if s.Port == 0 {
+			s.Port = map[string]int{SecurityNone: 25, SecurityStartTLS: 587, SecurityTLS: 465}[s.Security]
+		}
+		if s.Password == "" && !req.ClearPassword {
+			s.Password = LoadSettings(db).Password
+		}
+		if err := s.validate(); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := saveSettings(db, s); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "save failed")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, settingsView(s))
+	}
+}
+
+// testMailHandler sends a message right away, bypassing the queue, so SMTP
+// errors are reported to the caller.
+func testMailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			To string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		req.To = strings.TrimSpace(req.To)
+		if !ValidAddress(req.To) {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid address")
+			return
+		}
+		settings := LoadSettings(db)
+		if !settings.Configured() {
+			httpx.WriteErrorMessage(w, http.StatusConflict, "mail is not configured")
+			return
+		}
+		title := AppTitle(db)
+		text, html, err := Render(Content{
+			AppTitle: title,
+			Heading:  "Test email",
+			Intro:    "This is a test message sent by " + auth.UserFromContext(r).Username + ". Your mail settings work.",
+		})
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "render failed")
+			return
+		}
+		if err := Send(settings, Message{To: req.To, Subject: title + ": test email", Text: text, HTML: html}); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"sent": true, "to": req.To})
+	}
+}
+
+func listQueueHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		where, args := `1=1`, []any{}
+		if status := r.URL.Query().Get("status"); status != "" {
+			where, args = `status = ?`, append(args, status)
+		}
+		limit := 100
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+			limit = n
+		}
+		rows, err := db.Query(`SELECT id,to_addr,subject,status,attempts,COALESCE(last_error,''),COALESCE(next_attempt_at,''),created_at,COALESCE(sent_at,'')
+			FROM mail_queue WHERE `+where+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []queueEntry{}
+		for rows.Next() {
+			var e queueEntry
+			if err := rows.Scan(&e.ID, &e.To, &e.Subject, &e.Status, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.SentAt); err != nil {
+				httpx.WriteErrorMessage(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			if e.Status != StatusPending {
+				e.NextAttemptAt = ""
+			}
+			out = append(out, e)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
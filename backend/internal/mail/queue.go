@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+const (
+	queueInterval = 30 * time.Second
+	queueBatch    = 20
+	maxAttempts   = 8
+	firstRetry    = time.Minute
+	maxRetry      = 6 * time.Hour
+	// keepSent is how long delivered and failed messages stay in the queue.
+	keepSent = 30 * 24 * time.Hour
+)
+
+// Queue states.
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+type queuedMessage struct {
+	ID       int64
+	Attempts int
+	Message
+}
+
+var wake = make(chan struct{}, 1)
+
+// Enqueue stores msg for delivery by the queue worker.
+func Enqueue(db *sql.DB, msg Message) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.Exec(`INSERT INTO mail_queue(to_addr,subject,text_body,html_body,status,next_attempt_at,created_at) VALUES(?,?,?,?,?,?,?)`,
+		msg.To, msg.Subject, msg.Text, msg.HTML, StatusPending, now, now)
+	if err != nil {
+		return err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start delivers queued mail until ctx is cancelled. Failed deliveries are
+// retried with exponential backoff.
+func Start(ctx context.Context, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(queueInterval)
+		defer ticker.Stop()
+		for {
+			processQueue(db, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+func dueMessages(db *sql.DB, now time.Time) ([]queuedMessage, error) {
+	rows, err := db.Query(`SELECT id,attempts,to_addr,subject,text_body,COALESCE(html_body,'') FROM mail_queue
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?`, StatusPending, now.UTC().Format(time.RFC3339), queueBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []queuedMessage
+	for rows.Next() {
+		var m queuedMessage
+		if err := rows.Scan(&m.ID, &m.Attempts, &m.To, &m.Subject, &m.Text, &m.HTML); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetry)
+}
+
+func processQueue(db *sql.DB, now time.Time) {
+	cutoff := now.Add(-keepSent).UTC().Format(time.RFC3339)
+	db.Exec(`DELETE FROM mail_queue WHERE status != ? AND created_at < ?`, StatusPending, cutoff)
+
+	msgs, err := dueMessages(db, now)
+	if err != nil {
+		log.Printf("mail: queue: %v", err)
+		return
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	settings := LoadSettings(db)
+	if !settings.Configured() {
+		return
+	}
+	for _, m := range msgs {
+		attempts := m.Attempts + 1
+		stamp := time.Now().UTC().Format(time.RFC3339)
+		if err := Send(settings, m.Message); err != nil {
+			status := StatusPending
+			if attempts >= maxAttempts {
+				status = StatusFailed
+			}
+			next := time.Now().Add(retryDelay(attempts)).UTC().Format(time.RFC3339)
+			db.Exec(`UPDATE mail_queue SET attempts = ?, status = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+				attempts, status, err.Error(), next, m.ID)
+			log.Printf("mail: delivery to %s failed (attempt %d): %v", m.To, attempts, err)
+			continue
+		}
+		db.Exec(`UPDATE mail_queue SET attempts = ?, status = ?, last_error = NULL, sent_at = ? WHERE id = ?`,
+			attempts, StatusSent, stamp, m.ID)
+	}
+}
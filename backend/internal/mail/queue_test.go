@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"database/sql"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"atlas/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := storage.InitDB(db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	return db
+}
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func queueState(t *testing.T, db *sql.DB) (status string, attempts int, lastError sql.NullString) {
+	t.Helper()
+	if err := db.QueryRow(`SELECT status,attempts,last_error FROM mail_queue`).Scan(&status, &attempts, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	return status, attempts, lastError
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, maxRetry},
+		{100, maxRetry},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestProcessQueueSends(t *testing.T) {
+	db := openTestDB(t)
+	srv := newSMTPServer(t, nil)
+	if err := saveSettings(db, srv.settings(SecurityNone)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	processQueue(db, time.Now())
+
+	status, attempts, lastError := queueState(t, db)
+	if status != StatusSent || attempts != 1 || lastError.Valid {
+		t.Errorf("state = %s/%d/%v, want sent after one attempt", status, attempts, lastError)
+	}
+	if got := srv.received(); len(got) != 1 || got[0].To[0] != testMessage.To {
+		t.Errorf("sessions = %+v", got)
+	}
+}
+
+func TestProcessQueueGivesUp(t *testing.T) {
+	db := openTestDB(t)
+	settings := Settings{Host: "127.0.0.1", Port: closedPort(t), Security: SecurityNone, From: "wiki@example.com"}
+	if err := saveSettings(db, settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, testMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each run is far enough ahead to be past the retry delay.
+	later := time.Now().Add(2 * maxRetry)
+	for i := 1; i <= maxAttempts; i++ {
+		processQueue(db, later)
+		status, attempts, lastError := queueState(t, db)
+		want := StatusPending
+		if i == maxAttempts {
+			want = StatusFailed
+		}
+		if status != want || attempts != i {
+			t.Fatalf("after run %d: status %s, attempts %d; want %s, %d", i, status, attempts, want, i)
+		}
+		if !lastError.Valid || lastError.String == "" {
+			t.Fatalf("after run %d: no last_error", i)
+		}
+	}
+
+	processQueue(db, later)
+	if status, attempts, _ := queueState(t, db); status != StatusFailed || attempts != maxAttempts {
+		t.Errorf("failed message was retried: %s, %d", status, attempts)
+	}
+}
+
+func TestProcessQueueWaitsForRetry(t *testing.T) {
+	db := openTestDB(t)
+	settings := Settings{Host: "127.0.0.1", Port: closedPort(t), Security: SecurityNone, From: "wiki@example.com"}
+	if err := saveSettings(db, settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	processQueue(db, time.Now())
+	processQueue(db, time.Now())
+	if _, attempts, _ := queueState(t, db); attempts != 1 {
+		t.Errorf("attempts = %d, want 1 before the retry delay passes", attempts)
+	}
+}
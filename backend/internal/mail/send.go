@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 15 * time.Second
+
+// rootCAs verifies the certificate of the SMTP server. Nil uses the system
+// pool.
+var rootCAs *x509.CertPool
+
+// Message is one outgoing email with a plain text and an HTML part.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Send delivers msg through the configured SMTP server.
+func Send(s Settings, msg Message) error {
+	if !s.Configured() {
+		return fmt.Errorf("mail is not configured")
+	}
+	conn, err := net.DialTimeout("tcp", s.address(), dialTimeout)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: s.Host, RootCAs: rootCAs}
+	if s.Security == SecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if s.Security == SecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	from, err := envelopeAddress(s.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(buildMessage(s.From, msg)); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func envelopeAddress(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid from address")
+	}
+	return parsed.Address, nil
+}
+
+func boundary() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return "atlas-" + hex.EncodeToString(b[:])
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	sep := boundary()
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+sep+`"`)
+	buf.WriteString("\r\n")
+	part := func(contentType, body string) {
+		fmt.Fprintf(&buf, "--%s\r\n", sep)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&buf)
+		qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+		qp.Close()
+		buf.WriteString("\r\n")
+	}
+	part("text/plain", msg.Text)
+	if msg.HTML != "" {
+		part("text/html", msg.HTML)
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", sep)
+	return buf.Bytes()
+}
@@ -0,0 +1,345 @@
+package mail
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the fake server saw of one client connection.
+type smtpSession struct {
+	TLS  bool
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer is a minimal SMTP server for tests. It offers STARTTLS when
+// created with a TLS config and accepts AUTH PLAIN.
+type smtpServer struct {
+	ln  net.Listener
+	tls *tls.Config
+
+	mu       sync.Mutex
+	sessions []smtpSession
+	done     sync.WaitGroup
+}
+
+func newSMTPServer(t *testing.T, config *tls.Config) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, tls: config}
+	go s.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		s.done.Wait()
+	})
+	return s
+}
+
+func (s *smtpServer) settings(security string) Settings {
+	return Settings{
+		Host:     "127.0.0.1",
+		Port:     s.ln.Addr().(*net.TCPAddr).Port,
+		Security: security,
+		Username: "wiki",
+		Password: "secret",
+		From:     "Atlas <wiki@example.com>",
+	}
+}
+
+func (s *smtpServer) received() []smtpSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpSession{}, s.sessions...)
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.done.Add(1)
+		go func() {
+			defer s.done.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tp := textproto.NewConn(conn)
+	var sess smtpSession
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			if s.tls != nil && !sess.TLS {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			if s.tls == nil || sess.TLS {
+				tp.PrintfLine("502 not supported")
+				continue
+			}
+			tp.PrintfLine("220 ready")
+			tc := tls.Server(conn, s.tls)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn = tc
+			tp = textproto.NewConn(tc)
+			sess = smtpSession{TLS: true}
+		case "AUTH":
+			raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			sess.Auth = string(raw)
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			sess.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			sess.To = append(sess.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			sess.Data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Lock()
+			s.sessions = append(s.sessions, sess)
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// selfSignedTLS returns a server config for 127.0.0.1 and a pool that trusts
+// it.
+func selfSignedTLS(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "atlas test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func trustPool(t *testing.T, pool *x509.CertPool) {
+	prev := rootCAs
+	rootCAs = pool
+	t.Cleanup(func() { rootCAs = prev })
+}
+
+var testMessage = Message{
+	To:      "ann@example.com",
+	Subject: "Hello",
+	Text:    "plain body",
+	HTML:    "<p>html body</p>",
+}
+
+func TestSendNone(t *testing.T) {
+	srv := newSMTPServer(t, nil)
+	if err := Send(srv.settings(SecurityNone), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("sessions = %d, want 1", len(got))
+	}
+	sess := got[0]
+	if sess.TLS {
+		t.Error("session used TLS")
+	}
+	if sess.Auth != "\x00wiki\x00secret" {
+		t.Errorf("auth = %q", sess.Auth)
+	}
+	if sess.From != "wiki@example.com" {
+		t.Errorf("from = %q", sess.From)
+	}
+	if len(sess.To) != 1 || sess.To[0] != "ann@example.com" {
+		t.Errorf("to = %q", sess.To)
+	}
+	if !strings.Contains(sess.Data, "Subject: Hello\n") || !strings.Contains(sess.Data, "plain body") {
+		t.Errorf("data = %q", sess.Data)
+	}
+}
+
+func TestSendStartTLS(t *testing.T) {
+	config, pool := selfSignedTLS(t)
+	srv := newSMTPServer(t, config)
+	trustPool(t, pool)
+	if err := Send(srv.settings(SecurityStartTLS), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("sessions = %d, want 1", len(got))
+	}
+	if !got[0].TLS {
+		t.Error("session did not switch to TLS")
+	}
+	if got[0].Auth != "\x00wiki\x00secret" {
+		t.Errorf("auth = %q", got[0].Auth)
+	}
+	if !strings.Contains(got[0].Data, "html body") {
+		t.Errorf("data = %q", got[0].Data)
+	}
+}
+
+func TestSendStartTLSUntrusted(t *testing.T) {
+	config, _ := selfSignedTLS(t)
+	srv := newSMTPServer(t, config)
+	err := Send(srv.settings(SecurityStartTLS), testMessage)
+	if err == nil || !strings.HasPrefix(err.Error(), "starttls:") {
+		t.Fatalf("err = %v, want a starttls error", err)
+	}
+	if got := srv.received(); len(got) != 0 {
+		t.Errorf("sessions = %d, want 0", len(got))
+	}
+}
+
+func TestSendNotConfigured(t *testing.T) {
+	if err := Send(Settings{}, testMessage); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	msg := Message{
+		To:      "ann@example.com",
+		Subject: "Café update",
+		Text:    "Héllo\n" + long,
+		HTML:    "<p>Héllo</p>",
+	}
+	raw := buildMessage("Atlas <wiki@example.com>", msg)
+
+	_, body, _ := strings.Cut(string(raw), "\r\n\r\n")
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("line longer than 76 characters: %q", line)
+		}
+	}
+	if strings.Contains(strings.ReplaceAll(string(raw), "\r\n", ""), "\n") {
+		t.Error("message has bare newlines")
+	}
+
+	parsed, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(raw))))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	if got := parsed.Header.Get("Subject"); !strings.HasPrefix(got, "=?utf-8?q?") {
+		t.Errorf("subject is not Q-encoded: %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if got := parsed.Header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version = %q", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" || params["boundary"] == "" {
+		t.Fatalf("content type = %q (%v)", parsed.Header.Get("Content-Type"), err)
+	}
+
+	want := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", "Héllo\r\n" + long},
+		{"text/html; charset=utf-8", "<p>Héllo</p>"},
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for i, w := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType {
+			t.Errorf("part %d content type = %q, want %q", i, got, w.contentType)
+		}
+		// The reader decodes quoted-printable parts itself.
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if string(body) != w.body {
+			t.Errorf("part %d body = %q, want %q", i, body, w.body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got err %v", err)
+	}
+	if !strings.Contains(string(raw), "H=C3=A9llo") {
+		t.Error("body is not quoted-printable")
+	}
+}
+
+func TestBuildMessageTextOnly(t *testing.T) {
+	raw := string(buildMessage("wiki@example.com", Message{To: "ann@example.com", Subject: "Hi", Text: "body"}))
+	if strings.Contains(raw, "text/html") {
+		t.Error("message has an HTML part")
+	}
+	if strings.Count(raw, "Content-Type: text/plain") != 1 {
+		t.Errorf("message = %q", raw)
+	}
+}
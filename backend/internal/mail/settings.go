@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+const settingsKey = "smtp_settings"
+
+const (
+	SecurityNone     = "none"
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+)
+
+// Settings configure the SMTP server used for outgoing mail. BaseURL is the
+// public address of the wiki, used for links in messages.
+type Settings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Security string `json:"security"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+	BaseURL  string `json:"base_url"`
+}
+
+// Configured reports whether mail can be sent.
+func (s Settings) Configured() bool {
+	return s.Host != "" && s.From != ""
+}
+
+func (s Settings) address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+func (s Settings) validate() error {
+	if s.Host == "" {
+		return nil
+	}
+	if s.Port <= 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid port")
+	}
+	switch s.Security {
+	case SecurityNone, SecurityStartTLS, SecurityTLS:
+	default:
+		return fmt.Errorf("security must be none, starttls or tls")
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("invalid from address")
+	}
+	return nil
+}
+
+func LoadSettings(db *sql.DB) Settings {
+	s := Settings{Port: 587, Security: SecurityStartTLS}
+	var raw sql.NullString
+	if err := db.QueryRow(`SELECT value FROM meta WHERE key = ?`, settingsKey).Scan(&raw); err != nil || !raw.Valid {
+		return s
+	}
+	_ = json.Unmarshal([]byte(raw.String), &s)
+	return s
+}
+
+func saveSettings(db *sql.DB, s Settings) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR REPLACE INTO meta(key,value) VALUES(?,?)`, settingsKey, string(raw))
+	return err
+}
+
+// DocumentURL links to slug under the configured base URL.
+func (s Settings) DocumentURL(slug string) string {
+	base := strings.TrimRight(s.BaseURL, "/")
+	if base == "" {
+		return ""
+	}
+	return base + "/doc/" + slug
+}
+
+// ValidAddress reports whether addr is a single bare email address.
+func ValidAddress(addr string) bool {
+	parsed, err := mail.ParseAddress(addr)
+	return err == nil && parsed.Address == addr
+}
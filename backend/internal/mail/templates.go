@@ -0,0 +1,80 @@
+package mail
+
+import (
+	"bytes"
+	"database/sql"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Item is one line of a notification or digest email.
+type Item struct {
+	Message string
+	Slug    string
+	URL     string
+	When    string
+}
+
+// Content is the data passed to the mail templates.
+type Content struct {
+	AppTitle string
+	Heading  string
+	Intro    string
+	Items    []Item
+	Footer   string
+}
+
+const textLayout = `{{.Heading}}
+{{- if .Intro}}
+
+{{.Intro}}
+{{- end}}
+{{if .Items}}
+{{range .Items}}- {{.Message}}{{if .When}} ({{.When}}){{end}}{{if .URL}}
+  {{.URL}}{{end}}
+{{end}}{{end}}
+--
+{{.AppTitle}}{{if .Footer}}
+{{.Footer}}{{end}}
+`
+
+const htmlLayout = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #1f2328; max-width: 600px; margin: 0 auto; padding: 16px;">
+<h2 style="font-size: 18px; margin: 0 0 12px;">{{.Heading}}</h2>
+{{if .Intro}}<p>{{.Intro}}</p>{{end}}
+{{if .Items}}<ul style="padding-left: 20px;">
+{{range .Items}}<li style="margin-bottom: 6px;">{{if .URL}}<a href="{{.URL}}">{{.Message}}</a>{{else}}{{.Message}}{{end}}{{if .When}} <span style="color: #656d76;">{{.When}}</span>{{end}}</li>
+{{end}}</ul>{{end}}
+<p style="color: #656d76; font-size: 12px; border-top: 1px solid #d0d7de; padding-top: 8px;">{{.AppTitle}}{{if .Footer}}<br>{{.Footer}}{{end}}</p>
+</body>
+</html>
+`
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.New("text").Parse(textLayout))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(htmlLayout))
+)
+
+// Render builds the text and HTML bodies for c.
+func Render(c Content) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, c); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplate.Execute(&html, c); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(text.String()) + "\n", html.String(), nil
+}
+
+// AppTitle returns the configured wiki title.
+func AppTitle(db *sql.DB) string {
+	var title sql.NullString
+	db.QueryRow(`SELECT value FROM meta WHERE key = 'app_title'`).Scan(&title)
+	if strings.TrimSpace(title.String) == "" {
+		return "Atlas DB"
+	}
+	return title.String
+}
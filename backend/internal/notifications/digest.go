@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"atlas/internal/mail"
+)
+
+const (
+	digestKey      = "notifications_digest"
+	digestInterval = time.Hour
+	// digestItems caps the entries listed in one digest email.
+	digestItems = 100
+)
+
+type digestUser struct {
+	id    int
+	prefs Preferences
+}
+
+func (d *dispatcher) runDigests() {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		sendDigests(d.db, time.Now())
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func digestPeriod(mode string) time.Duration {
+	switch mode {
+	case EmailDaily:
+		return 24 * time.Hour
+	case EmailWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// resetDigest starts a user's digest period afresh, so switching modes does
+// not send notifications from before the switch.
+func resetDigest(db *sql.DB, userID int) {
+	db.Exec(`INSERT OR REPLACE INTO user_preferences(user_id,key,value,updated_at) VALUES(?,?,?,CURRENT_TIMESTAMP)`,
+		userID, digestKey, time.Now().UTC().Format(time.RFC3339))
+}
+
+func digestUsers(db *sql.DB) ([]digestUser, error) {
+	rows, err := db.Query(`SELECT user_id FROM user_preferences WHERE key = ?`, preferencesKey)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	var out []digestUser
+	for _, id := range ids {
+		prefs := loadPreferences(db, id)
+		if digestPeriod(prefs.Email) > 0 && prefs.EmailAddress != "" {
+			out = append(out, digestUser{id: id, prefs: prefs})
+		}
+	}
+	return out, nil
+}
+
+// sendDigests queues a digest for every user whose daily or weekly period has
+// elapsed.
+func sendDigests(db *sql.DB, now time.Time) {
+	settings := mail.LoadSettings(db)
+	if !settings.Configured() {
+		return
+	}
+	users, err := digestUsers(db)
+	if err != nil {
+		log.Printf("notifications: digest: %v", err)
+		return
+	}
+	for _, u := range users {
+		var raw string
+		if err := db.QueryRow(`SELECT value FROM user_preferences WHERE user_id = ? AND key = ?`, u.id, digestKey).Scan(&raw); err != nil {
+			resetDigest(db, u.id)
+			continue
+		}
+		last, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			resetDigest(db, u.id)
+			continue
+		}
+		if now.Sub(last) < digestPeriod(u.prefs.Email) {
+			continue
+		}
+		if err := sendDigest(db, settings, u, raw); err != nil {
+			log.Printf("notifications: digest for user %d: %v", u.id, err)
+			continue
+		}
+		resetDigest(db, u.id)
+	}
+}
+
+func sendDigest(db *sql.DB, settings mail.Settings, u digestUser, since string) error {
+	rows, err := db.Query(`SELECT kind,COALESCE(slug,''),message,created_at FROM notifications
+		WHERE user_id = ? AND created_at > ? ORDER BY id DESC LIMIT ?`, u.id, since, digestItems+1)
+	if err != nil {
+		return err
+	}
+	var items []mail.Item
+	for rows.Next() {
+		var kind string
+		var item mail.Item
+		if err := rows.Scan(&kind, &item.Slug, &item.Message, &item.When); err != nil {
+			rows.Close()
+			return err
+		}
+		if kind != KindDeleted {
+			item.URL = settings.DocumentURL(item.Slug)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if len(items) == 0 {
+		return nil
+	}
+	footer := ""
+	if len(items) > digestItems {
+		items = items[:digestItems]
+		footer = "Older changes are listed in your notification inbox."
+	}
+	period := "daily"
+	if u.prefs.Email == EmailWeekly {
+		period = "weekly"
+	}
+	title := mail.AppTitle(db)
+	text, html, err := mail.Render(mail.Content{
+		AppTitle: title,
+		Heading:  fmt.Sprintf("Your %s digest", period),
+		Intro:    fmt.Sprintf("%d updates to pages you watch, mentions and review requests.", len(items)),
+		Items:    items,
+		Footer:   footer,
+	})
+	if err != nil {
+		return err
+	}
+	return mail.Enqueue(db, mail.Message{
+		To:      u.prefs.EmailAddress,
+		Subject: fmt.Sprintf("%s: your %s digest", title, period),
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+func emailNotification(db *sql.DB, to string, n Notification) {
+	settings := mail.LoadSettings(db)
+	if !settings.Configured() {
+		return
+	}
+	content := mail.Content{AppTitle: mail.AppTitle(db), Heading: n.Message}
+	if n.Kind != KindDeleted {
+		content.Items = []mail.Item{{Message: "Open " + n.Slug, Slug: n.Slug, URL: settings.DocumentURL(n.Slug)}}
+	}
+	text, html, err := mail.Render(content)
+	if err != nil {
+		log.Printf("notifications: email: %v", err)
+		return
+	}
+	if err := mail.Enqueue(db, mail.Message{To: to, Subject: content.AppTitle + ": " + n.Message, Text: text, HTML: html}); err != nil {
+		log.Printf("notifications: email: %v", err)
+	}
+}
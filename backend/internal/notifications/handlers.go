@@ -0,0 +1,265 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/httpx"
+	"atlas/internal/mail"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type watch struct {
+	DocID     string `json:"doc_id"`
+	Slug      string `json:"slug"`
+	Subtree   bool   `json:"subtree"`
+	CreatedAt string `json:"created_at"`
+}
+
+type notificationPage struct {
+	Items      []Notification `json:"items"`
+	Unread     int            `json:"unread"`
+	NextBefore int64          `json:"next_before,omitempty"`
+}
+
+func RegisterRoutes(r chi.Router, db *sql.DB) {
+	r.With(auth.AuthMiddleware(db)).Get("/watches", listWatchesHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/watch/*", watchStateHandler(db))
+	r.With(auth.AuthMiddleware(db)).Put("/watch/*", watchHandler(db))
+	r.With(auth.AuthMiddleware(db)).Delete("/watch/*", unwatchHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/notifications", listNotificationsHandler(db))
+	r.With(auth.AuthMiddleware(db)).Post("/notifications/read", markReadHandler(db))
+	r.With(auth.AuthMiddleware(db)).Get("/notifications/preferences", getPreferencesHandler(db))
+	r.With(auth.AuthMiddleware(db)).Put("/notifications/preferences", putPreferencesHandler(db))
+}
+
+func slugParam(r *http.Request) string {
+	return strings.Trim(strings.TrimSpace(chi.URLParam(r, "*")), "/")
+}
+
+func docIDForSlug(db *sql.DB, slug string) (string, bool) {
+	var docID sql.NullString
+	if err := db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, slug).Scan(&docID); err != nil || strings.TrimSpace(docID.String) == "" {
+		return "", false
+	}
+	return docID.String, true
+}
+
+func listWatchesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		rows, err := db.Query(`SELECT w.doc_id, d.slug, w.subtree, COALESCE(w.created_at,'') FROM document_watches w
+			JOIN documents d ON d.doc_id = w.doc_id WHERE w.user_id = ? ORDER BY d.slug`, u.ID)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		out := []watch{}
+		for rows.Next() {
+			var item watch
+			if err := rows.Scan(&item.DocID, &item.Slug, &item.Subtree, &item.CreatedAt); err != nil {
+				httpx.WriteErrorMessage(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			out = append(out, item)
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func watchStateHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := slugParam(r)
+		docID, ok := docIDForSlug(db, slug)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		item := watch{DocID: docID, Slug: slug}
+		err := db.QueryRow(`SELECT subtree, COALESCE(created_at,'') FROM document_watches WHERE user_id = ? AND doc_id = ?`, u.ID, docID).
+			Scan(&item.Subtree, &item.CreatedAt)
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"watching": err == nil, "watch": item})
+	}
+}
+
+// watchHandler subscribes the caller to a document, or with subtree set to a
+// folder and everything below it.
+func watchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		slug := slugParam(r)
+		docID, ok := docIDForSlug(db, slug)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		var req struct {
+			Subtree bool `json:"subtree"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+				return
+			}
+		}
+		item := watch{DocID: docID, Slug: slug, Subtree: req.Subtree, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+		if _, err := db.Exec(`INSERT INTO document_watches(user_id,doc_id,subtree,created_at) VALUES(?,?,?,?)
+			ON CONFLICT(user_id,doc_id) DO UPDATE SET subtree = excluded.subtree`, u.ID, docID, item.Subtree, item.CreatedAt); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, item)
+	}
+}
+
+func unwatchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		docID, ok := docIDForSlug(db, slugParam(r))
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		db.Exec(`DELETE FROM document_watches WHERE user_id = ? AND doc_id = ?`, u.ID, docID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listNotificationsHandler pages through the caller's inbox, newest first.
+// Pass next_before from a page as ?before= to get the following one.
+func listNotificationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		q := r.URL.Query()
+		limit := defaultPageSize
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = min(n, maxPageSize)
+		}
+		where, args := `user_id = ?`, []any{u.ID}
+		if raw := q.Get("before"); raw != "" {
+			before, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			where, args = where+` AND id < ?`, append(args, before)
+		}
+		if unread := strings.ToLower(q.Get("unread")); unread == "1" || unread == "true" {
+			where += ` AND read_at IS NULL`
+		}
+		rows, err := db.Query(`SELECT id,kind,COALESCE(slug,''),COALESCE(doc_id,''),COALESCE(actor,''),message,read_at IS NOT NULL,created_at
+			FROM notifications WHERE `+where+` ORDER BY id DESC LIMIT ?`, append(args, limit+1)...)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		page := notificationPage{Items: []Notification{}}
+		for rows.Next() {
+			var n Notification
+			if err := rows.Scan(&n.ID, &n.Kind, &n.Slug, &n.DocID, &n.Actor, &n.Message, &n.Read, &n.CreatedAt); err != nil {
+				rows.Close()
+				httpx.WriteErrorMessage(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			page.Items = append(page.Items, n)
+		}
+		rows.Close()
+		if len(page.Items) > limit {
+			page.Items = page.Items[:limit]
+			page.NextBefore = page.Items[limit-1].ID
+		}
+		db.QueryRow(`SELECT COUNT(1) FROM notifications WHERE user_id = ? AND read_at IS NULL`, u.ID).Scan(&page.Unread)
+		httpx.WriteJSON(w, http.StatusOK, page)
+	}
+}
+
+func markReadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		var req struct {
+			IDs []int64 `json:"ids"`
+			All bool    `json:"all"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		if req.All {
+			db.Exec(`UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`, now, u.ID)
+		}
+		for _, id := range req.IDs {
+			db.Exec(`UPDATE notifications SET read_at = ? WHERE id = ? AND user_id = ? AND read_at IS NULL`, now, id, u.ID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func getPreferencesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httpx.WriteJSON(w, http.StatusOK, loadPreferences(db, auth.UserFromContext(r).ID))
+	}
+}
+
+func putPreferencesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFromContext(r)
+		var req Preferences
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		prefs := loadPreferences(db, u.ID)
+		previousEmail := prefs.Email
+		for kind, enabled := range req.Kinds {
+			if _, known := prefs.Kinds[kind]; !known {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "unknown notification kind "+kind)
+				return
+			}
+			prefs.Kinds[kind] = enabled
+		}
+		prefs.IncludeOwn = req.IncludeOwn
+		if req.Email != "" {
+			if !validEmailMode(req.Email) {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "email must be off, immediate, daily or weekly")
+				return
+			}
+			prefs.Email = req.Email
+		}
+		prefs.EmailAddress = strings.TrimSpace(req.EmailAddress)
+		if prefs.EmailAddress != "" && !mail.ValidAddress(prefs.EmailAddress) {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid email address")
+			return
+		}
+		if prefs.Email != EmailOff && prefs.EmailAddress == "" {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "missing email address")
+			return
+		}
+		if err := savePreferences(db, u.ID, prefs); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "save failed")
+			return
+		}
+		if prefs.Email != previousEmail {
+			resetDigest(db, u.ID)
+		}
+		httpx.WriteJSON(w, http.StatusOK, prefs)
+	}
+}
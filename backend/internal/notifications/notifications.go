@@ -0,0 +1,318 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"atlas/internal/events"
+)
+
+const (
+	queueSize = 1024
+	// keepPerUser caps the notifications stored for one user.
+	keepPerUser = 500
+	// keepRead is how long read notifications are kept.
+	keepRead = 30 * 24 * time.Hour
+	// coalesceWindow is how long an unread notification absorbs repeats of
+	// the same change by the same actor, such as live editing saves.
+	coalesceWindow = 10 * time.Minute
+)
+
+// Kinds a user can receive. Restores and mentions are derived from save and
+// comment events; review requests go to the approvers of a folder.
+const (
+	KindSaved    = "document.saved"
+	KindRestored = "document.restored"
+	KindMoved    = "document.moved"
+	KindStatus   = "document.status"
+	KindDeleted  = "document.deleted"
+	KindComment  = "document.comment"
+	KindMention  = "mention"
+	KindReview   = "review.requested"
+)
+
+var allKinds = []string{KindSaved, KindRestored, KindMoved, KindStatus, KindDeleted, KindComment, KindMention, KindReview}
+
+// Notification is one entry in a user's inbox.
+type Notification struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Slug      string `json:"slug"`
+	DocID     string `json:"doc_id,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	Message   string `json:"message"`
+	Read      bool   `json:"read"`
+	CreatedAt string `json:"created_at"`
+	// Replaces is the id of the unread notification this one supersedes.
+	Replaces int64 `json:"replaces,omitempty"`
+}
+
+type eventData struct {
+	DocID        string   `json:"doc_id"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Status       string   `json:"status"`
+	Action       string   `json:"action"`
+	Mentions     []string `json:"mentions"`
+	RestoredFrom string   `json:"restored_from"`
+	Approvers    []string `json:"approvers"`
+}
+
+type dispatcher struct {
+	mu     sync.Mutex
+	db     *sql.DB
+	queue  chan events.Event
+	closed bool
+	done   chan struct{}
+	stop   chan struct{}
+}
+
+var defaultDispatcher = &dispatcher{}
+
+// Start fans document events out to watchers in the background and sends
+// email digests.
+func Start(db *sql.DB) {
+	d := defaultDispatcher
+	d.mu.Lock()
+	d.db = db
+	d.queue = make(chan events.Event, queueSize)
+	d.done = make(chan struct{})
+	d.stop = make(chan struct{})
+	d.mu.Unlock()
+	events.Listen(d.enqueue)
+	go d.run()
+	go d.runDigests()
+}
+
+// Stop delivers the queued events and stops the dispatcher. Events published
+// afterwards are dropped.
+func Stop() {
+	d := defaultDispatcher
+	d.mu.Lock()
+	if d.queue == nil || d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.stop)
+	close(d.queue)
+	d.mu.Unlock()
+	<-d.done
+}
+
+func (d *dispatcher) enqueue(e events.Event) {
+	switch e.Type {
+	case events.DocumentSaved, events.DocumentMoved, events.DocumentStatus, events.DocumentDeleted, events.DocumentComment, events.ReviewRequested:
+	default:
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.queue == nil || d.closed {
+		return
+	}
+	select {
+	case d.queue <- e:
+	default:
+		log.Printf("notifications: queue full, dropping %s for %s", e.Type, e.Slug)
+	}
+}
+
+func (d *dispatcher) run() {
+	defer close(d.done)
+	for e := range d.queue {
+		d.fanOut(e)
+	}
+}
+
+func decodeEventData(data any) eventData {
+	var out eventData
+	raw, err := json.Marshal(data)
+	if err == nil {
+		_ = json.Unmarshal(raw, &out)
+	}
+	return out
+}
+
+func eventKind(e events.Event, data eventData) string {
+	switch {
+	case e.Type == events.DocumentSaved && data.RestoredFrom != "":
+		return KindRestored
+	case e.Type == events.DocumentComment:
+		switch data.Action {
+		case "created", "replied", "resolved":
+			return KindComment
+		}
+		return ""
+	default:
+		return e.Type
+	}
+}
+
+func eventMessage(kind, actor, slug string, data eventData) string {
+	if actor == "" {
+		actor = "Someone"
+	}
+	switch kind {
+	case KindSaved:
+		return fmt.Sprintf("%s edited %s", actor, slug)
+	case KindRestored:
+		return fmt.Sprintf("%s restored an earlier version of %s", actor, slug)
+	case KindMoved:
+		return fmt.Sprintf("%s moved %s to %s", actor, data.From, data.To)
+	case KindStatus:
+		if actor == "Someone" {
+			return fmt.Sprintf("%s is now %s", slug, data.Status)
+		}
+		return fmt.Sprintf("%s set %s to %s", actor, slug, data.Status)
+	case KindDeleted:
+		return fmt.Sprintf("%s deleted %s", actor, slug)
+	case KindComment:
+		if data.Action == "resolved" {
+			return fmt.Sprintf("%s resolved a comment thread on %s", actor, slug)
+		}
+		return fmt.Sprintf("%s commented on %s", actor, slug)
+	case KindMention:
+		return fmt.Sprintf("%s mentioned you on %s", actor, slug)
+	case KindReview:
+		return fmt.Sprintf("%s requested your review of a change to %s", actor, slug)
+	}
+	return slug
+}
+
+// watchers returns the users watching docID or a folder containing any of
+// slugs.
+func watchers(db *sql.DB, docID string, slugs ...string) map[int]bool {
+	out := make(map[int]bool)
+	collect := func(query string, args ...any) {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			log.Printf("notifications: watchers: %v", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if rows.Scan(&id) == nil {
+				out[id] = true
+			}
+		}
+	}
+	if docID != "" {
+		collect(`SELECT user_id FROM document_watches WHERE doc_id = ?`, docID)
+	}
+	for _, slug := range slugs {
+		if slug == "" {
+			continue
+		}
+		collect(`SELECT w.user_id FROM document_watches w JOIN documents d ON d.doc_id = w.doc_id
+			WHERE w.subtree = 1 AND (d.slug = ? OR substr(?, 1, length(d.slug) + 1) = d.slug || '/')`, slug, slug)
+	}
+	return out
+}
+
+func userIDByName(db *sql.DB, username string) (int, bool) {
+	var id int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+func (d *dispatcher) fanOut(e events.Event) {
+	db := d.db
+	data := decodeEventData(e.Data)
+	kind := eventKind(e, data)
+	if data.DocID == "" && e.Slug != "" {
+		db.QueryRow(`SELECT doc_id FROM documents WHERE slug = ?`, e.Slug).Scan(&data.DocID)
+	}
+	actorID, hasActor := 0, false
+	if e.Actor != "" {
+		actorID, hasActor = userIDByName(db, e.Actor)
+	}
+
+	recipients := make(map[int]string)
+	if e.Type == events.ReviewRequested {
+		for _, name := range data.Approvers {
+			if id, ok := userIDByName(db, name); ok {
+				recipients[id] = KindReview
+			}
+		}
+	} else if kind != "" {
+		for id := range watchers(db, data.DocID, e.Slug, data.From) {
+			recipients[id] = kind
+		}
+	}
+	if e.Type == events.DocumentComment {
+		for _, name := range data.Mentions {
+			if id, ok := userIDByName(db, name); ok {
+				recipients[id] = KindMention
+			}
+		}
+	}
+	for userID, kind := range recipients {
+		prefs := loadPreferences(db, userID)
+		if hasActor && userID == actorID && !prefs.IncludeOwn {
+			continue
+		}
+		if !prefs.wants(kind) {
+			continue
+		}
+		d.store(userID, kind, e, data, prefs)
+	}
+	if e.Type == events.DocumentDeleted && data.DocID != "" {
+		db.Exec(`DELETE FROM document_watches WHERE doc_id = ?`, data.DocID)
+	}
+}
+
+func (d *dispatcher) store(userID int, kind string, e events.Event, data eventData, prefs Preferences) {
+	db := d.db
+	n := Notification{
+		Kind:      kind,
+		Slug:      e.Slug,
+		DocID:     data.DocID,
+		Actor:     e.Actor,
+		Message:   eventMessage(kind, e.Actor, e.Slug, data),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if coalesces(kind) {
+		cutoff := time.Now().Add(-coalesceWindow).UTC().Format(time.RFC3339)
+		db.QueryRow(`SELECT id FROM notifications WHERE user_id = ? AND kind = ? AND doc_id = ? AND actor = ? AND read_at IS NULL AND created_at >= ?
+			ORDER BY id DESC LIMIT 1`, userID, n.Kind, n.DocID, n.Actor, cutoff).Scan(&n.Replaces)
+	}
+	if n.Replaces != 0 {
+		db.Exec(`DELETE FROM notifications WHERE id = ?`, n.Replaces)
+	}
+	raw, _ := json.Marshal(e.Data)
+	res, err := db.Exec(`INSERT INTO notifications(user_id,kind,slug,doc_id,actor,message,data,created_at) VALUES(?,?,?,?,?,?,?,?)`,
+		userID, n.Kind, n.Slug, n.DocID, n.Actor, n.Message, string(raw), n.CreatedAt)
+	if err != nil {
+		log.Printf("notifications: store: %v", err)
+		return
+	}
+	n.ID, _ = res.LastInsertId()
+	prune(db, userID)
+	events.PublishUser(userID, events.Notification, n.Slug, n.Actor, n)
+	if prefs.Email == EmailImmediate && prefs.EmailAddress != "" && n.Replaces == 0 {
+		emailNotification(db, prefs.EmailAddress, n)
+	}
+}
+
+// coalesces reports whether repeats of kind collapse into one notification.
+// Mentions and review requests each carry something to act on.
+func coalesces(kind string) bool {
+	return kind != KindMention && kind != KindReview
+}
+
+// prune keeps the newest keepPerUser notifications of a user and drops read
+// ones older than keepRead.
+func prune(db *sql.DB, userID int) {
+	cutoff := time.Now().Add(-keepRead).UTC().Format(time.RFC3339)
+	db.Exec(`DELETE FROM notifications WHERE user_id = ? AND (
+		id NOT IN (SELECT id FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?)
+		OR (read_at IS NOT NULL AND created_at < ?))`, userID, userID, keepPerUser, cutoff)
+}
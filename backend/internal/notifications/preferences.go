@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+const preferencesKey = "notifications"
+
+// Email delivery modes.
+const (
+	EmailOff       = "off"
+	EmailImmediate = "immediate"
+	EmailDaily     = "daily"
+	EmailWeekly    = "weekly"
+)
+
+// Preferences choose which kinds of notifications a user receives and how
+// they are emailed. Kinds missing from the map are enabled.
+type Preferences struct {
+	Kinds        map[string]bool `json:"kinds"`
+	IncludeOwn   bool            `json:"include_own"`
+	Email        string          `json:"email"`
+	EmailAddress string          `json:"email_address"`
+}
+
+func validEmailMode(mode string) bool {
+	switch mode {
+	case EmailOff, EmailImmediate, EmailDaily, EmailWeekly:
+		return true
+	}
+	return false
+}
+
+func defaultPreferences() Preferences {
+	prefs := Preferences{Kinds: make(map[string]bool, len(allKinds)), Email: EmailOff}
+	for _, kind := range allKinds {
+		prefs.Kinds[kind] = true
+	}
+	return prefs
+}
+
+func (p Preferences) wants(kind string) bool {
+	enabled, ok := p.Kinds[kind]
+	return !ok || enabled
+}
+
+func loadPreferences(db *sql.DB, userID int) Preferences {
+	prefs := defaultPreferences()
+	var raw sql.NullString
+	if err := db.QueryRow(`SELECT value FROM user_preferences WHERE user_id = ? AND key = ?`, userID, preferencesKey).Scan(&raw); err != nil || !raw.Valid {
+		return prefs
+	}
+	var stored Preferences
+	if json.Unmarshal([]byte(raw.String), &stored) != nil {
+		return prefs
+	}
+	for kind, enabled := range stored.Kinds {
+		if _, known := prefs.Kinds[kind]; known {
+			prefs.Kinds[kind] = enabled
+		}
+	}
+	prefs.IncludeOwn = stored.IncludeOwn
+	if validEmailMode(stored.Email) {
+		prefs.Email = stored.Email
+	}
+	prefs.EmailAddress = stored.EmailAddress
+	return prefs
+}
+
+func savePreferences(db *sql.DB, userID int, prefs Preferences) error {
+	raw, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR REPLACE INTO user_preferences(user_id,key,value,updated_at) VALUES(?,?,?,CURRENT_TIMESTAMP)`, userID, preferencesKey, string(raw))
+	return err
+}
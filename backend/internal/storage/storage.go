@@ -32,7 +32,13 @@ func InitDB(db *sql.DB) error {
             is_start_page INTEGER NOT NULL DEFAULT 0,
             is_pinned INTEGER NOT NULL DEFAULT 0,
             is_home INTEGER NOT NULL DEFAULT 0,
-            links TEXT
+            links TEXT,
+            description TEXT,
+            tags TEXT,
+            front_matter TEXT,
+            publish_at TEXT,
+            expire_at TEXT,
+            schedule_state TEXT
         );`,
 
 		`CREATE TABLE IF NOT EXISTS audit (
@@ -58,14 +64,6 @@ func InitDB(db *sql.DB) error {
             note TEXT
         );`,
 
-		`CREATE TABLE IF NOT EXISTS editor_presence (
-            slug TEXT NOT NULL,
-            user_id INTEGER NOT NULL,
-            username TEXT NOT NULL,
-            updated_at INTEGER NOT NULL,
-            PRIMARY KEY(slug, user_id)
-        );`,
-
 		`CREATE TABLE IF NOT EXISTS meta (
             key TEXT PRIMARY KEY,
             value TEXT
@@ -90,8 +88,223 @@ func InitDB(db *sql.DB) error {
 			PRIMARY KEY(user_id, slug)
 		);`,
 
-		`CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(slug, title, body);`,
-		`CREATE INDEX IF NOT EXISTS idx_editor_presence_slug ON editor_presence(slug);`,
+		`CREATE TABLE IF NOT EXISTS draft_shares (
+			owner_id INTEGER NOT NULL,
+			slug TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			mode TEXT NOT NULL DEFAULT 'read',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(owner_id, slug, user_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS draft_bases (
+			user_id INTEGER NOT NULL,
+			slug TEXT NOT NULL,
+			doc_id TEXT,
+			base_hash TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(user_id, slug)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_aliases (
+			alias TEXT PRIMARY KEY,
+			doc_id TEXT NOT NULL
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_links (
+			source_id TEXT NOT NULL,
+			target_id TEXT,
+			target_slug TEXT,
+			kind TEXT NOT NULL DEFAULT 'wiki',
+			anchor TEXT
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_headings (
+			doc_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			level INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			anchor TEXT NOT NULL,
+			line INTEGER NOT NULL
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_tags (
+			doc_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY(doc_id, tag)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS review_policies (
+			folder TEXT PRIMARY KEY,
+			approvers TEXT NOT NULL,
+			updated_by TEXT,
+			updated_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			slug TEXT NOT NULL,
+			target TEXT NOT NULL,
+			query TEXT,
+			content TEXT NOT NULL,
+			base_hash TEXT,
+			author_id INTEGER,
+			author TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			reviewer TEXT,
+			comment TEXT,
+			created_at DATETIME,
+			reviewed_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS revision_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			revision_id INTEGER NOT NULL,
+			actor TEXT,
+			action TEXT NOT NULL,
+			comment TEXT,
+			created_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_locks (
+			doc_id TEXT PRIMARY KEY,
+			holder_id INTEGER NOT NULL,
+			holder TEXT NOT NULL,
+			reason TEXT,
+			created_at DATETIME,
+			expires_at DATETIME NOT NULL
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS comment_threads (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			doc_id TEXT NOT NULL,
+			heading TEXT,
+			quote TEXT,
+			prefix TEXT,
+			suffix TEXT,
+			anchor_start INTEGER,
+			anchor_end INTEGER,
+			orphaned INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'open',
+			author_id INTEGER,
+			author TEXT,
+			resolved_by TEXT,
+			resolved_at DATETIME,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			thread_id INTEGER NOT NULL,
+			author_id INTEGER,
+			author TEXT,
+			body TEXT NOT NULL,
+			mentions TEXT,
+			created_at DATETIME,
+			edited_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_suggestions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			doc_id TEXT NOT NULL,
+			slug TEXT NOT NULL,
+			author_id INTEGER,
+			author TEXT,
+			note TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			reviewer TEXT,
+			base_hash TEXT NOT NULL,
+			base TEXT NOT NULL,
+			content TEXT NOT NULL,
+			hunk_states TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS document_watches (
+			user_id INTEGER NOT NULL,
+			doc_id TEXT NOT NULL,
+			subtree INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME,
+			PRIMARY KEY(user_id, doc_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			slug TEXT,
+			doc_id TEXT,
+			actor TEXT,
+			message TEXT NOT NULL,
+			data TEXT,
+			read_at DATETIME,
+			created_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS mail_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			to_addr TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			text_body TEXT NOT NULL,
+			html_body TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at DATETIME,
+			created_at DATETIME,
+			sent_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT,
+			events TEXT NOT NULL,
+			active INTEGER NOT NULL DEFAULT 1,
+			created_by TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			response_body TEXT,
+			last_error TEXT,
+			duration_ms INTEGER,
+			next_attempt_at DATETIME,
+			replay_of INTEGER,
+			created_at DATETIME,
+			delivered_at DATETIME
+		);`,
+
+		`CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(slug, title, body, headings);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_aliases_doc_id ON document_aliases(doc_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_links_source ON document_links(source_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_links_target ON document_links(target_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_links_target_slug ON document_links(target_slug);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_headings_doc ON document_headings(doc_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_tags_tag ON document_tags(tag);`,
+		`CREATE INDEX IF NOT EXISTS idx_draft_shares_user ON draft_shares(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_revisions_status ON document_revisions(status, slug);`,
+		`CREATE INDEX IF NOT EXISTS idx_revision_events_revision ON revision_events(revision_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_comment_threads_doc ON comment_threads(doc_id, status);`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_thread ON comments(thread_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_suggestions_doc ON document_suggestions(doc_id, status);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_watches_doc ON document_watches(doc_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_mail_queue_due ON mail_queue(status, next_attempt_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);`,
 	}
 
 	tx, err := db.Begin()
@@ -111,6 +324,9 @@ func InitDB(db *sql.DB) error {
 	if err := ensureDocumentSchema(db); err != nil {
 		return err
 	}
+	if err := ensureSearchSchema(db); err != nil {
+		return err
+	}
 
 	if err := documents.AlignStartPageFlag(db); err != nil {
 		log.Printf("align start page flag: %v", err)
@@ -170,8 +386,42 @@ func ensureDocumentSchema(db *sql.DB) error {
 			return err
 		}
 	}
+	for _, column := range []string{"description", "tags", "front_matter", "publish_at", "expire_at", "schedule_state"} {
+		if !found[column] {
+			if _, err := db.Exec(`ALTER TABLE documents ADD COLUMN ` + column + ` TEXT`); err != nil {
+				return err
+			}
+		}
+	}
 	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_doc_id ON documents(doc_id)`); err != nil {
 		return err
 	}
-	return nil
+	return migrateLegacyLinks(db)
+}
+
+func ensureSearchSchema(db *sql.DB) error {
+	if _, err := db.Exec(`SELECT headings FROM documents_fts LIMIT 0`); err == nil {
+		return nil
+	}
+	if _, err := db.Exec(`DROP TABLE IF EXISTS documents_fts`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE VIRTUAL TABLE documents_fts USING fts5(slug, title, body, headings)`)
+	return err
+}
+
+func migrateLegacyLinks(db *sql.DB) error {
+	var linkRows int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM document_links`).Scan(&linkRows); err != nil {
+		return err
+	}
+	if linkRows == 0 {
+		if _, err := db.Exec(`INSERT INTO document_links(source_id,target_id,kind)
+			SELECT d.doc_id, j.value, 'wiki' FROM documents d, json_each(d.links) j
+			WHERE d.doc_id IS NOT NULL AND d.links IS NOT NULL AND d.links != '' AND json_valid(d.links)`); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`UPDATE documents SET links = NULL WHERE links IS NOT NULL`)
+	return err
 }
@@ -0,0 +1,179 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	deliverInterval = 15 * time.Second
+	deliverBatch    = 20
+	maxAttempts     = 8
+	firstRetry      = 30 * time.Second
+	maxRetry        = 6 * time.Hour
+	requestTimeout  = 10 * time.Second
+	// keepDeliveries is how long finished deliveries stay in the log.
+	keepDeliveries = 30 * 24 * time.Hour
+	// responseLimit caps the response body kept for a delivery.
+	responseLimit = 2048
+)
+
+// Delivery states.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	headerEvent     = "X-Atlas-Event"
+	headerDelivery  = "X-Atlas-Delivery"
+	headerSignature = "X-Atlas-Signature-256"
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
+type dueDelivery struct {
+	id        int64
+	webhookID int64
+	event     string
+	payload   string
+	attempts  int
+	url       string
+	secret    string
+	active    bool
+}
+
+// Sign returns the signature header value for body: the hex HMAC-SHA256 of
+// the raw body keyed with the webhook secret, prefixed with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *dispatcher) deliverLoop() {
+	defer close(d.sent)
+	ticker := time.NewTicker(deliverInterval)
+	defer ticker.Stop()
+	for {
+		deliverDue(d.db, time.Now(), d.stop)
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetry)
+}
+
+func dueDeliveries(db *sql.DB, now time.Time) ([]dueDelivery, error) {
+	rows, err := db.Query(`SELECT d.id, d.webhook_id, d.event, d.payload, d.attempts, COALESCE(h.url,''), COALESCE(h.secret,''), COALESCE(h.active,0)
+		FROM webhook_deliveries d LEFT JOIN webhooks h ON h.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.id LIMIT ?`, StatusPending, now.UTC().Format(time.RFC3339), deliverBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []dueDelivery
+	for rows.Next() {
+		var item dueDelivery
+		if err := rows.Scan(&item.id, &item.webhookID, &item.event, &item.payload, &item.attempts, &item.url, &item.secret, &item.active); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func deliverDue(db *sql.DB, now time.Time, stop <-chan struct{}) {
+	cutoff := now.Add(-keepDeliveries).UTC().Format(time.RFC3339)
+	db.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`, StatusPending, cutoff)
+
+	items, err := dueDeliveries(db, now)
+	if err != nil {
+		log.Printf("webhooks: deliveries: %v", err)
+		return
+	}
+	for _, item := range items {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if !item.active {
+			db.Exec(`UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE id = ?`, StatusFailed, "webhook disabled", item.id)
+			continue
+		}
+		deliver(db, item)
+	}
+}
+
+func deliver(db *sql.DB, item dueDelivery) {
+	attempts := item.attempts + 1
+	started := time.Now()
+	code, body, err := post(item)
+	duration := time.Since(started).Milliseconds()
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	if err == nil && code >= 200 && code < 300 {
+		db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, response_body = ?, last_error = NULL,
+			duration_ms = ?, delivered_at = ? WHERE id = ?`, StatusDelivered, attempts, code, body, duration, stamp, item.id)
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("unexpected status %d", code)
+	}
+	status := StatusPending
+	if attempts >= maxAttempts {
+		status = StatusFailed
+	}
+	next := time.Now().Add(retryDelay(attempts)).UTC().Format(time.RFC3339)
+	db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?, response_body = ?, last_error = ?,
+		duration_ms = ?, next_attempt_at = ? WHERE id = ?`, status, attempts, nullStatus(code), body, err.Error(), duration, next, item.id)
+}
+
+func nullStatus(code int) any {
+	if code == 0 {
+		return nil
+	}
+	return code
+}
+
+func post(item dueDelivery) (int, string, error) {
+	payload := []byte(item.payload)
+	req, err := http.NewRequest(http.MethodPost, item.url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Atlas-Webhooks/1.0")
+	req.Header.Set(headerEvent, item.event)
+	req.Header.Set(headerDelivery, strconv.FormatInt(item.id, 10))
+	if item.secret != "" {
+		req.Header.Set(headerSignature, Sign(item.secret, payload))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, responseLimit))
+	return resp.StatusCode, string(body), nil
+}
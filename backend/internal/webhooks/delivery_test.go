@@ -0,0 +1,257 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"atlas/internal/events"
+	"atlas/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+const testSecret = "whsec_test"
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := storage.InitDB(db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	return db
+}
+
+// receivedRequest is one request seen by a receiver.
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a webhook endpoint answering every request with status.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	t.Helper()
+	rv := &receiver{status: status}
+	rv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rv.mu.Lock()
+		rv.requests = append(rv.requests, receivedRequest{header: r.Header.Clone(), body: body})
+		status := rv.status
+		rv.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(rv.Close)
+	return rv
+}
+
+func (rv *receiver) received() []receivedRequest {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]receivedRequest{}, rv.requests...)
+}
+
+func createHook(t *testing.T, db *sql.DB, url string, active bool, events ...string) int64 {
+	t.Helper()
+	encoded, _ := json.Marshal(events)
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.Exec(`INSERT INTO webhooks(name,url,secret,events,active,created_by,created_at,updated_at) VALUES(?,?,?,?,?,?,?,?)`,
+		"test", url, testSecret, string(encoded), active, "owner", now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+type deliveryState struct {
+	Status         string
+	Attempts       int
+	ResponseStatus sql.NullInt64
+	LastError      sql.NullString
+}
+
+func loadDeliveryState(t *testing.T, db *sql.DB, id int64) deliveryState {
+	t.Helper()
+	var s deliveryState
+	err := db.QueryRow(`SELECT status,attempts,response_status,last_error FROM webhook_deliveries WHERE id = ?`, id).
+		Scan(&s.Status, &s.Attempts, &s.ResponseStatus, &s.LastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var savedEvent = events.Event{
+	Type:  events.DocumentSaved,
+	Slug:  "guides/setup",
+	Actor: "ann",
+	Data:  events.DocumentSavedData{DocID: "doc-1", Revision: `"abc"`, Created: true},
+	At:    "2026-01-02T03:04:05Z",
+}
+
+func TestSign(t *testing.T) {
+	// The widely published HMAC-SHA256 example for key "key".
+	got := Sign("key", []byte("The quick brown fox jumps over the lazy dog"))
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, firstRetry},
+		{2, 2 * firstRetry},
+		{4, 8 * firstRetry},
+		{20, maxRetry},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusOK)
+	createHook(t, db, rv.URL, true, EventDocumentCreated)
+	createHook(t, db, rv.URL, true, EventDocumentDeleted)
+
+	if n := queueDeliveries(db, savedEvent); n != 1 {
+		t.Fatalf("queued %d deliveries, want 1", n)
+	}
+	deliverDue(db, time.Now(), nil)
+
+	got := rv.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d requests, want 1", len(got))
+	}
+	req := got[0]
+	if sig := req.header.Get(headerSignature); sig != Sign(testSecret, req.body) {
+		t.Errorf("signature = %s, want %s", sig, Sign(testSecret, req.body))
+	}
+	if ev := req.header.Get(headerEvent); ev != EventDocumentCreated {
+		t.Errorf("event header = %s", ev)
+	}
+	deliveryID, err := strconv.ParseInt(req.header.Get(headerDelivery), 10, 64)
+	if err != nil {
+		t.Fatalf("delivery header: %v", err)
+	}
+
+	var payload struct {
+		Payload
+		Data events.DocumentSavedData `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != EventDocumentCreated || payload.Slug != savedEvent.Slug || payload.Actor != "ann" ||
+		payload.CreatedAt != savedEvent.At || payload.Data.DocID != "doc-1" || payload.ID == "" {
+		t.Errorf("payload = %s", req.body)
+	}
+
+	state := loadDeliveryState(t, db, deliveryID)
+	if state.Status != StatusDelivered || state.Attempts != 1 || state.ResponseStatus.Int64 != http.StatusOK || state.LastError.Valid {
+		t.Errorf("delivery = %+v", state)
+	}
+}
+
+func TestDeliverUnsigned(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusNoContent)
+	id := createHook(t, db, rv.URL, true, EventDocumentUpdated)
+	db.Exec(`UPDATE webhooks SET secret = '' WHERE id = ?`, id)
+
+	queueDeliveries(db, events.Event{Type: events.DocumentSaved, Slug: "a"})
+	deliverDue(db, time.Now(), nil)
+
+	got := rv.received()
+	if len(got) != 1 {
+		t.Fatalf("received %d requests, want 1", len(got))
+	}
+	if sig := got[0].header.Get(headerSignature); sig != "" {
+		t.Errorf("unsigned webhook sent signature %s", sig)
+	}
+}
+
+func TestDeliverRetriesUntilFailed(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusServiceUnavailable)
+	createHook(t, db, rv.URL, true, EventDocumentCreated)
+	queueDeliveries(db, savedEvent)
+
+	// Each run is far enough ahead to be past the retry delay.
+	later := time.Now().Add(2 * maxRetry)
+	for i := 1; i <= maxAttempts; i++ {
+		deliverDue(db, later, nil)
+		state := loadDeliveryState(t, db, 1)
+		want := StatusPending
+		if i == maxAttempts {
+			want = StatusFailed
+		}
+		if state.Status != want || state.Attempts != i {
+			t.Fatalf("after run %d: status %s, attempts %d; want %s, %d", i, state.Status, state.Attempts, want, i)
+		}
+		if state.ResponseStatus.Int64 != http.StatusServiceUnavailable || state.LastError.String != "unexpected status 503" {
+			t.Fatalf("after run %d: %+v", i, state)
+		}
+	}
+
+	deliverDue(db, later, nil)
+	if got := len(rv.received()); got != maxAttempts {
+		t.Errorf("received %d requests, want %d", got, maxAttempts)
+	}
+}
+
+func TestDeliverWaitsForRetry(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusInternalServerError)
+	createHook(t, db, rv.URL, true, EventDocumentCreated)
+	queueDeliveries(db, savedEvent)
+
+	deliverDue(db, time.Now(), nil)
+	deliverDue(db, time.Now(), nil)
+	if got := len(rv.received()); got != 1 {
+		t.Errorf("received %d requests before the retry delay, want 1", got)
+	}
+}
+
+func TestDeliverDisabledWebhook(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusOK)
+	id := createHook(t, db, rv.URL, true, EventDocumentCreated)
+	queueDeliveries(db, savedEvent)
+	db.Exec(`UPDATE webhooks SET active = 0 WHERE id = ?`, id)
+
+	deliverDue(db, time.Now(), nil)
+	if got := len(rv.received()); got != 0 {
+		t.Errorf("received %d requests, want 0", got)
+	}
+	if state := loadDeliveryState(t, db, 1); state.Status != StatusFailed || state.LastError.String != "webhook disabled" {
+		t.Errorf("delivery = %+v", state)
+	}
+}
@@ -0,0 +1,432 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"atlas/internal/auth"
+	"atlas/internal/httpx"
+	"atlas/internal/random"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Webhook is an endpoint that receives signed event payloads. The secret is
+// only returned when it is generated on creation.
+type Webhook struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	Secret    string   `json:"secret,omitempty"`
+	SecretSet bool     `json:"secret_set"`
+	CreatedBy string   `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// Delivery is one attempt log entry. Payload and response are only included
+// in the detail view.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DurationMS     int64           `json:"duration_ms,omitempty"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+	ReplayOf       int64           `json:"replay_of,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+}
+
+type webhookRequest struct {
+	Name   *string  `json:"name"`
+	URL    *string  `json:"url"`
+	Secret *string  `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+func RegisterRoutes(r chi.Router, db *sql.DB) {
+	admin := r.With(auth.AuthMiddleware(db), auth.RequireRole("Admin", "Owner"))
+	admin.Get("/webhooks", listWebhooksHandler(db))
+	admin.Post("/webhooks", createWebhookHandler(db))
+	admin.Get("/webhooks/events", func(w http.ResponseWriter, r *http.Request) {
+		httpx.WriteJSON(w, http.StatusOK, allEvents)
+	})
+	admin.Get("/webhooks/{id}", getWebhookHandler(db))
+	admin.Put("/webhooks/{id}", updateWebhookHandler(db))
+	admin.Delete("/webhooks/{id}", deleteWebhookHandler(db))
+	admin.Get("/webhooks/{id}/deliveries", listDeliveriesHandler(db))
+	admin.Get("/webhook-deliveries/{id}", getDeliveryHandler(db))
+	admin.Post("/webhook-deliveries/{id}/replay", replayDeliveryHandler(db))
+}
+
+func idParam(r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func cleanEvents(list []string) ([]string, bool) {
+	out := []string{}
+	for _, name := range list {
+		name = strings.TrimSpace(name)
+		if !contains(allEvents, name) {
+			return nil, false
+		}
+		if !contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out, true
+}
+
+func loadWebhook(db *sql.DB, id int64) (Webhook, string, error) {
+	var h Webhook
+	var events, secret string
+	err := db.QueryRow(`SELECT id,name,url,events,active,COALESCE(secret,''),COALESCE(created_by,''),created_at,updated_at FROM webhooks WHERE id = ?`, id).
+		Scan(&h.ID, &h.Name, &h.URL, &events, &h.Active, &secret, &h.CreatedBy, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return h, "", err
+	}
+	json.Unmarshal([]byte(events), &h.Events)
+	h.SecretSet = secret != ""
+	return h, secret, nil
+}
+
+func listWebhooksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query(`SELECT id FROM webhooks ORDER BY id`)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if rows.Scan(&id) == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		out := []Webhook{}
+		for _, id := range ids {
+			if h, _, err := loadWebhook(db, id); err == nil {
+				out = append(out, h)
+			}
+		}
+		httpx.WriteJSON(w, http.StatusOK, out)
+	}
+}
+
+func getWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		h, _, err := loadWebhook(db, id)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, h)
+	}
+}
+
+// createWebhookHandler adds a webhook. Without a secret one is generated and
+// returned in the response; it cannot be read back later.
+func createWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		if req.URL == nil || !validURL(strings.TrimSpace(*req.URL)) {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid url")
+			return
+		}
+		events, ok := cleanEvents(req.Events)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "unknown event")
+			return
+		}
+		if len(events) == 0 {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "missing events")
+			return
+		}
+		hookURL := strings.TrimSpace(*req.URL)
+		name := hookURL
+		if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+			name = strings.TrimSpace(*req.Name)
+		}
+		secret, generated := "", false
+		if req.Secret != nil {
+			secret = *req.Secret
+		} else {
+			secret, generated = "whsec_"+random.GenerateToken(24), true
+		}
+		active := req.Active == nil || *req.Active
+		encoded, _ := json.Marshal(events)
+		now := time.Now().UTC().Format(time.RFC3339)
+		u := auth.UserFromContext(r)
+		res, err := db.Exec(`INSERT INTO webhooks(name,url,secret,events,active,created_by,created_at,updated_at) VALUES(?,?,?,?,?,?,?,?)`,
+			name, hookURL, secret, string(encoded), active, u.Username, now, now)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		id, _ := res.LastInsertId()
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "create_webhook", hookURL, string(encoded))
+		h, _, _ := loadWebhook(db, id)
+		if generated {
+			h.Secret = secret
+		}
+		httpx.WriteJSON(w, http.StatusCreated, h)
+	}
+}
+
+// updateWebhookHandler changes the fields present in the request. An empty
+// secret removes signing.
+func updateWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		h, secret, err := loadWebhook(db, id)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		if req.URL != nil {
+			if !validURL(strings.TrimSpace(*req.URL)) {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid url")
+				return
+			}
+			h.URL = strings.TrimSpace(*req.URL)
+		}
+		if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+			h.Name = strings.TrimSpace(*req.Name)
+		}
+		if req.Events != nil {
+			events, ok := cleanEvents(req.Events)
+			if !ok {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "unknown event")
+				return
+			}
+			if len(events) == 0 {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "missing events")
+				return
+			}
+			h.Events = events
+		}
+		if req.Secret != nil {
+			secret = *req.Secret
+		}
+		if req.Active != nil {
+			h.Active = *req.Active
+		}
+		encoded, _ := json.Marshal(h.Events)
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := db.Exec(`UPDATE webhooks SET name = ?, url = ?, secret = ?, events = ?, active = ?, updated_at = ? WHERE id = ?`,
+			h.Name, h.URL, secret, string(encoded), h.Active, now, id); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		u := auth.UserFromContext(r)
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "update_webhook", h.URL, string(encoded))
+		h.UpdatedAt = now
+		h.SecretSet = secret != ""
+		httpx.WriteJSON(w, http.StatusOK, h)
+	}
+}
+
+func deleteWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		h, _, err := loadWebhook(db, id)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+		db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+		u := auth.UserFromContext(r)
+		db.Exec(`INSERT INTO audit(user_id,action,target,meta) VALUES(?,?,?,?)`, u.ID, "delete_webhook", h.URL, "")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+const deliveryColumns = `id,webhook_id,event,status,attempts,COALESCE(response_status,0),COALESCE(last_error,''),COALESCE(duration_ms,0),
+	COALESCE(next_attempt_at,''),created_at,COALESCE(delivered_at,''),COALESCE(replay_of,0)`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDelivery(row scanner, extra ...any) (Delivery, error) {
+	var d Delivery
+	dest := append([]any{&d.ID, &d.WebhookID, &d.Event, &d.Status, &d.Attempts, &d.ResponseStatus, &d.LastError, &d.DurationMS,
+		&d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &d.ReplayOf}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return d, err
+	}
+	if d.Status != StatusPending {
+		d.NextAttemptAt = ""
+	}
+	return d, nil
+}
+
+// listDeliveriesHandler pages through a webhook's delivery log, newest
+// first. Pass next_before from a page as ?before= to get the following one.
+func listDeliveriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		q := r.URL.Query()
+		limit := defaultPageSize
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = min(n, maxPageSize)
+		}
+		where, args := `webhook_id = ?`, []any{id}
+		if raw := q.Get("before"); raw != "" {
+			before, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			where, args = where+` AND id < ?`, append(args, before)
+		}
+		if status := q.Get("status"); status != "" {
+			where, args = where+` AND status = ?`, append(args, status)
+		}
+		if event := q.Get("event"); event != "" {
+			where, args = where+` AND event = ?`, append(args, event)
+		}
+		rows, err := db.Query(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE `+where+` ORDER BY id DESC LIMIT ?`, append(args, limit+1)...)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		defer rows.Close()
+		items := []Delivery{}
+		for rows.Next() {
+			d, err := scanDelivery(rows)
+			if err != nil {
+				httpx.WriteErrorMessage(w, http.StatusInternalServerError, "scan error")
+				return
+			}
+			items = append(items, d)
+		}
+		page := map[string]any{"items": items}
+		if len(items) > limit {
+			page["items"] = items[:limit]
+			page["next_before"] = items[limit-1].ID
+		}
+		httpx.WriteJSON(w, http.StatusOK, page)
+	}
+}
+
+func getDeliveryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var payload, response string
+		d, err := scanDelivery(db.QueryRow(`SELECT `+deliveryColumns+`,payload,COALESCE(response_body,'') FROM webhook_deliveries WHERE id = ?`, id),
+			&payload, &response)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		d.Payload = json.RawMessage(payload)
+		d.ResponseBody = response
+		httpx.WriteJSON(w, http.StatusOK, d)
+	}
+}
+
+// replayDeliveryHandler queues the payload of an earlier delivery again as a
+// new delivery to the same webhook.
+func replayDeliveryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idParam(r)
+		if !ok {
+			httpx.WriteErrorMessage(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var webhookID int64
+		var event, payload string
+		if err := db.QueryRow(`SELECT webhook_id,event,payload FROM webhook_deliveries WHERE id = ?`, id).Scan(&webhookID, &event, &payload); err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "not found")
+			return
+		}
+		h, _, err := loadWebhook(db, webhookID)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		if !h.Active {
+			httpx.WriteErrorMessage(w, http.StatusConflict, "webhook disabled")
+			return
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		res, err := db.Exec(`INSERT INTO webhook_deliveries(webhook_id,event,payload,status,next_attempt_at,created_at,replay_of) VALUES(?,?,?,?,?,?,?)`,
+			webhookID, event, payload, StatusPending, now, now, id)
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "db update failed")
+			return
+		}
+		newID, _ := res.LastInsertId()
+		defaultDispatcher.poke()
+		d, err := scanDelivery(db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, newID))
+		if err != nil {
+			httpx.WriteErrorMessage(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusAccepted, d)
+	}
+}
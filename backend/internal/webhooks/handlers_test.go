@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func replay(t *testing.T, h http.HandlerFunc, id int64) *httptest.ResponseRecorder {
+	t.Helper()
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", strconv.FormatInt(id, 10))
+	req := httptest.NewRequest(http.MethodPost, "/webhook-deliveries/"+strconv.FormatInt(id, 10)+"/replay", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestReplayDelivery(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusOK)
+	createHook(t, db, rv.URL, true, EventDocumentCreated)
+	queueDeliveries(db, savedEvent)
+	deliverDue(db, time.Now(), nil)
+
+	rec := replay(t, replayDeliveryHandler(db), 1)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var d Delivery
+	if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID == 1 || d.ReplayOf != 1 || d.Status != StatusPending || d.Attempts != 0 || d.Event != EventDocumentCreated {
+		t.Errorf("replay = %+v", d)
+	}
+
+	deliverDue(db, time.Now(), nil)
+	got := rv.received()
+	if len(got) != 2 {
+		t.Fatalf("received %d requests, want 2", len(got))
+	}
+	if string(got[1].body) != string(got[0].body) {
+		t.Errorf("replayed body %s differs from %s", got[1].body, got[0].body)
+	}
+	if sig := got[1].header.Get(headerSignature); sig != Sign(testSecret, got[1].body) {
+		t.Errorf("replay signature = %s", sig)
+	}
+	if h := got[1].header.Get(headerDelivery); h != strconv.FormatInt(d.ID, 10) {
+		t.Errorf("replay delivery header = %s, want %d", h, d.ID)
+	}
+	if state := loadDeliveryState(t, db, d.ID); state.Status != StatusDelivered {
+		t.Errorf("replay delivery = %+v", state)
+	}
+}
+
+func TestReplayDeliveryRejected(t *testing.T) {
+	db := openTestDB(t)
+	rv := newReceiver(t, http.StatusOK)
+	id := createHook(t, db, rv.URL, true, EventDocumentCreated)
+	queueDeliveries(db, savedEvent)
+
+	if rec := replay(t, replayDeliveryHandler(db), 99); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown delivery: status = %d", rec.Code)
+	}
+	db.Exec(`UPDATE webhooks SET active = 0 WHERE id = ?`, id)
+	if rec := replay(t, replayDeliveryHandler(db), 1); rec.Code != http.StatusConflict {
+		t.Errorf("disabled webhook: status = %d", rec.Code)
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(1) FROM webhook_deliveries`).Scan(&n)
+	if n != 1 {
+		t.Errorf("deliveries = %d, want 1", n)
+	}
+}
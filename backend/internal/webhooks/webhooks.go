@@ -0,0 +1,210 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"atlas/internal/events"
+	"atlas/internal/random"
+)
+
+// Webhook events. They are derived from internal events, which do not map one
+// to one: a save is either a creation or an update.
+const (
+	EventDocumentCreated = "document.created"
+	EventDocumentUpdated = "document.updated"
+	EventDocumentMoved   = "document.moved"
+	EventDocumentStatus  = "document.status_changed"
+	EventDocumentDeleted = "document.deleted"
+	EventBackupCreated   = "backup.created"
+	EventUserCreated     = "user.created"
+)
+
+var allEvents = []string{
+	EventDocumentCreated, EventDocumentUpdated, EventDocumentMoved, EventDocumentStatus,
+	EventDocumentDeleted, EventBackupCreated, EventUserCreated,
+}
+
+const queueSize = 1024
+
+// Payload is the JSON body posted to webhook endpoints.
+type Payload struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	Slug      string `json:"slug,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	Data      any    `json:"data,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type dispatcher struct {
+	mu     sync.Mutex
+	db     *sql.DB
+	queue  chan events.Event
+	closed bool
+	done   chan struct{}
+	stop   chan struct{}
+	sent   chan struct{}
+	wake   chan struct{}
+}
+
+var defaultDispatcher = &dispatcher{}
+
+// Start queues a delivery for every matching webhook when events are
+// published and sends queued deliveries in the background.
+func Start(db *sql.DB) {
+	d := defaultDispatcher
+	d.mu.Lock()
+	d.db = db
+	d.queue = make(chan events.Event, queueSize)
+	d.done = make(chan struct{})
+	d.stop = make(chan struct{})
+	d.sent = make(chan struct{})
+	d.wake = make(chan struct{}, 1)
+	d.mu.Unlock()
+	events.Listen(d.enqueue)
+	go d.run()
+	go d.deliverLoop()
+}
+
+// Stop records the queued events as deliveries and stops sending. Pending
+// deliveries are sent after the next Start.
+func Stop() {
+	d := defaultDispatcher
+	d.mu.Lock()
+	if d.queue == nil || d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.stop)
+	close(d.queue)
+	d.mu.Unlock()
+	<-d.done
+	<-d.sent
+}
+
+func webhookEvent(e events.Event) string {
+	switch e.Type {
+	case events.DocumentSaved:
+		if data, ok := e.Data.(events.DocumentSavedData); ok && data.Created {
+			return EventDocumentCreated
+		}
+		return EventDocumentUpdated
+	case events.DocumentMoved:
+		return EventDocumentMoved
+	case events.DocumentStatus:
+		return EventDocumentStatus
+	case events.DocumentDeleted:
+		return EventDocumentDeleted
+	case events.BackupFinished:
+		return EventBackupCreated
+	case events.UserCreated:
+		return EventUserCreated
+	}
+	return ""
+}
+
+func (d *dispatcher) enqueue(e events.Event) {
+	if webhookEvent(e) == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.queue == nil || d.closed {
+		return
+	}
+	select {
+	case d.queue <- e:
+	default:
+		log.Printf("webhooks: queue full, dropping %s for %s", e.Type, e.Slug)
+	}
+}
+
+func (d *dispatcher) run() {
+	defer close(d.done)
+	for e := range d.queue {
+		if queueDeliveries(d.db, e) > 0 {
+			d.poke()
+		}
+	}
+}
+
+func (d *dispatcher) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+type hookFilter struct {
+	id     int64
+	events []string
+}
+
+// queueDeliveries stores one pending delivery per active webhook subscribed
+// to e and returns how many were stored.
+func queueDeliveries(db *sql.DB, e events.Event) int {
+	name := webhookEvent(e)
+	rows, err := db.Query(`SELECT id, events FROM webhooks WHERE active = 1`)
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+		return 0
+	}
+	var hooks []hookFilter
+	for rows.Next() {
+		var h hookFilter
+		var raw string
+		if rows.Scan(&h.id, &raw) == nil && json.Unmarshal([]byte(raw), &h.events) == nil {
+			hooks = append(hooks, h)
+		}
+	}
+	rows.Close()
+
+	var body []byte
+	queued := 0
+	for _, h := range hooks {
+		if !contains(h.events, name) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(Payload{
+				ID:        "evt-" + random.GenerateToken(12),
+				Event:     name,
+				Slug:      e.Slug,
+				Actor:     e.Actor,
+				Data:      e.Data,
+				CreatedAt: e.At,
+			})
+			if err != nil {
+				log.Printf("webhooks: encode %s: %v", name, err)
+				return queued
+			}
+		}
+		if err := insertDelivery(db, h.id, name, string(body)); err != nil {
+			log.Printf("webhooks: queue delivery: %v", err)
+			continue
+		}
+		queued++
+	}
+	return queued
+}
+
+func insertDelivery(db *sql.DB, webhookID int64, event, payload string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.Exec(`INSERT INTO webhook_deliveries(webhook_id,event,payload,status,next_attempt_at,created_at) VALUES(?,?,?,?,?,?)`,
+		webhookID, event, payload, StatusPending, now, now)
+	return err
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
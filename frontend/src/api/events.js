@@ -0,0 +1,86 @@
+import { apiFetch } from "./client";
+import ROUTES from "./routes";
+
+const EVENT_TYPES = [
+  "document.saved",
+  "document.moved",
+  "document.status",
+  "document.deleted",
+  "document.locked",
+  "document.unlocked",
+  "tree.changed",
+  "backup.finished",
+  "presence",
+];
+
+const listeners = new Map();
+let source = null;
+let clientId = null;
+let presence = { slug: "", state: "" };
+
+function dispatch(type, event) {
+  const handlers = listeners.get(type);
+  if (!handlers) return;
+  handlers.forEach((handler) => {
+    try {
+      handler(event);
+    } catch (e) {
+      console.warn("[events] handler", type, e);
+    }
+  });
+}
+
+function parseEvent(raw) {
+  try {
+    return JSON.parse(raw);
+  } catch {
+    return null;
+  }
+}
+
+function postPresence() {
+  if (!clientId) return Promise.resolve(null);
+  return apiFetch(ROUTES.eventsPresence, {
+    method: "POST",
+    body: { client_id: clientId, slug: presence.slug, state: presence.state },
+  }).catch(() => null);
+}
+
+export function connectEvents() {
+  if (source || typeof window === "undefined" || !window.EventSource) return;
+  source = new EventSource(ROUTES.events);
+  source.addEventListener("hello", (e) => {
+    const event = parseEvent(e.data);
+    clientId = event?.data?.client_id || null;
+    if (presence.slug) postPresence();
+  });
+  EVENT_TYPES.forEach((type) => {
+    source.addEventListener(type, (e) => {
+      const event = parseEvent(e.data);
+      if (event) dispatch(type, event);
+    });
+  });
+}
+
+export function disconnectEvents() {
+  if (source) source.close();
+  source = null;
+  clientId = null;
+  presence = { slug: "", state: "" };
+}
+
+export function subscribeEvent(type, handler) {
+  if (!listeners.has(type)) listeners.set(type, new Set());
+  listeners.get(type).add(handler);
+  return () => {
+    const handlers = listeners.get(type);
+    if (handlers) handlers.delete(handler);
+  };
+}
+
+// setPresence reports what this tab is viewing or editing. It resolves with
+// the current presence on the slug once the stream is connected.
+export function setPresence(slug, state) {
+  presence = { slug: slug || "", state: slug ? state : "" };
+  return postPresence();
+}
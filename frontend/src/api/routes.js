@@ -13,6 +13,9 @@ const R = {
   draft: (slug) => `/api/draft/${slug}`,
   document: (slug) => `/api/document/${slug}`,
   documentPresence: (slug) => `/api/document/presence/${slug}`,
+  events: "/api/events",
+  eventsPresence: "/api/events/presence",
+  documentLock: (slug) => `/api/document/lock/${slug}`,
   documentStatus: (slug) => `/api/document/status/${slug}`,
   documentMove: "/api/document/move",
   documentRestore: (slug) => `/api/documentrestore/${slug}`,
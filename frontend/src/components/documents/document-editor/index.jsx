@@ -1,5 +1,6 @@
 import React, { useCallback, useEffect, useMemo, useRef, useState } from "react";
 import ROUTES from "../../../api/routes";
+import { setPresence, subscribeEvent } from "../../../api/events";
 import { renderMarkdown } from "../../../utils/markdown";
 import { normalizeStatus } from "../../../utils/formatters";
 import { cleanSlug, slugify } from "../../../utils/slug";
@@ -40,6 +41,7 @@ export default function Editor({
   metadata = null,
   currentUser = null,
   currentDocId = null,
+  revision = null,
   parentSlug = "",
   parentOptions = [],
   onParentSlugChange,
@@ -297,21 +299,6 @@ export default function Editor({
   }, [isEdit, isDraftMetadata, slug]);
   const currentUsername = (currentUser?.username || "").trim();
 
-  const fetchPresence = useCallback(async (targetSlug) => {
-    const url = ROUTES.documentPresence(encodeURIComponent(targetSlug));
-    const res = await fetch(url, { method: "GET", cache: "no-store" });
-    if (!res.ok) {
-      throw new Error("presence fetch failed");
-    }
-    const data = await res.json().catch(() => []);
-    return Array.isArray(data) ? data : [];
-  }, []);
-
-  const updatePresence = useCallback(async (targetSlug) => {
-    const url = ROUTES.documentPresence(encodeURIComponent(targetSlug));
-    await fetch(url, { method: "POST" });
-  }, []);
-
   useEffect(() => {
     if (!presenceSlug) {
       setPresenceEditors([]);
@@ -319,27 +306,25 @@ export default function Editor({
       return;
     }
     let mounted = true;
-    const tick = async () => {
-      try {
-        await updatePresence(presenceSlug);
-      } catch (e) {}
-      try {
-        const list = await fetchPresence(presenceSlug);
-        if (!mounted) return;
-        setPresenceEditors(list);
-        setPresenceUnavailable(false);
-      } catch (e) {
-        if (!mounted) return;
-        setPresenceUnavailable(true);
-      }
+    setPresenceUnavailable(
+      typeof window === "undefined" || !window.EventSource
+    );
+    const applySnapshot = (snapshot) => {
+      if (!mounted || !snapshot || snapshot.slug !== presenceSlug) return;
+      const users = Array.isArray(snapshot.users) ? snapshot.users : [];
+      setPresenceEditors(users.filter((entry) => entry?.state === "editing"));
+      setPresenceUnavailable(false);
     };
-    tick();
-    const id = setInterval(tick, 15000);
+    const unsubscribe = subscribeEvent("presence", (event) =>
+      applySnapshot(event.data)
+    );
+    setPresence(presenceSlug, "editing").then(applySnapshot);
     return () => {
       mounted = false;
-      clearInterval(id);
+      unsubscribe();
+      setPresence(presenceSlug, "viewing");
     };
-  }, [presenceSlug, fetchPresence, updatePresence]);
+  }, [presenceSlug]);
 
   const presenceInfo = useMemo(() => {
     if (!presenceSlug) {
@@ -945,9 +930,11 @@ export default function Editor({
         url += `?${params.toString()}`;
       }
       const payload = `${frontMatter}${fullContent}`;
+      const headers = { "Content-Type": "text/markdown; charset=utf-8" };
+      if (isEdit && revision) headers["If-Match"] = revision;
       const res = await fetch(url, {
         method: "POST",
-        headers: { "Content-Type": "text/markdown; charset=utf-8" },
+        headers,
         body: payload,
       });
       if (res.ok) {
@@ -975,6 +962,20 @@ export default function Editor({
           onSaved({ slug: finalSlug, status: metaStatus, isNew: !isEdit });
         return;
       }
+      if (res.status === 412) {
+        setErr(
+          "This document was changed by someone else since you opened it. Copy your changes, reload the document and apply them again."
+        );
+        return;
+      }
+      if (res.status === 423) {
+        const data = await res.json().catch(() => null);
+        const holder = data?.lock?.holder || "another user";
+        setErr(
+          `This document is checked out by ${holder}. Your changes can be saved once the lock is released.`
+        );
+        return;
+      }
       if (res.status === 409) {
         const conflictSlug = renameTo || targetSlug;
         let conflictStatus = null;
@@ -137,6 +137,16 @@ const DocumentTreeItem = React.memo(
             {originLabel && (
               <span className="doc-tree-origin">{originLabel}</span>
             )}
+            {node.lock && (
+              <span
+                className="doc-tree-origin"
+                title={`Checked out by ${node.lock.holder}${
+                  node.lock.reason ? `: ${node.lock.reason}` : ""
+                }`}
+              >
+                locked
+              </span>
+            )}
           </div>
 
           <div className="doc-tree-actions">
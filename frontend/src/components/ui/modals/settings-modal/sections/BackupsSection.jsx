@@ -1,6 +1,7 @@
 import React, { useEffect, useState } from "react";
 import { apiFetch } from "../../../../../api/client";
 import ROUTES from "../../../../../api/routes";
+import { subscribeEvent } from "../../../../../api/events";
 
 export default function BackupsSection({ user, canAdmin }) {
   const [list, setList] = useState([]);
@@ -26,6 +27,8 @@ export default function BackupsSection({ user, canAdmin }) {
     fetchList();
   }, []);
 
+  useEffect(() => subscribeEvent("backup.finished", () => fetchList()), []);
+
   async function createBackup() {
     setBusy(true);
     setError(null);
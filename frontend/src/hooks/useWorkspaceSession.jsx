@@ -8,6 +8,12 @@ import React, {
 import { renderMarkdown } from "../utils/markdown";
 import { apiFetch } from "../api/client";
 import ROUTES from "../api/routes";
+import {
+  connectEvents,
+  disconnectEvents,
+  setPresence,
+  subscribeEvent,
+} from "../api/events";
 const Editor = React.lazy(() =>
   import("../components/documents/document-editor/index.jsx")
 );
@@ -818,6 +824,17 @@ export default function useWorkspaceSession() {
     user?.username,
   ]);
 
+  const documentRevision = useCallback(
+    (slug) => {
+      if (selectedDoc?.slug === slug && selectedDoc?.revision) {
+        return selectedDoc.revision;
+      }
+      const node = navNodes.find((item) => item?.slug === slug);
+      return node?.revision || null;
+    },
+    [navNodes, selectedDoc?.revision, selectedDoc?.slug]
+  );
+
   const handleMoveNode = useCallback(
     (node) => {
       if (!node?.slug) return;
@@ -836,15 +853,17 @@ export default function useWorkspaceSession() {
             slug: node.slug,
             parent: targetParent || "",
           };
+          const revision = documentRevision(node.slug);
           const data = await apiFetch("/api/document/move", {
             method: "POST",
+            headers: revision ? { "If-Match": revision } : undefined,
             body: payload,
           });
           await refreshAfterSave(data?.slug || node.slug);
         }
       );
     },
-    [refreshAfterSave, requestParentPicker]
+    [documentRevision, refreshAfterSave, requestParentPicker]
   );
 
   const handleHistoryRollback = useCallback(
@@ -865,6 +884,9 @@ export default function useWorkspaceSession() {
           `/api/documentrestore/${encodeURIComponent(targetSlug)}`,
           {
             method: "POST",
+            headers: selectedDoc?.revision
+              ? { "If-Match": selectedDoc.revision }
+              : undefined,
             body: { id: entry.id },
           }
         );
@@ -876,7 +898,13 @@ export default function useWorkspaceSession() {
         setHistoryRestoreId(null);
       }
     },
-    [canRestoreHistory, loadHistory, refreshAfterSave, selectedDoc?.slug]
+    [
+      canRestoreHistory,
+      loadHistory,
+      refreshAfterSave,
+      selectedDoc?.revision,
+      selectedDoc?.slug,
+    ]
   );
 
   const handleMarkdownLinkClick = useCallback(
@@ -1177,8 +1205,10 @@ export default function useWorkspaceSession() {
         if (normalized === "unlisted" && targetNode?.is_home) {
           await handleToggleHome(slug, false);
         }
+        const revision = documentRevision(slug);
         await apiFetch(ROUTES.documentStatus(slug), {
           method: "PUT",
+          headers: revision ? { "If-Match": revision } : undefined,
           body: { status: normalized },
         });
         const updateStatusForSlug = (node) => {
@@ -1206,7 +1236,7 @@ export default function useWorkspaceSession() {
         setError(err?.message || "Failed to update status");
       }
     },
-    [handleToggleHome, loadNav, navNodes]
+    [documentRevision, handleToggleHome, loadNav, navNodes]
   );
 
   const handleSectionChange = useCallback(
@@ -1925,6 +1955,79 @@ export default function useWorkspaceSession() {
     </div>
   );
 
+  useEffect(() => {
+    if (!user?.username) return;
+    connectEvents();
+    return () => disconnectEvents();
+  }, [user?.username]);
+
+  const viewedSlug =
+    selectedDoc?.slug && selectedDocMetadata?.status !== "draft"
+      ? selectedDoc.slug
+      : "";
+  useEffect(() => {
+    if (!user?.username || showEditor) return;
+    setPresence(viewedSlug, "viewing");
+  }, [showEditor, user?.username, viewedSlug]);
+
+  const liveDocRef = useRef({ slug: "", editing: false });
+  useEffect(() => {
+    liveDocRef.current = { slug: viewedSlug, editing: showEditor };
+  }, [showEditor, viewedSlug]);
+
+  useEffect(() => {
+    const username = user?.username;
+    if (!username) return;
+    let treeTimer = null;
+    const fromOthers = (event) => event?.actor !== username;
+    const refreshTree = () => {
+      clearTimeout(treeTimer);
+      treeTimer = setTimeout(() => loadNav(), 300);
+    };
+    const reopenIfViewing = (slug, nextSlug = slug) => {
+      const live = liveDocRef.current;
+      if (!live.slug || live.editing || live.slug !== slug) return;
+      openDocument(nextSlug);
+    };
+    const unsubscribers = [
+      subscribeEvent("tree.changed", (event) => {
+        if (fromOthers(event)) refreshTree();
+      }),
+      subscribeEvent("document.saved", (event) => {
+        if (fromOthers(event)) reopenIfViewing(event.slug);
+      }),
+      subscribeEvent("document.status", (event) => {
+        if (fromOthers(event)) reopenIfViewing(event.slug);
+      }),
+      subscribeEvent("document.moved", (event) => {
+        if (!fromOthers(event)) return;
+        const from = event.data?.from || "";
+        const to = event.data?.to || "";
+        const current = liveDocRef.current.slug;
+        if (!from || !to || !current) return;
+        if (current === from) {
+          reopenIfViewing(current, to);
+        } else if (current.startsWith(`${from}/`)) {
+          reopenIfViewing(current, `${to}${current.slice(from.length)}`);
+        }
+      }),
+      subscribeEvent("document.deleted", (event) => {
+        if (!fromOthers(event) || liveDocRef.current.slug !== event.slug) {
+          return;
+        }
+        setSelectedDoc(null);
+        setContent("");
+        setError(
+          `This document was deleted by ${event.actor || "another user"}.`
+        );
+      }),
+    ];
+    return () => {
+      clearTimeout(treeTimer);
+      unsubscribers.forEach((unsubscribe) => unsubscribe());
+    };
+  }, [loadNav, openDocument, user?.username]);
+
   const prevEditorSlugRef = useRef(null);
   useEffect(() => {
     const current = selectedDoc?.slug || null;
@@ -1957,6 +2060,7 @@ export default function useWorkspaceSession() {
     metadata: selectedDocMetadata,
     currentUser: user,
     currentDocId: editorMode === "edit" ? selectedDoc?.doc_id : null,
+    revision: editorMode === "edit" ? selectedDoc?.revision : null,
     parentSlug: editorMode === "new" ? pendingNewDocParent : "",
     parentOptions: editorMode === "new" ? locationOptions : [],
     onParentSlugChange: editorMode === "new" ? handleEditorParentChange : null,